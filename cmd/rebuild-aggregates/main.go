@@ -0,0 +1,51 @@
+// Recomputes the running aggregates of the surveys from their answers, to run once
+// the questions of a survey or the aggregate definitions change.
+//
+//	DATABASE_URL=postgres://... go run ./cmd/rebuild-aggregates [-survey id]
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/store"
+	"github.com/paulexconde/justasking/internal/services"
+)
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("DATABASE_URL"), "the postgres connection string, defaults to $DATABASE_URL")
+	surveyID := flag.String("survey", "", "the survey to rebuild, every survey when empty")
+	flag.Parse()
+
+	if *dsn == "" {
+		log.Fatal("missing postgres connection string, set -dsn or $DATABASE_URL")
+	}
+
+	db, err := sqlx.Connect("postgres", *dsn)
+	if err != nil {
+		log.Fatalf("cannot connect to postgres: %v", err)
+	}
+	defer db.Close()
+
+	surveyservice := services.NewSurveyService(
+		store.NewDataStore[models.Survey](db, "surveys"),
+		store.NewDataStore[models.Question](db, "survey_questions"),
+	)
+	// no response service nor store, the aggregates are only rebuilt
+	aggregateservice := services.NewAggregateService(surveyservice, nil, nil, store.NewDataStore[models.QuestionAggregate](db, "survey_question_aggregates"))
+
+	if *surveyID != "" {
+		err = aggregateservice.RebuildAggregates(*surveyID)
+	} else {
+		err = aggregateservice.RebuildAllAggregates()
+	}
+	if err != nil {
+		log.Fatalf("cannot rebuild the aggregates: %v", err)
+	}
+
+	log.Print("aggregates rebuilt")
+}
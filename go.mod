@@ -6,4 +6,5 @@ require (
 	github.com/expr-lang/expr v1.17.5
 	github.com/jmoiron/sqlx v1.4.0
 	github.com/lib/pq v1.10.9
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type LibraryQuestion struct {
+	ID        string         `db:"id" json:"id"`
+	Text      string         `db:"text" json:"text"`
+	Type      string         `db:"question_type" json:"type"`
+	Options   pq.StringArray `db:"options" json:"options"`
+	Tags      pq.StringArray `db:"tags" json:"tags"`
+	Version   int            `db:"version" json:"version"`
+	UpdatedAt time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// The DTO used for creating and updating a library question.
+type LibraryQuestionDTO struct {
+	Text      string         `db:"text"`
+	Type      string         `db:"question_type"`
+	Options   pq.StringArray `db:"options"`
+	Tags      pq.StringArray `db:"tags"`
+	Version   int            `db:"version"`
+	UpdatedAt time.Time      `db:"updated_at"`
+}
+
+func (d *LibraryQuestionDTO) ToModel(id int) any {
+	return &LibraryQuestion{
+		ID:        strconv.Itoa(id),
+		Text:      d.Text,
+		Type:      d.Type,
+		Options:   d.Options,
+		Tags:      d.Tags,
+		Version:   d.Version,
+		UpdatedAt: d.UpdatedAt,
+	}
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+type SurveyResponse struct {
+	ID           string       `db:"id" json:"id"`
+	SurveyID     string       `db:"survey_id" json:"survey_id"`
+	ResponseID   string       `db:"response_id" json:"response_id"` // the id given by the client, unique per survey
+	HiddenFields HiddenFields `db:"hidden_fields" json:"hidden_fields"`
+	Weight       float64      `db:"weight" json:"weight"` // the survey weight, 1 until the responses are raked
+	CreatedAt    time.Time    `db:"created_at" json:"created_at"`
+}
+
+// The jsonb of the hidden fields, stored as an empty object when nil.
+type HiddenFields map[string]string
+
+func (h HiddenFields) Value() (driver.Value, error) {
+	if h == nil {
+		return "{}", nil
+	}
+
+	return jsonbValue(h)
+}
+
+func (h *HiddenFields) Scan(src any) error { return jsonbScan(src, h) }
+
+type Answer struct {
+	ResponseID string     `db:"response_id" json:"response_id"`
+	QuestionID string     `db:"question_id" json:"question_id"`
+	Value      RawJSON    `db:"value" json:"value"` // jsonb
+	ShownAt    *time.Time `db:"shown_at" json:"shown_at"`
+	AnsweredAt *time.Time `db:"answered_at" json:"answered_at"`
+}
+
+// Raw jsonb value, written as text since the driver sends bytes as bytea.
+type RawJSON []byte
+
+func (r RawJSON) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	return string(r), nil
+}
+
+func (r *RawJSON) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*r = nil
+	case []byte:
+		*r = append((*r)[:0], v...)
+	case string:
+		*r = RawJSON(v)
+	default:
+		return fmt.Errorf("cannot scan %T into jsonb", src)
+	}
+
+	return nil
+}
+
+func (r RawJSON) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+
+	return r, nil
+}
+
+// The DTO used for creating a response along with its answers.
+//
+// The answers are written by the response store hooks within the same transaction.
+type SurveyResponseDTO struct {
+	SurveyID     string       `db:"survey_id"`
+	ResponseID   string       `db:"response_id"`
+	HiddenFields HiddenFields `db:"hidden_fields"`
+	Weight       float64      `db:"weight"`
+	CreatedAt    time.Time    `db:"created_at"`
+	Answers      []Answer     `db:"-"`
+}
+
+func (d *SurveyResponseDTO) ToModel(id int) any {
+	return &SurveyResponse{
+		ID:           strconv.Itoa(id),
+		SurveyID:     d.SurveyID,
+		ResponseID:   d.ResponseID,
+		HiddenFields: d.HiddenFields,
+		Weight:       d.Weight,
+		CreatedAt:    d.CreatedAt,
+	}
+}
+
+// A tag given to the answer of a response e.g. the topic of an open-ended answer.
+type ResponseTag struct {
+	SurveyID   string `db:"survey_id" json:"survey_id"`
+	ResponseID string `db:"response_id" json:"response_id"`
+	QuestionID string `db:"question_id" json:"question_id"`
+	Tag        string `db:"tag" json:"tag"`
+}
+
+// A response along with one of its answers, as streamed by the exports.
+//
+// The answer columns are null for a response without answers.
+type ResponseAnswer struct {
+	ID           string       `db:"id"`
+	ResponseID   string       `db:"response_id"`
+	HiddenFields HiddenFields `db:"hidden_fields"`
+	Weight       float64      `db:"weight"`
+	CreatedAt    time.Time    `db:"created_at"`
+	QuestionID   *string      `db:"question_id"`
+	Value        RawJSON      `db:"value"`
+	ShownAt      *time.Time   `db:"shown_at"`
+	AnsweredAt   *time.Time   `db:"answered_at"`
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// The rows of the results aggregates computed in the database.
+
+// The number of answers per question, or per question and value.
+type AnswerCount struct {
+	QuestionID string `db:"question_id" json:"question_id"`
+	Value      string `db:"value" json:"value"` // the answer as text, empty when counting per question
+	Count      int    `db:"count" json:"count"`
+	// The sum of the response weights, the count when unweighted.
+	Weighted float64 `db:"weighted" json:"weighted"`
+}
+
+type NumericAggregate struct {
+	QuestionID string  `db:"question_id" json:"question_id"`
+	Count      int     `db:"count" json:"count"`
+	Weighted   float64 `db:"weighted" json:"weighted"`
+	// Weighted by the response weights.
+	Mean   float64 `db:"mean" json:"mean"`
+	Median float64 `db:"median" json:"median"`
+	StdDev float64 `db:"stddev" json:"stddev"` // sample standard deviation, 0 for a single answer
+	Min    float64 `db:"min" json:"min"`
+	Max    float64 `db:"max" json:"max"`
+}
+
+type HistogramCount struct {
+	QuestionID string  `db:"question_id" json:"question_id"`
+	Bin        int     `db:"bin" json:"bin"` // 1 based
+	Count      int     `db:"count" json:"count"`
+	Weighted   float64 `db:"weighted" json:"weighted"`
+}
+
+type RankAggregate struct {
+	QuestionID  string  `db:"question_id" json:"question_id"`
+	Option      string  `db:"option" json:"option"`
+	AverageRank float64 `db:"average_rank" json:"average_rank"` // weighted by the response weights
+	Count       int     `db:"count" json:"count"`
+	Weighted    float64 `db:"weighted" json:"weighted"`
+}
+
+// The running aggregates of the answers to a question, updated as the responses are saved.
+type QuestionAggregate struct {
+	SurveyID     string   `db:"survey_id" json:"survey_id"`
+	QuestionID   string   `db:"question_id" json:"question_id"`
+	Answered     int      `db:"answered" json:"answered"`
+	NumericCount int      `db:"numeric_count" json:"numeric_count"`
+	Sum          float64  `db:"sum" json:"sum"`
+	SumSquares   float64  `db:"sum_squares" json:"sum_squares"`
+	Min          *float64 `db:"min" json:"min"` // nil until a numeric answer
+	Max          *float64 `db:"max" json:"max"`
+	Promoters    int      `db:"promoters" json:"promoters"`
+	Passives     int      `db:"passives" json:"passives"`
+	Detractors   int      `db:"detractors" json:"detractors"`
+	// The sums of the response weights, of the numeric answers then of the NPS buckets.
+	WeightSum          float64     `db:"weight_sum" json:"weight_sum"`
+	WeightSquares      float64     `db:"weight_squares" json:"weight_squares"`
+	WeightedSum        float64     `db:"weighted_sum" json:"weighted_sum"`
+	WeightedSumSquares float64     `db:"weighted_sum_squares" json:"weighted_sum_squares"`
+	WeightedPromoters  float64     `db:"weighted_promoters" json:"weighted_promoters"`
+	WeightedPassives   float64     `db:"weighted_passives" json:"weighted_passives"`
+	WeightedDetractors float64     `db:"weighted_detractors" json:"weighted_detractors"`
+	NPSWeightSquares   float64     `db:"nps_weight_squares" json:"nps_weight_squares"`
+	ValueCounts        ValueCounts `db:"value_counts" json:"value_counts"`
+	UpdatedAt          time.Time   `db:"updated_at" json:"updated_at"`
+}
+
+// The jsonb of the answer counts keyed by answer, stored as an empty object when nil.
+type ValueCounts map[string]int
+
+func (v ValueCounts) Value() (driver.Value, error) {
+	if v == nil {
+		return "{}", nil
+	}
+
+	return jsonbValue(v)
+}
+
+func (v *ValueCounts) Scan(src any) error { return jsonbScan(src, v) }
+
+// The longest value in bytes of an exported string column.
+type ColumnWidth struct {
+	Name  string `db:"name" json:"name"`
+	Width int    `db:"width" json:"width"`
+}
@@ -1,21 +1,144 @@
 package models
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
 type Survey struct {
-	ID      string `db:"id" json:"id"`
-	Title   string `db:"title" json:"title"`
-	StartID string `db:"start_id" json:"start_id"`
+	ID           string       `db:"id" json:"id"`
+	Title        string       `db:"title" json:"title"`
+	StartID      string       `db:"start_id" json:"start_id"`
+	Locale       string       `db:"locale" json:"locale"`
+	Status       string       `db:"status" json:"status"`
+	OpensAt      *time.Time   `db:"opens_at" json:"opens_at"`
+	ClosesAt     *time.Time   `db:"closes_at" json:"closes_at"`
+	MaxResponses int          `db:"max_responses" json:"max_responses"`
+	Endings      Endings      `db:"endings" json:"endings"`           // jsonb
+	Translations Translations `db:"translations" json:"translations"` // jsonb
 }
 
 type Question struct {
-	ID           string            `db:"id" json:"id"`
-	SurveyID     string            `db:"survey_id" json:"survey_id"`
-	Text         string            `db:"text" json:"text"`
-	Type         string            `db:"question_type" json:"type"`        // should be a custom type
-	Next         string            `db:"next" json:"next"`                 // this is the next question id
-	Conditionals []ConditionalNext `db:"conditionals" json:"conditionals"` // this is a jsonb type in database to hold numerous question determined by prev question
+	ID           string         `db:"id" json:"id"`
+	SurveyID     string         `db:"survey_id" json:"survey_id"`
+	Text         string         `db:"text" json:"text"`
+	Type         string         `db:"question_type" json:"type"` // should be a custom type
+	Options      pq.StringArray `db:"options" json:"options"`
+	Next         NextMap        `db:"next" json:"next"`                 // jsonb of the next question id keyed by answer
+	Conditionals Conditionals   `db:"conditionals" json:"conditionals"` // this is a jsonb type in database to hold numerous question determined by prev question
+
+	LibraryID      *string `db:"library_id" json:"library_id"`
+	LibraryVersion int     `db:"library_version" json:"library_version"`
+	LibraryLinked  bool    `db:"library_linked" json:"library_linked"` // receives the library updates, otherwise it is a copy
 }
 
 type ConditionalNext struct {
-	Expression string
-	NextID     string
+	Expression string `json:"expression"`
+	NextID     string `json:"next_id"`
+}
+
+type Ending struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+type QuestionTranslation struct {
+	Text    string   `json:"text"`
+	Options []string `json:"options"`
+}
+
+type EndingTranslation struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+type Translation struct {
+	Title     string                         `json:"title"`
+	Questions map[string]QuestionTranslation `json:"questions"`
+	Endings   map[string]EndingTranslation   `json:"endings"`
+}
+
+// The jsonb columns, maps are used over slices since the store casts slices into postgres arrays.
+type (
+	Conditionals []ConditionalNext
+	NextMap      map[string]string
+	Endings      map[string]Ending
+	Translations map[string]Translation
+)
+
+func (c Conditionals) Value() (driver.Value, error) { return jsonbValue(c) }
+func (c *Conditionals) Scan(src any) error          { return jsonbScan(src, c) }
+func (n NextMap) Value() (driver.Value, error)      { return jsonbValue(n) }
+func (n *NextMap) Scan(src any) error               { return jsonbScan(src, n) }
+func (e Endings) Value() (driver.Value, error)      { return jsonbValue(e) }
+func (e *Endings) Scan(src any) error               { return jsonbScan(src, e) }
+func (t Translations) Value() (driver.Value, error) { return jsonbValue(t) }
+func (t *Translations) Scan(src any) error          { return jsonbScan(src, t) }
+
+func jsonbValue(v any) (driver.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func jsonbScan(src any, dest any) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	default:
+		return fmt.Errorf("cannot scan %T into jsonb", src)
+	}
+}
+
+// The DTO used for creating and updating a survey along with its questions.
+//
+// The questions are written by the survey store hooks within the same transaction.
+type SurveyDTO struct {
+	Title        string       `db:"title"`
+	StartID      string       `db:"start_id"`
+	Locale       string       `db:"locale"`
+	Status       string       `db:"status"`
+	OpensAt      *time.Time   `db:"opens_at"`
+	ClosesAt     *time.Time   `db:"closes_at"`
+	MaxResponses int          `db:"max_responses"`
+	Endings      Endings      `db:"endings"`
+	Translations Translations `db:"translations"`
+	Questions    []Question   `db:"-"`
+}
+
+func (d *SurveyDTO) ToModel(id int) any {
+	return &Survey{
+		ID:           strconv.Itoa(id),
+		Title:        d.Title,
+		StartID:      d.StartID,
+		Locale:       d.Locale,
+		Status:       d.Status,
+		OpensAt:      d.OpensAt,
+		ClosesAt:     d.ClosesAt,
+		MaxResponses: d.MaxResponses,
+		Endings:      d.Endings,
+		Translations: d.Translations,
+	}
+}
+
+// The DTO used for updating the survey status only.
+type SurveyStatusDTO struct {
+	Status string `db:"status"`
+}
+
+func (d *SurveyStatusDTO) ToModel(id int) any {
+	return &Survey{ID: strconv.Itoa(id), Status: d.Status}
 }
@@ -0,0 +1,442 @@
+// Writes SPSS system files (.sav), uncompressed and UTF-8 encoded.
+//
+// The dictionary is written up front and the cases streamed after it, the number of
+// cases is left unknown in the header as SPSS allows so no case is held in memory.
+package spss
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The limits of the format.
+const (
+	MaxNameLength       = 64
+	MaxStringWidth      = 255
+	MaxLabelLength      = 255
+	MaxValueLabelLength = 120
+	MaxMissingValues    = 3
+)
+
+// The value of a missing numeric, written for nil values.
+const SystemMissing = -math.MaxFloat64
+
+// The print and write format types.
+type FormatType int32
+
+const (
+	FormatA        FormatType = 1
+	FormatF        FormatType = 5
+	FormatDateTime FormatType = 22
+)
+
+// The measurement level of a variable.
+type Measure int32
+
+const (
+	Nominal Measure = iota + 1
+	Ordinal
+	Scale
+)
+
+var measureNames = map[Measure]string{
+	Nominal: "nominal",
+	Ordinal: "ordinal",
+	Scale:   "scale",
+}
+
+func (m Measure) String() string {
+	if name, ok := measureNames[m]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Measure(%d)", int(m))
+}
+
+// A value label of a numeric variable.
+type ValueLabel struct {
+	Value float64
+	Label string
+}
+
+// A column of the data file.
+type Variable struct {
+	// Up to 64 bytes, starting with a letter, unique regardless of case.
+	Name  string
+	Label string
+	// The width of a string variable from 1 to 255, 0 for a numeric variable.
+	Width int
+	// The display format of a numeric variable, F when zero.
+	Format        FormatType
+	FormatWidth   int
+	Decimals      int
+	Measure       Measure
+	ValueLabels   []ValueLabel
+	MissingValues []float64
+}
+
+// The file header.
+type Header struct {
+	Label   string
+	Created time.Time
+	// The variable the cases are weighted by, none when empty.
+	WeightVariable string
+}
+
+// Streams the cases of a data file.
+type Writer struct {
+	w         *bufio.Writer
+	variables []Variable
+	err       error
+}
+
+// The seconds from the start of the gregorian calendar SPSS dates count from.
+var gregorianEpoch = time.Date(1582, time.October, 14, 0, 0, 0, 0, time.UTC).Unix()
+
+// Converts the time into an SPSS date-time value.
+func DateTime(t time.Time) float64 {
+	return float64(t.Unix()-gregorianEpoch) + float64(t.Nanosecond())/1e9
+}
+
+// Writes the dictionary of the variables, the cases follow with `WriteCase`.
+func NewWriter(w io.Writer, header Header, variables []Variable) (*Writer, error) {
+	shortNames, err := validate(variables)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &Writer{w: bufio.NewWriter(w), variables: variables}
+
+	// the position of each variable in 8-byte units, 1-based
+	positions := make([]int32, len(variables))
+	var segments int32
+	weight := int32(0)
+
+	for i, variable := range variables {
+		positions[i] = segments + 1
+		segments += int32(variable.segments())
+		if header.WeightVariable != "" && strings.EqualFold(variable.Name, header.WeightVariable) {
+			if variable.Width > 0 {
+				return nil, fmt.Errorf("weight variable %q is not numeric", variable.Name)
+			}
+			weight = positions[i]
+		}
+	}
+	if header.WeightVariable != "" && weight == 0 {
+		return nil, fmt.Errorf("unknown weight variable %q", header.WeightVariable)
+	}
+
+	writer.header(header, segments, weight)
+
+	for i, variable := range variables {
+		writer.variable(variable, shortNames[i])
+	}
+
+	for i, variable := range variables {
+		writer.valueLabels(variable, positions[i])
+	}
+
+	writer.integerInfo()
+	writer.floatInfo()
+	writer.displayParameters()
+	writer.longNames(shortNames)
+	writer.encoding()
+	writer.int32s(999, 0)
+
+	return writer, writer.err
+}
+
+// Writes a case, a float64 or nil per numeric variable and a string per string variable.
+//
+// The strings longer than their variable width are cut on a character boundary.
+func (w *Writer) WriteCase(values []any) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	if len(values) != len(w.variables) {
+		return fmt.Errorf("expected %d values, got %d", len(w.variables), len(values))
+	}
+
+	for i, variable := range w.variables {
+		if variable.Width == 0 {
+			switch v := values[i].(type) {
+			case nil:
+				w.float64s(SystemMissing)
+			case float64:
+				if math.IsNaN(v) || math.IsInf(v, 0) {
+					v = SystemMissing
+				}
+				w.float64s(v)
+			default:
+				return fmt.Errorf("variable %s expects a number, got %T", variable.Name, values[i])
+			}
+			continue
+		}
+
+		var text string
+		switch v := values[i].(type) {
+		case nil:
+		case string:
+			text = v
+		default:
+			return fmt.Errorf("variable %s expects a string, got %T", variable.Name, values[i])
+		}
+
+		w.padded(truncate(text, variable.Width), variable.segments()*8)
+	}
+
+	return w.err
+}
+
+// Flushes the cases written.
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	return w.w.Flush()
+}
+
+func validate(variables []Variable) ([]string, error) {
+	if len(variables) == 0 {
+		return nil, errors.New("no variable to write")
+	}
+
+	names := make(map[string]bool, len(variables))
+	shortNames := make([]string, len(variables))
+	taken := make(map[string]bool, len(variables))
+
+	for i, variable := range variables {
+		if !ValidName(variable.Name) {
+			return nil, fmt.Errorf("invalid variable name %q", variable.Name)
+		}
+
+		upper := strings.ToUpper(variable.Name)
+		if names[upper] {
+			return nil, fmt.Errorf("duplicate variable name %q", variable.Name)
+		}
+		names[upper] = true
+
+		if variable.Width < 0 || variable.Width > MaxStringWidth {
+			return nil, fmt.Errorf("variable %s width %d out of 0 to %d", variable.Name, variable.Width, MaxStringWidth)
+		}
+		if len(variable.MissingValues) > MaxMissingValues {
+			return nil, fmt.Errorf("variable %s has more than %d missing values", variable.Name, MaxMissingValues)
+		}
+		if variable.Width > 0 && (len(variable.MissingValues) > 0 || len(variable.ValueLabels) > 0) {
+			return nil, fmt.Errorf("string variable %s cannot have missing values or value labels", variable.Name)
+		}
+
+		// the 8 bytes names of the dictionary, the long names are mapped to them
+		short := truncate(upper, 8)
+		if taken[short] {
+			for n := 1; ; n++ {
+				short = fmt.Sprintf("V%d", n)
+				if !taken[short] && !names[short] {
+					break
+				}
+			}
+		}
+		taken[short] = true
+		shortNames[i] = short
+	}
+
+	return shortNames, nil
+}
+
+var reservedNames = map[string]bool{
+	"ALL": true, "AND": true, "BY": true, "EQ": true, "GE": true, "GT": true, "LE": true,
+	"LT": true, "NE": true, "NOT": true, "OR": true, "TO": true, "WITH": true,
+}
+
+// Whether the name is a valid variable name.
+func ValidName(name string) bool {
+	if name == "" || len(name) > MaxNameLength || reservedNames[strings.ToUpper(name)] || strings.HasSuffix(name, ".") {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '@', r == '#', r == '$':
+		case i > 0 && (r >= '0' && r <= '9' || r == '_' || r == '.'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// The number of 8 bytes units of the variable in a case.
+func (v Variable) segments() int {
+	if v.Width == 0 {
+		return 1
+	}
+
+	return (v.Width + 7) / 8
+}
+
+// The print and write format.
+func (v Variable) format() int32 {
+	if v.Width > 0 {
+		return int32(FormatA)<<16 | int32(v.Width)<<8
+	}
+
+	format, width := v.Format, v.FormatWidth
+	if format == 0 {
+		format = FormatF
+	}
+	if width == 0 {
+		width = 8
+	}
+
+	return int32(format)<<16 | int32(width)<<8 | int32(v.Decimals)
+}
+
+func (w *Writer) header(header Header, segments, weight int32) {
+	w.padded("$FL2", 4)
+	w.padded("@(#) SPSS DATA FILE - justasking", 60)
+	w.int32s(2, segments, 0, weight, -1)
+	w.float64s(100)
+
+	created := header.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	w.padded(created.Format("02 Jan 06"), 9)
+	w.padded(created.Format("15:04:05"), 8)
+	w.padded(truncate(header.Label, 64), 64)
+	w.write(make([]byte, 3))
+}
+
+func (w *Writer) variable(variable Variable, shortName string) {
+	hasLabel := int32(0)
+	if variable.Label != "" {
+		hasLabel = 1
+	}
+
+	w.int32s(2, int32(variable.Width), hasLabel, int32(len(variable.MissingValues)), variable.format(), variable.format())
+	w.padded(shortName, 8)
+
+	if hasLabel == 1 {
+		label := truncate(variable.Label, MaxLabelLength)
+		w.int32s(int32(len(label)))
+		w.padded(label, (len(label)+3)/4*4)
+	}
+
+	w.float64s(variable.MissingValues...)
+
+	// the string variables take a record per extra 8 bytes
+	for i := 1; i < variable.segments(); i++ {
+		w.int32s(2, -1, 0, 0, 0, 0)
+		w.padded("", 8)
+	}
+}
+
+func (w *Writer) valueLabels(variable Variable, position int32) {
+	if len(variable.ValueLabels) == 0 {
+		return
+	}
+
+	w.int32s(3, int32(len(variable.ValueLabels)))
+	for _, label := range variable.ValueLabels {
+		text := truncate(label.Label, MaxValueLabelLength)
+		w.float64s(label.Value)
+		w.write([]byte{byte(len(text))})
+		// the length byte and the label are padded to a multiple of 8
+		w.padded(text, (len(text)+1+7)/8*8-1)
+	}
+
+	w.int32s(4, 1, position)
+}
+
+func (w *Writer) integerInfo() {
+	w.int32s(7, 3, 4, 8)
+	// version, machine code, IEEE 754, compression, little-endian, UTF-8 code page
+	w.int32s(1, 0, 0, -1, 1, 1, 2, 65001)
+}
+
+func (w *Writer) floatInfo() {
+	w.int32s(7, 4, 8, 3)
+	w.float64s(SystemMissing, math.MaxFloat64, math.Nextafter(-math.MaxFloat64, 0))
+}
+
+func (w *Writer) displayParameters() {
+	w.int32s(7, 11, 4, int32(len(w.variables)*3))
+
+	for _, variable := range w.variables {
+		measure, alignment := variable.Measure, int32(1)
+		if variable.Width > 0 {
+			alignment = 0
+			if measure == 0 {
+				measure = Nominal
+			}
+		}
+		if measure == 0 {
+			measure = Scale
+		}
+
+		width := int32(max(8, min(variable.Width, 40)))
+		w.int32s(int32(measure), width, alignment)
+	}
+}
+
+func (w *Writer) longNames(shortNames []string) {
+	pairs := make([]string, len(w.variables))
+	for i, variable := range w.variables {
+		pairs[i] = shortNames[i] + "=" + variable.Name
+	}
+
+	names := strings.Join(pairs, "\t")
+	w.int32s(7, 13, 1, int32(len(names)))
+	w.write([]byte(names))
+}
+
+func (w *Writer) encoding() {
+	w.int32s(7, 20, 1, 5)
+	w.write([]byte("UTF-8"))
+}
+
+func (w *Writer) write(b []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
+
+func (w *Writer) int32s(values ...int32) {
+	for _, v := range values {
+		w.write(binary.LittleEndian.AppendUint32(nil, uint32(v)))
+	}
+}
+
+func (w *Writer) float64s(values ...float64) {
+	for _, v := range values {
+		w.write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)))
+	}
+}
+
+// Writes the text padded with spaces to the size, the text must fit.
+func (w *Writer) padded(text string, size int) {
+	w.write([]byte(text + strings.Repeat(" ", size-len(text))))
+}
+
+// Cuts the text to at most n bytes on a character boundary.
+func truncate(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+
+	return text[:n]
+}
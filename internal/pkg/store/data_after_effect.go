@@ -160,16 +160,10 @@ func (s *dataStoreAfterEffect[T]) Create(ctx context.Context, data DTO) (any, er
 		}
 	}
 
+	var jobs []AfterSaveCommitHook
 	for _, hook := range s.hooks.AfterSaveCommit {
 		if fn := hook(ctx, data, model, true); fn != nil {
-			jobFn := fn
-			s.jobQueue.Submit(workerpool.WithRetry(3, 500*time.Millisecond, func() error {
-				if ctx.Err() != nil {
-					return ctx.Err()
-				}
-				jobFn()
-				return nil
-			}))
+			jobs = append(jobs, fn)
 		}
 	}
 
@@ -177,6 +171,8 @@ func (s *dataStoreAfterEffect[T]) Create(ctx context.Context, data DTO) (any, er
 		return nil, err
 	}
 
+	s.submitAfterCommit(ctx, jobs)
+
 	return model, nil
 }
 
@@ -257,17 +253,10 @@ func (s *dataStoreAfterEffect[T]) Update(ctx context.Context, id int, data DTO)
 	}
 
 	// Collect post commit jobs
+	var jobs []AfterSaveCommitHook
 	for _, hook := range s.hooks.AfterSaveCommit {
 		if fn := hook(ctx, data, updatedModel, false); fn != nil {
-			jobFn := fn
-
-			s.jobQueue.Submit(workerpool.WithRetry(3, 500*time.Millisecond, func() error {
-				if ctx.Err() != nil {
-					return ctx.Err()
-				}
-				jobFn()
-				return nil
-			}))
+			jobs = append(jobs, fn)
 		}
 	}
 
@@ -275,9 +264,26 @@ func (s *dataStoreAfterEffect[T]) Update(ctx context.Context, id int, data DTO)
 		return nil, err
 	}
 
+	s.submitAfterCommit(ctx, jobs)
+
 	return updatedModel, nil
 }
 
+// Submits the post commit jobs, only once committed so they see the saved rows.
+func (s *dataStoreAfterEffect[T]) submitAfterCommit(ctx context.Context, jobs []AfterSaveCommitHook) {
+	for _, fn := range jobs {
+		jobFn := fn
+
+		s.jobQueue.Submit(workerpool.WithRetry(3, 500*time.Millisecond, func() error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			jobFn()
+			return nil
+		}))
+	}
+}
+
 func (s *dataStoreAfterEffect[T]) DeleteWhere(ctx context.Context, column string, value any) error {
 	tx, err := s.db.BeginTxx(ctx, &sql.TxOptions{})
 	if err != nil {
@@ -0,0 +1,202 @@
+package textanalysis
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// A sparse vector of term weights.
+type Vector map[string]float64
+
+// The dot product, the cosine similarity for unit vectors.
+func (v Vector) Dot(other Vector) float64 {
+	if len(other) < len(v) {
+		v, other = other, v
+	}
+
+	var dot float64
+	for term, weight := range v {
+		dot += weight * other[term]
+	}
+
+	return dot
+}
+
+func (v Vector) normalize() Vector {
+	var norm float64
+	for _, weight := range v {
+		norm += weight * weight
+	}
+
+	if norm == 0 {
+		return v
+	}
+
+	norm = math.Sqrt(norm)
+	for term := range v {
+		v[term] /= norm
+	}
+
+	return v
+}
+
+// The terms with the highest weights, at most n of them.
+func (v Vector) TopTerms(n int) []string {
+	terms := make([]string, 0, len(v))
+	for term := range v {
+		terms = append(terms, term)
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if v[terms[i]] != v[terms[j]] {
+			return v[terms[i]] > v[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+
+	return terms[:min(n, len(terms))]
+}
+
+// Weights the terms of each document by TF-IDF, the vectors are unit vectors.
+//
+// The smoothed idf ln((1 + N) / (1 + df)) + 1 keeps the terms found in every document.
+func TFIDF(documents [][]string) []Vector {
+	frequencies := make(map[string]int)
+	for _, document := range documents {
+		seen := make(map[string]bool)
+		for _, term := range document {
+			if !seen[term] {
+				seen[term] = true
+				frequencies[term]++
+			}
+		}
+	}
+
+	n := float64(len(documents))
+	vectors := make([]Vector, 0, len(documents))
+
+	for _, document := range documents {
+		vector := make(Vector)
+		for _, term := range document {
+			vector[term]++
+		}
+
+		for term, count := range vector {
+			tf := count / float64(len(document))
+			idf := math.Log((1+n)/(1+float64(frequencies[term]))) + 1
+			vector[term] = tf * idf
+		}
+
+		vectors = append(vectors, vector.normalize())
+	}
+
+	return vectors
+}
+
+// The maximum number of k-means iterations.
+const maxKMeansIterations = 100
+
+// Clusters the unit vectors by spherical k-means, seeded with k-means++.
+//
+// Returns the cluster of each vector and the unit centroids. The same seed gives the
+// same clusters. k is capped to the number of vectors.
+func KMeans(vectors []Vector, k int, seed int64) ([]int, []Vector) {
+	if len(vectors) == 0 || k < 1 {
+		return nil, nil
+	}
+	k = min(k, len(vectors))
+
+	random := rand.New(rand.NewSource(seed))
+	centroids := kMeansPlusPlus(vectors, k, random)
+	assignments := make([]int, len(vectors))
+
+	for iteration := 0; iteration < maxKMeansIterations; iteration++ {
+		changed := false
+
+		for i, vector := range vectors {
+			best, bestSimilarity := 0, math.Inf(-1)
+			for c, centroid := range centroids {
+				if similarity := vector.Dot(centroid); similarity > bestSimilarity {
+					best, bestSimilarity = c, similarity
+				}
+			}
+
+			if assignments[i] != best {
+				assignments[i] = best
+				changed = true
+			}
+		}
+
+		if !changed && iteration > 0 {
+			break
+		}
+
+		centroids = recomputeCentroids(vectors, assignments, centroids)
+	}
+
+	return assignments, centroids
+}
+
+// Picks the first centroid at random then each next one with a probability
+// proportional to its squared distance to the closest centroid picked.
+func kMeansPlusPlus(vectors []Vector, k int, random *rand.Rand) []Vector {
+	centroids := []Vector{vectors[random.Intn(len(vectors))]}
+
+	distances := make([]float64, len(vectors))
+	for len(centroids) < k {
+		var total float64
+		for i, vector := range vectors {
+			closest := math.Inf(1)
+			for _, centroid := range centroids {
+				// squared euclidean distance of unit vectors
+				closest = math.Min(closest, math.Max(0, 2-2*vector.Dot(centroid)))
+			}
+			distances[i] = closest
+			total += closest
+		}
+
+		if total == 0 {
+			// every vector is a centroid already
+			centroids = append(centroids, vectors[random.Intn(len(vectors))])
+			continue
+		}
+
+		target := random.Float64() * total
+		picked := len(vectors) - 1
+		for i, distance := range distances {
+			if target -= distance; target <= 0 {
+				picked = i
+				break
+			}
+		}
+		centroids = append(centroids, vectors[picked])
+	}
+
+	return centroids
+}
+
+// The mean of the vectors of each cluster, an empty cluster keeps its centroid.
+func recomputeCentroids(vectors []Vector, assignments []int, previous []Vector) []Vector {
+	centroids := make([]Vector, len(previous))
+	for c := range centroids {
+		centroids[c] = make(Vector)
+	}
+
+	for i, vector := range vectors {
+		centroid := centroids[assignments[i]]
+		for term, weight := range vector {
+			centroid[term] += weight
+		}
+	}
+
+	for c, centroid := range centroids {
+		if len(centroid) == 0 {
+			centroids[c] = previous[c]
+			continue
+		}
+		centroid.normalize()
+	}
+
+	return centroids
+}
@@ -0,0 +1,131 @@
+package textanalysis
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// The elided articles and pronouns stripped from the french words, e.g. "l'accueil".
+var frenchElisions = []string{"l'", "d'", "j'", "qu'", "c'", "n'", "s'", "m'", "t'"}
+
+// Tokenizes the text and removes the stop words of the language.
+func Words(text, language string) []string {
+	return RemoveStopWords(Tokens(text, language), language)
+}
+
+// Tokenizes the text, stripping the french elisions.
+func Tokens(text, language string) []string {
+	tokens := Tokenize(text)
+
+	if language == "fr" {
+		for i, token := range tokens {
+			for _, elision := range frenchElisions {
+				if strings.HasPrefix(token, elision) && len(token) > len(elision) {
+					tokens[i] = token[len(elision):]
+					break
+				}
+			}
+		}
+	}
+
+	return tokens
+}
+
+// How often a term occurs.
+type TermCount struct {
+	Term  string
+	Count int
+	// The documents the term occurs in.
+	Documents int
+}
+
+// Counts the terms of the documents, most frequent first.
+func TermFrequencies(documents [][]string) []TermCount {
+	return countTerms(documents, func(words []string) []string { return words })
+}
+
+// Counts the pairs of consecutive words of the tokenized documents, most frequent first.
+//
+// The documents keep their stop words, a pair with a stop word is not counted so
+// "not fast" never yields a bigram joining the words around "not".
+func Bigrams(documents [][]string, language string) []TermCount {
+	return countTerms(documents, func(tokens []string) []string {
+		var bigrams []string
+		for i := 0; i+1 < len(tokens); i++ {
+			if IsStopWord(tokens[i], language) || IsStopWord(tokens[i+1], language) {
+				continue
+			}
+			bigrams = append(bigrams, tokens[i]+" "+tokens[i+1])
+		}
+		return bigrams
+	})
+}
+
+func countTerms(documents [][]string, terms func(words []string) []string) []TermCount {
+	counts := make(map[string]*TermCount)
+
+	for _, document := range documents {
+		seen := make(map[string]bool)
+		for _, term := range terms(document) {
+			count, ok := counts[term]
+			if !ok {
+				count = &TermCount{Term: term}
+				counts[term] = count
+			}
+
+			count.Count++
+			if !seen[term] {
+				seen[term] = true
+				count.Documents++
+			}
+		}
+	}
+
+	result := make([]TermCount, 0, len(counts))
+	for _, count := range counts {
+		result = append(result, *count)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Term < result[j].Term
+	})
+
+	return result
+}
+
+// A word of the word cloud.
+type WordCloudEntry struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+	// From 0 to 1, relative to the most frequent term, to size the word.
+	Weight float64 `json:"weight"`
+}
+
+// The word cloud of the most frequent terms, at most limit of them when limit > 0.
+//
+// The weights are square root scaled so a few very frequent terms do not dwarf the others.
+func WordCloud(terms []TermCount, limit int) []WordCloudEntry {
+	if limit > 0 && len(terms) > limit {
+		terms = terms[:limit]
+	}
+
+	var highest int
+	for _, term := range terms {
+		highest = max(highest, term.Count)
+	}
+
+	cloud := make([]WordCloudEntry, 0, len(terms))
+	for _, term := range terms {
+		cloud = append(cloud, WordCloudEntry{
+			Term:   term.Term,
+			Count:  term.Count,
+			Weight: math.Sqrt(float64(term.Count) / float64(highest)),
+		})
+	}
+
+	return cloud
+}
@@ -0,0 +1,158 @@
+package textanalysis
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// NOTE: the sentiment is lexicon based, each known word scores from -3 to 3, the
+// score flips for the first word following a negation within three words and grows
+// by half after an intensifier. The sum is normalized into -1 to 1 like VADER does.
+
+// The threshold above which a normalized score is positive, and below its opposite negative.
+const SentimentThreshold = 0.05
+
+// The smoothing of the score normalization, the higher the slower the score saturates.
+const sentimentAlpha = 15
+
+// The polarity of the text.
+type SentimentLabel int
+
+const (
+	Negative SentimentLabel = iota + 1
+	Neutral
+	Positive
+)
+
+var sentimentLabelNames = map[SentimentLabel]string{
+	Negative: "negative",
+	Neutral:  "neutral",
+	Positive: "positive",
+}
+
+func (l SentimentLabel) String() string {
+	if name, ok := sentimentLabelNames[l]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("SentimentLabel(%d)", int(l))
+}
+
+// The sentiment of a text.
+type Sentiment struct {
+	// The normalized score from -1 to 1.
+	Score float64
+	Label SentimentLabel
+	// The sum of the word scores before normalization.
+	Raw float64
+	// The words of the lexicon found in the text.
+	Matches int
+}
+
+// Scores the text with the lexicon of the language, neutral for unknown languages.
+func AnalyzeSentiment(text, language string) Sentiment {
+	lexicon := lexicons[language]
+	tokens := Tokens(text, language)
+
+	var sentiment Sentiment
+
+	// the index of the last token a negation applies to
+	negatedUntil := -1
+
+	for i, token := range tokens {
+		if lexicon.negations[token] {
+			negatedUntil = i + 3
+			continue
+		}
+
+		score, ok := lexicon.words[token]
+		if !ok {
+			continue
+		}
+
+		value := float64(score)
+
+		if i > 0 && lexicon.intensifiers[tokens[i-1]] {
+			value *= 1.5
+		}
+
+		// a negation applies to the first word of the lexicon following it
+		if i <= negatedUntil {
+			value = -value
+			negatedUntil = -1
+		}
+
+		sentiment.Raw += value
+		sentiment.Matches++
+	}
+
+	sentiment.Score = sentiment.Raw / math.Sqrt(sentiment.Raw*sentiment.Raw+sentimentAlpha)
+
+	switch {
+	case sentiment.Score > SentimentThreshold:
+		sentiment.Label = Positive
+	case sentiment.Score < -SentimentThreshold:
+		sentiment.Label = Negative
+	default:
+		sentiment.Label = Neutral
+	}
+
+	return sentiment
+}
+
+type lexicon struct {
+	words        map[string]int
+	negations    map[string]bool
+	intensifiers map[string]bool
+}
+
+// Parses "word:score" pairs separated by spaces.
+func scores(pairs string) map[string]int {
+	words := make(map[string]int)
+	for _, pair := range strings.Fields(pairs) {
+		word, score, _ := strings.Cut(pair, ":")
+		var value int
+		fmt.Sscan(score, &value)
+		words[word] = value
+	}
+
+	return words
+}
+
+var lexicons = map[string]lexicon{
+	"en": {
+		words: scores(`good:2 great:3 excellent:3 amazing:3 awesome:3 love:3 loved:3 like:2 liked:2 nice:2
+			helpful:2 friendly:2 fast:2 quick:2 easy:2 happy:3 glad:2 satisfied:2 perfect:3 best:3 better:2
+			recommend:2 useful:2 clear:1 smooth:2 reliable:2 fantastic:3 wonderful:3 pleasant:2 polite:2
+			efficient:2 simple:1 thanks:2 thank:2 fine:1 ok:1 okay:1 bad:-2 terrible:-3 awful:-3 horrible:-3
+			hate:-3 hated:-3 poor:-2 slow:-2 difficult:-2 hard:-1 confusing:-2 confused:-2 rude:-3 worst:-3
+			worse:-2 broken:-2 bug:-1 bugs:-1 crash:-2 crashes:-2 expensive:-1 annoying:-2 disappointed:-2
+			disappointing:-2 unhappy:-2 frustrating:-2 frustrated:-2 useless:-3 problem:-1 problems:-1
+			issue:-1 issues:-1 wait:-1 waiting:-1 complicated:-2 unreliable:-2 angry:-3 sad:-2 never:-1`),
+		negations:    wordSet(`not no never don't doesn't didn't isn't wasn't aren't weren't won't can't cannot couldn't wouldn't shouldn't without hardly`),
+		intensifiers: wordSet(`very really extremely super so too totally absolutely quite incredibly`),
+	},
+	"es": {
+		words: scores(`bueno:2 buena:2 buenos:2 buenas:2 excelente:3 genial:3 increíble:3 encanta:3 encantó:3
+			gusta:2 gustó:2 amable:2 amables:2 rápido:2 rápida:2 fácil:2 feliz:3 contento:2 satisfecho:2
+			perfecto:3 mejor:2 recomiendo:2 útil:2 claro:1 agradable:2 eficiente:2 gracias:2 bien:1
+			malo:-2 mala:-2 terrible:-3 horrible:-3 odio:-3 pésimo:-3 peor:-2 lento:-2 lenta:-2 difícil:-2
+			confuso:-2 grosero:-3 roto:-2 error:-1 errores:-1 caro:-1 molesto:-2 decepcionado:-2
+			decepcionante:-2 frustrante:-2 inútil:-3 problema:-1 problemas:-1 espera:-1 complicado:-2
+			enojado:-3 triste:-2 nunca:-1`),
+		negations:    wordSet(`no nunca jamás sin tampoco ni`),
+		intensifiers: wordSet(`muy muchísimo demasiado súper totalmente realmente bastante`),
+	},
+	"fr": {
+		words: scores(`bon:2 bonne:2 bien:1 excellent:3 excellente:3 génial:3 super:2 incroyable:3 adore:3
+			aime:2 aimé:2 agréable:2 aimable:2 rapide:2 facile:2 heureux:3 content:2 contente:2 satisfait:2
+			satisfaite:2 parfait:3 parfaite:3 meilleur:2 recommande:2 utile:2 clair:1 efficace:2 merci:2
+			mauvais:-2 mauvaise:-2 terrible:-3 horrible:-3 déteste:-3 nul:-3 pire:-2 lent:-2 lente:-2
+			difficile:-2 compliqué:-2 confus:-2 impoli:-3 cassé:-2 bug:-1 bugs:-1 cher:-1 chère:-1
+			énervant:-2 déçu:-2 déçue:-2 décevant:-2 frustrant:-2 inutile:-3 problème:-1 problèmes:-1
+			attente:-1 fâché:-3 triste:-2 jamais:-1`),
+		negations:    wordSet(`pas ne jamais sans ni aucun aucune`),
+		intensifiers: wordSet(`très vraiment trop super totalement extrêmement assez`),
+	},
+}
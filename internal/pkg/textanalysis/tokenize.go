@@ -0,0 +1,103 @@
+package textanalysis
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Splits the text into lowercased words.
+//
+// Words are runs of letters and digits, an apostrophe inside a word is kept e.g. "don't".
+func Tokenize(text string) []string {
+	var (
+		tokens []string
+		word   strings.Builder
+	)
+
+	runes := []rune(strings.ToLower(text))
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		case (r == '\'' || r == '’') && word.Len() > 0 && i+1 < len(runes) && unicode.IsLetter(runes[i+1]):
+			word.WriteRune('\'')
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// Drops the stop words of the language, the tokens are kept as is for unknown languages.
+func RemoveStopWords(tokens []string, language string) []string {
+	stop := stopWords[language]
+
+	kept := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if !stop[token] {
+			kept = append(kept, token)
+		}
+	}
+
+	return kept
+}
+
+// The languages with stop words and a sentiment lexicon.
+func Languages() []string {
+	languages := make([]string, 0, len(stopWords))
+	for language := range stopWords {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	return languages
+}
+
+// Whether the token is a stop word of the language.
+func IsStopWord(token, language string) bool {
+	return stopWords[language][token]
+}
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+
+	return set
+}
+
+var stopWords = map[string]map[string]bool{
+	"en": wordSet(`a about above after again against all am an and any are aren't as at be because been
+		before being below between both but by can can't cannot could couldn't did didn't do does doesn't
+		doing don't down during each few for from further had hadn't has hasn't have haven't having he
+		he'd he'll he's her here here's hers herself him himself his how how's i i'd i'll i'm i've if in
+		into is isn't it it's its itself let's me more most mustn't my myself no nor not of off on once
+		only or other ought our ours ourselves out over own same shan't she she'd she'll she's should
+		shouldn't so some such than that that's the their theirs them themselves then there there's these
+		they they'd they'll they're they've this those through to too under until up very was wasn't we
+		we'd we'll we're we've were weren't what what's when when's where where's which while who who's
+		whom why why's with won't would wouldn't you you'd you'll you're you've your yours yourself
+		yourselves also just really get got`),
+	"es": wordSet(`a al algo algunas algunos ante antes como con contra cual cuando de del desde donde
+		durante e el ella ellas ellos en entre era erais eran eras eres es esa esas ese eso esos esta
+		estaba estado estamos estar estas este esto estos estoy fue fueron fui ha han has hasta hay la las
+		le les lo los me mi mis mucho muy más nada ni no nos nosotros o os otra otros para pero poco por
+		porque que quien se ser si sin sobre sois somos son soy su sus también te tengo ti tiene tu tus
+		un una uno unos vosotros y ya yo él`),
+	"fr": wordSet(`a au aux avec ce ces c'est dans de des du elle elles en est et eux il ils je j'ai la le
+		les leur leurs lui ma mais me mes moi mon même ne nos notre nous on ou où par pas pour qu que qui
+		sa se ses son sont sur ta te tes toi ton tu un une vos votre vous y été être avoir ai as avons
+		avez ont était très plus d l n s t`),
+}
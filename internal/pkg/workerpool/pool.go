@@ -10,13 +10,23 @@ import (
 type Job func(ctx context.Context)
 
 type WorkerPool struct {
+	ctx   context.Context
 	queue chan Job
 	wg    sync.WaitGroup
+
+	mu     sync.Mutex
+	timers map[*time.Timer]struct{}
+	closed bool
+	// Held by the scheduled jobs waiting for room in the queue, so the queue is
+	// closed once they are queued.
+	sending sync.RWMutex
 }
 
 func NewWorkerPool(ctx context.Context, workerCount int, queueSize int) *WorkerPool {
 	pool := &WorkerPool{
-		queue: make(chan Job, queueSize),
+		ctx:    ctx,
+		queue:  make(chan Job, queueSize),
+		timers: make(map[*time.Timer]struct{}),
 	}
 
 	for range workerCount {
@@ -53,8 +63,66 @@ func (p *WorkerPool) Submit(job Job) {
 	}
 }
 
+// Submits the job once the given time is reached.
+//
+// Unlike `Submit` the job waits for room in the queue rather than being dropped, until
+// the pool is shut down. The returned function cancels the job if it has not been
+// submitted yet.
+func (p *WorkerPool) SubmitAt(at time.Time, job Job) (cancel func() bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return func() bool { return false }
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(at), func() {
+		p.mu.Lock()
+		delete(p.timers, timer)
+		p.mu.Unlock()
+
+		p.sending.RLock()
+		defer p.sending.RUnlock()
+
+		// the shutdown waits on the jobs that saw the pool open
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return
+		}
+
+		select {
+		case p.queue <- job:
+		case <-p.ctx.Done():
+			log.Println("Worker pool stopped: scheduled job dropped")
+		}
+	})
+	p.timers[timer] = struct{}{}
+
+	return func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		delete(p.timers, timer)
+		return timer.Stop()
+	}
+}
+
 func (p *WorkerPool) Shutdown(ctx context.Context) {
+	p.mu.Lock()
+	p.closed = true
+	// scheduled jobs that did not fire yet are dropped
+	for timer := range p.timers {
+		timer.Stop()
+	}
+	p.timers = nil
+	p.mu.Unlock()
+
+	p.sending.Lock()
 	close(p.queue)
+	p.sending.Unlock()
 
 	done := make(chan struct{})
 
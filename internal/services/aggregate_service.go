@@ -0,0 +1,480 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/store"
+)
+
+// NOTE: the aggregates are running totals per question, added to by a hook of the
+// response store within the response transaction, so the dashboards read a row per
+// question rather than scanning the answers. The weight sums are kept next to the
+// counts so the mean, the standard deviation and the NPS are weighted like the
+// results, they are rebuilt once the weights are saved. They follow the survey
+// definition at the time each response is saved, `RebuildAggregates` recomputes them
+// from the answers once the questions or these definitions change.
+
+const (
+	aggregateColumns = "survey_id, question_id, answered, numeric_count, sum, sum_squares, min, max, promoters, passives, detractors, " +
+		"weight_sum, weight_squares, weighted_sum, weighted_sum_squares, weighted_promoters, weighted_passives, weighted_detractors, nps_weight_squares, value_counts, updated_at"
+
+	// Adds the aggregate to the stored one, the answer counts are summed key by key.
+	upsertAggregateQuery = `INSERT INTO survey_question_aggregates AS g (` + aggregateColumns + `)
+		VALUES (:survey_id, :question_id, :answered, :numeric_count, :sum, :sum_squares, :min, :max, :promoters, :passives, :detractors,
+			:weight_sum, :weight_squares, :weighted_sum, :weighted_sum_squares, :weighted_promoters, :weighted_passives, :weighted_detractors, :nps_weight_squares,
+			:value_counts, :updated_at)
+		ON CONFLICT (survey_id, question_id) DO UPDATE SET
+			answered = g.answered + excluded.answered,
+			numeric_count = g.numeric_count + excluded.numeric_count,
+			sum = g.sum + excluded.sum,
+			sum_squares = g.sum_squares + excluded.sum_squares,
+			min = LEAST(g.min, excluded.min),
+			max = GREATEST(g.max, excluded.max),
+			promoters = g.promoters + excluded.promoters,
+			passives = g.passives + excluded.passives,
+			detractors = g.detractors + excluded.detractors,
+			weight_sum = g.weight_sum + excluded.weight_sum,
+			weight_squares = g.weight_squares + excluded.weight_squares,
+			weighted_sum = g.weighted_sum + excluded.weighted_sum,
+			weighted_sum_squares = g.weighted_sum_squares + excluded.weighted_sum_squares,
+			weighted_promoters = g.weighted_promoters + excluded.weighted_promoters,
+			weighted_passives = g.weighted_passives + excluded.weighted_passives,
+			weighted_detractors = g.weighted_detractors + excluded.weighted_detractors,
+			nps_weight_squares = g.nps_weight_squares + excluded.nps_weight_squares,
+			value_counts = COALESCE((
+				SELECT jsonb_object_agg(k, COALESCE((g.value_counts ->> k)::int, 0) + COALESCE((excluded.value_counts ->> k)::int, 0))
+				FROM (SELECT jsonb_object_keys(g.value_counts) UNION SELECT jsonb_object_keys(excluded.value_counts)) AS keys(k)
+			), '{}'),
+			updated_at = excluded.updated_at`
+)
+
+// The running aggregates of the answers to a question.
+type QuestionAggregate struct {
+	QuestionID string
+	// The non null answers.
+	Answered int
+	// The answers to the rating and numeric questions read as numbers.
+	NumericCount int
+	Sum          float64
+	SumSquares   float64
+	Min          float64
+	Max          float64
+	// The sums of the weights, of their squares and of the weighted numeric answers,
+	// the counts and plain sums when unweighted.
+	WeightSum          float64
+	WeightSquares      float64
+	WeightedSum        float64
+	WeightedSumSquares float64
+	// The counts per answer of the choice and rating questions.
+	ValueCounts map[string]int
+	// The buckets of the 0-10 rating questions.
+	NPS NPS
+	// The sums of the weights of the NPS buckets and of their squares.
+	WeightedPromoters  float64
+	WeightedPassives   float64
+	WeightedDetractors float64
+	NPSWeightSquares   float64
+	UpdatedAt          time.Time
+}
+
+// The weighted mean of the numeric answers.
+func (a QuestionAggregate) Mean() float64 {
+	if a.WeightSum == 0 {
+		return 0
+	}
+
+	return a.WeightedSum / a.WeightSum
+}
+
+// The weighted standard deviation of the numeric answers, 0 for a single answer.
+//
+// It uses the reliability weights correction like the results, the sample standard
+// deviation when unweighted.
+func (a QuestionAggregate) StdDev() float64 {
+	if a.NumericCount < 2 || a.WeightSum == 0 {
+		return 0
+	}
+
+	denominator := a.WeightSum - a.WeightSquares/a.WeightSum
+	if denominator <= 0 {
+		return 0
+	}
+
+	variance := (a.WeightedSumSquares - a.WeightedSum*a.WeightedSum/a.WeightSum) / denominator
+
+	// rounding errors on constant answers
+	return math.Sqrt(math.Max(variance, 0))
+}
+
+// The weighted NPS out of the buckets, see `ComputeNPS`.
+func (a QuestionAggregate) NPSResult(options NPSOptions) NPSResult {
+	result := NPSResult{NPS: a.NPS, Invalid: a.Answered - a.NPS.TotalSurvey}
+	result.WeightedPromoters = a.WeightedPromoters
+	result.WeightedPassives = a.WeightedPassives
+	result.WeightedDetractors = a.WeightedDetractors
+	result.WeightedTotal = a.WeightedPromoters + a.WeightedPassives + a.WeightedDetractors
+	if a.NPSWeightSquares > 0 {
+		result.EffectiveSampleSize = result.WeightedTotal * result.WeightedTotal / a.NPSWeightSquares
+	}
+
+	result.finish(options)
+	return result
+}
+
+// Handles the running aggregates of the survey questions.
+type AggregateService interface {
+	// The aggregates of the questions answered at least once, keyed by question ID.
+	GetAggregates(surveyID string) (map[string]QuestionAggregate, error)
+	// The aggregates over the responses matching the filter expression, see
+	// `CompileResponseFilter`, computed from the answers rather than the running totals.
+	GetFilteredAggregates(surveyID string, filter string) (map[string]QuestionAggregate, error)
+	// Recomputes the aggregates of the survey from its answers.
+	RebuildAggregates(surveyID string) error
+	// Recomputes the aggregates of every survey.
+	RebuildAllAggregates() error
+}
+
+type aggregateServiceImpl struct {
+	surveyservice SurveyService
+	aggregates    store.Datastorer[models.QuestionAggregate]
+}
+
+// Instantiate the `AggregateService`.
+//
+// The aggregates are updated by a hook of the response store so they share the response
+// transaction, and rebuilt once the weights are saved through the response service.
+func NewAggregateService(surveyservice SurveyService, responseservice SurveyResponseService, responses store.Datastorer[models.SurveyResponse], aggregates store.Datastorer[models.QuestionAggregate]) AggregateService {
+	s := &aggregateServiceImpl{surveyservice: surveyservice, aggregates: aggregates}
+
+	if responseservice != nil {
+		responseservice.SubscribeWeightsSaved(func(ctx context.Context, surveyID string) {
+			if err := s.RebuildAggregates(surveyID); err != nil {
+				log.Printf("Cannot rebuild the aggregates of survey %s on its weights: %v", surveyID, err)
+			}
+		})
+	}
+
+	if responses != nil {
+		responses.SetHooks(store.Hooks{
+			PostSave: []func(ctx context.Context, tx *sqlx.Tx, data store.DTO, model any, isNew bool) error{
+				s.updateAggregates,
+			},
+		})
+	}
+
+	return s
+}
+
+// Adds the answers of the new response to the aggregates.
+func (s *aggregateServiceImpl) updateAggregates(ctx context.Context, tx *sqlx.Tx, data store.DTO, model any, isNew bool) error {
+	dto, ok := data.(*models.SurveyResponseDTO)
+	if !ok || !isNew {
+		return nil
+	}
+
+	survey, err := s.surveyservice.GetSurvey(dto.SurveyID)
+	if err != nil {
+		return err
+	}
+
+	response, err := responseFromDTO(dto)
+	if err != nil {
+		return err
+	}
+
+	aggregator := newAggregator(*survey)
+	for _, answer := range response.Answers {
+		aggregator.add(answer, response.weight())
+	}
+
+	return saveAggregates(ctx, tx, aggregator.rows(now()))
+}
+
+func saveAggregates(ctx context.Context, tx *sqlx.Tx, rows []models.QuestionAggregate) error {
+	for _, row := range rows {
+		if _, err := tx.NamedExecContext(ctx, upsertAggregateQuery, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *aggregateServiceImpl) GetAggregates(surveyID string) (map[string]QuestionAggregate, error) {
+	id, err := strconv.Atoi(surveyID)
+	if err != nil {
+		return nil, fault.ErrNotFound
+	}
+
+	rows, err := s.aggregates.Select(context.Background(), fmt.Sprintf("SELECT %s FROM survey_question_aggregates WHERE survey_id = $1", aggregateColumns), id)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregates := make(map[string]QuestionAggregate, len(rows))
+	for _, row := range rows {
+		aggregates[row.QuestionID] = aggregateFromModel(row)
+	}
+
+	return aggregates, nil
+}
+
+func (s *aggregateServiceImpl) GetFilteredAggregates(surveyID string, expression string) (map[string]QuestionAggregate, error) {
+	survey, err := s.surveyservice.GetSurvey(surveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := CompileResponseFilter(*survey, expression)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		return s.GetAggregates(survey.ID)
+	}
+
+	id, err := strconv.Atoi(survey.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid survey id %q: %w", survey.ID, err)
+	}
+
+	aggregator := newAggregator(*survey)
+
+	err = streamResponses(context.Background(), s.aggregates.Base(), id, time.Time{}, time.Time{}, filter, func(response SurveyResponse) error {
+		for _, answer := range response.Answers {
+			aggregator.add(answer, response.weight())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := aggregator.rows(now())
+	aggregates := make(map[string]QuestionAggregate, len(rows))
+	for _, row := range rows {
+		aggregates[row.QuestionID] = aggregateFromModel(row)
+	}
+
+	return aggregates, nil
+}
+
+func (s *aggregateServiceImpl) RebuildAggregates(surveyID string) (err error) {
+	survey, err := s.surveyservice.GetSurvey(surveyID)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(survey.ID)
+	if err != nil {
+		return fmt.Errorf("invalid survey id %q: %w", survey.ID, err)
+	}
+
+	ctx := context.Background()
+
+	tx, err := s.aggregates.Base().BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// the responses saved meanwhile wait on the deleted rows, then add to the rebuilt ones
+	if _, err = tx.ExecContext(ctx, "DELETE FROM survey_question_aggregates WHERE survey_id = $1", id); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryxContext(ctx, `SELECT a.response_id, a.question_id, a.value, r.weight
+		FROM survey_answers a JOIN survey_responses r ON r.id = a.response_id WHERE r.survey_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	aggregator := newAggregator(*survey)
+
+	for rows.Next() {
+		var row struct {
+			models.Answer
+			Weight float64 `db:"weight"`
+		}
+		if err = rows.StructScan(&row); err != nil {
+			rows.Close()
+			return err
+		}
+
+		var value any
+		if len(row.Value) > 0 {
+			if err = json.Unmarshal(row.Value, &value); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+
+		aggregator.add(Answer{QuestionID: row.QuestionID, Value: value}, row.Weight)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if err = saveAggregates(ctx, tx, aggregator.rows(now())); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *aggregateServiceImpl) RebuildAllAggregates() error {
+	var ids []int
+	if err := s.aggregates.Base().SelectContext(context.Background(), &ids, "SELECT id FROM surveys ORDER BY id"); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := s.RebuildAggregates(strconv.Itoa(id)); err != nil {
+			return fmt.Errorf("survey %d: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+// Folds the answers into the aggregates of the survey questions.
+type aggregator struct {
+	survey     Survey
+	aggregates map[string]*models.QuestionAggregate
+}
+
+func newAggregator(survey Survey) *aggregator {
+	return &aggregator{survey: survey, aggregates: make(map[string]*models.QuestionAggregate)}
+}
+
+// Counts the answer of a response of the given weight, the answers to unknown
+// questions and the null answers are skipped.
+func (a *aggregator) add(answer Answer, weight float64) {
+	question, ok := a.survey.Questions[answer.QuestionID]
+	if !ok || answer.Value == nil {
+		return
+	}
+
+	aggregate, ok := a.aggregates[question.ID]
+	if !ok {
+		aggregate = &models.QuestionAggregate{SurveyID: a.survey.ID, QuestionID: question.ID, ValueCounts: models.ValueCounts{}}
+		a.aggregates[question.ID] = aggregate
+	}
+
+	aggregate.Answered++
+
+	switch question.Type {
+	case MultipleChoice:
+		aggregate.ValueCounts[fmt.Sprint(answer.Value)]++
+	case Rating, Numeric:
+		value, ok := numericValue(answer.Value)
+		if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+			return
+		}
+
+		aggregate.NumericCount++
+		aggregate.Sum += value
+		aggregate.SumSquares += value * value
+		aggregate.WeightSum += weight
+		aggregate.WeightSquares += weight * weight
+		aggregate.WeightedSum += weight * value
+		aggregate.WeightedSumSquares += weight * value * value
+		if aggregate.Min == nil || value < *aggregate.Min {
+			aggregate.Min = &value
+		}
+		if aggregate.Max == nil || value > *aggregate.Max {
+			aggregate.Max = &value
+		}
+
+		if question.Type != Rating {
+			return
+		}
+
+		aggregate.ValueCounts[strconv.FormatFloat(value, 'f', -1, 64)]++
+
+		if min, max, err := question.ScaleBounds(); err == nil && min == 0 && max == 10 {
+			category, ok := ClassifyNPS(value)
+			if !ok {
+				return
+			}
+
+			switch category {
+			case Promoter:
+				aggregate.Promoters++
+				aggregate.WeightedPromoters += weight
+			case Passive:
+				aggregate.Passives++
+				aggregate.WeightedPassives += weight
+			case Detractor:
+				aggregate.Detractors++
+				aggregate.WeightedDetractors += weight
+			}
+			aggregate.NPSWeightSquares += weight * weight
+		}
+	}
+}
+
+// The aggregates sorted by question ID.
+func (a *aggregator) rows(updatedAt time.Time) []models.QuestionAggregate {
+	rows := make([]models.QuestionAggregate, 0, len(a.aggregates))
+	for _, aggregate := range a.aggregates {
+		aggregate.UpdatedAt = updatedAt
+		rows = append(rows, *aggregate)
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].QuestionID < rows[j].QuestionID })
+	return rows
+}
+
+func aggregateFromModel(model models.QuestionAggregate) QuestionAggregate {
+	aggregate := QuestionAggregate{
+		QuestionID:         model.QuestionID,
+		Answered:           model.Answered,
+		NumericCount:       model.NumericCount,
+		Sum:                model.Sum,
+		SumSquares:         model.SumSquares,
+		WeightSum:          model.WeightSum,
+		WeightSquares:      model.WeightSquares,
+		WeightedSum:        model.WeightedSum,
+		WeightedSumSquares: model.WeightedSumSquares,
+		ValueCounts:        model.ValueCounts,
+		NPS: NPS{
+			Promoters:   model.Promoters,
+			Passives:    model.Passives,
+			Detractors:  model.Detractors,
+			TotalSurvey: model.Promoters + model.Passives + model.Detractors,
+		},
+		WeightedPromoters:  model.WeightedPromoters,
+		WeightedPassives:   model.WeightedPassives,
+		WeightedDetractors: model.WeightedDetractors,
+		NPSWeightSquares:   model.NPSWeightSquares,
+		UpdatedAt:          model.UpdatedAt,
+	}
+
+	if model.Min != nil {
+		aggregate.Min = *model.Min
+	}
+	if model.Max != nil {
+		aggregate.Max = *model.Max
+	}
+
+	return aggregate
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	survey := Survey{
+		ID: "1",
+		Questions: map[string]Question{
+			"nps":   {ID: "nps", Type: Rating, Options: RatingScale(0, 10)},
+			"plan":  {ID: "plan", Type: MultipleChoice, Options: []string{"free", "pro"}},
+			"age":   {ID: "age", Type: Numeric},
+			"why":   {ID: "why", Type: Text},
+			"score": {ID: "score", Type: Rating, Options: RatingScale(1, 5)},
+		},
+	}
+
+	aggregator := newAggregator(survey)
+	for _, answer := range []Answer{
+		{QuestionID: "nps", Value: 10.0},
+		{QuestionID: "nps", Value: "9"},
+		{QuestionID: "nps", Value: 7.0},
+		{QuestionID: "nps", Value: 2.0},
+		{QuestionID: "plan", Value: "pro"},
+		{QuestionID: "plan", Value: "pro"},
+		{QuestionID: "age", Value: 20.0},
+		{QuestionID: "age", Value: 40.0},
+		{QuestionID: "age", Value: "n/a"},
+		{QuestionID: "why", Value: "fast"},
+		{QuestionID: "why", Value: nil},
+		{QuestionID: "score", Value: 5.0},
+		{QuestionID: "unknown", Value: 1.0},
+	} {
+		aggregator.add(answer, 1)
+	}
+
+	updatedAt := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	rows := aggregator.rows(updatedAt)
+	if len(rows) != 5 || rows[0].QuestionID != "age" || !rows[0].UpdatedAt.Equal(updatedAt) || rows[0].SurveyID != "1" {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+
+	aggregates := make(map[string]QuestionAggregate)
+	for _, row := range rows {
+		aggregates[row.QuestionID] = aggregateFromModel(row)
+	}
+
+	nps := aggregates["nps"]
+	if nps.Answered != 4 || nps.NPS.Promoters != 2 || nps.NPS.Passives != 1 || nps.NPS.Detractors != 1 || nps.ValueCounts["9"] != 1 {
+		t.Errorf("unexpected nps aggregate %+v", nps)
+	}
+	if result := nps.NPSResult(NPSOptions{}); result.Score != 25 || result.Invalid != 0 {
+		t.Errorf("unexpected nps result %+v", result)
+	}
+
+	if plan := aggregates["plan"]; plan.Answered != 2 || plan.ValueCounts["pro"] != 2 || plan.NumericCount != 0 {
+		t.Errorf("unexpected plan aggregate %+v", plan)
+	}
+
+	age := aggregates["age"]
+	if age.Answered != 3 || age.NumericCount != 2 || age.Mean() != 30 || math.Abs(age.StdDev()-math.Sqrt(200)) > 1e-9 || age.Min != 20 || age.Max != 40 {
+		t.Errorf("unexpected age aggregate %+v", age)
+	}
+
+	if why := aggregates["why"]; why.Answered != 1 || len(why.ValueCounts) != 0 {
+		t.Errorf("unexpected text aggregate %+v", why)
+	}
+
+	// not a 0-10 scale, no buckets
+	if score := aggregates["score"]; score.NPS.TotalSurvey != 0 || score.ValueCounts["5"] != 1 || score.StdDev() != 0 {
+		t.Errorf("unexpected score aggregate %+v", score)
+	}
+}
+
+func TestAggregator_Weighted(t *testing.T) {
+	survey := Survey{
+		ID: "1",
+		Questions: map[string]Question{
+			"nps": {ID: "nps", Type: Rating, Options: RatingScale(0, 10)},
+			"age": {ID: "age", Type: Numeric},
+		},
+	}
+
+	responses := []SurveyResponse{
+		{Weight: 3, Answers: []Answer{{QuestionID: "nps", Value: 10.0}, {QuestionID: "age", Value: 20.0}}},
+		{Weight: 1, Answers: []Answer{{QuestionID: "nps", Value: 0.0}, {QuestionID: "age", Value: 40.0}}},
+	}
+
+	aggregator := newAggregator(survey)
+	for _, response := range responses {
+		for _, answer := range response.Answers {
+			aggregator.add(answer, response.weight())
+		}
+	}
+
+	aggregates := make(map[string]QuestionAggregate)
+	for _, row := range aggregator.rows(now()) {
+		aggregates[row.QuestionID] = aggregateFromModel(row)
+	}
+
+	// (3 * 20 + 40) / 4, the weighted variance 300 / (4 - 10 / 4)
+	age := aggregates["age"]
+	if age.NumericCount != 2 || age.Mean() != 25 || math.Abs(age.StdDev()-math.Sqrt(200)) > 1e-9 {
+		t.Errorf("unexpected weighted age aggregate %+v, mean %v, standard deviation %v", age, age.Mean(), age.StdDev())
+	}
+
+	want := ComputeNPS(responses, "nps", NPSOptions{Precision: 1})
+	got := aggregates["nps"].NPSResult(NPSOptions{Precision: 1})
+	if got.Score != 50 || got.Score != want.Score || got.WeightedTotal != want.WeightedTotal || math.Abs(got.EffectiveSampleSize-want.EffectiveSampleSize) > 1e-9 {
+		t.Errorf("expected the weighted nps of the responses %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/paulexconde/justasking/internal/pkg/spss"
+)
+
+// NOTE: the codebook is built from the same columns and SPSS variables as the
+// exports, read with the same layout, so it always describes the files exported
+// alongside it. The routing lists the conditionals leading to each question, the
+// way the respondents are routed; the `Next` entries are not routed on.
+
+// The format of the rendered codebook.
+type CodebookFormat int
+
+const (
+	CodebookJSON CodebookFormat = iota + 1
+	CodebookMarkdown
+	CodebookHTML
+)
+
+var codebookFormatNames = map[CodebookFormat]string{
+	CodebookJSON:     "json",
+	CodebookMarkdown: "markdown",
+	CodebookHTML:     "html",
+}
+
+func (f CodebookFormat) String() string {
+	if name, ok := codebookFormatNames[f]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("CodebookFormat(%d)", int(f))
+}
+
+// Parses the name of the codebook format e.g. "markdown".
+func ParseCodebookFormat(name string) (CodebookFormat, error) {
+	for f, n := range codebookFormatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown codebook format %q", name)
+}
+
+// The data dictionary of the exports of a survey.
+type Codebook struct {
+	SurveyID  string             `json:"survey_id"`
+	Title     string             `json:"title"`
+	Variables []CodebookVariable `json:"variables"`
+}
+
+// A column of the exports.
+type CodebookVariable struct {
+	// The column of the CSV export.
+	Name string `json:"name"`
+	// The variable of the SPSS export, the name made valid for SPSS.
+	SPSSName string `json:"spss_name"`
+	Label    string `json:"label"`
+	// One of "string", "numeric" or "datetime".
+	Type string `json:"type"`
+	// The width in bytes of the string variables.
+	Width        int    `json:"width,omitempty"`
+	Measure      string `json:"measure"`
+	QuestionID   string `json:"question_id,omitempty"`
+	QuestionType string `json:"question_type,omitempty"`
+	HiddenField  string `json:"hidden_field,omitempty"`
+	// How the variable is derived, empty for the answers and the stored fields.
+	Computed string         `json:"computed,omitempty"`
+	Codes    []CodebookCode `json:"codes,omitempty"`
+	// Who is asked the question, nil for the variables that are not answers.
+	Routing *CodebookRouting `json:"routing,omitempty"`
+}
+
+// A value label of a coded variable.
+type CodebookCode struct {
+	Value float64 `json:"value"`
+	Label string  `json:"label"`
+	// Whether the code is a user-missing value e.g. `SPSSNotAsked`.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// The respondents shown the question.
+type CodebookRouting struct {
+	// Everyone is shown the start question.
+	Start bool `json:"start,omitempty"`
+	// No path from the start question leads to the question.
+	Unreachable bool `json:"unreachable,omitempty"`
+	// The conditionals leading to the question, any of them.
+	From []CodebookRoute `json:"from,omitempty"`
+}
+
+// A conditional leading to a question.
+type CodebookRoute struct {
+	QuestionID string `json:"question_id"`
+	Expression string `json:"expression"`
+	// The 1-based position of the conditional, the earlier ones taking precedence.
+	Position int `json:"position"`
+}
+
+func newCodebook(survey Survey, layout exportLayout) Codebook {
+	columns := ExportColumns(survey, layout.HiddenFields)
+	variables := SPSSVariables(survey, columns, layout.Widths)
+
+	unreachable := make(map[string]bool)
+	for _, id := range survey.UnreachableQuestionIDs() {
+		unreachable[id] = true
+	}
+
+	routes := make(map[string][]CodebookRoute)
+	for _, id := range survey.OrderedQuestionIDs() {
+		for i, conditional := range survey.Questions[id].Conditionals {
+			routes[conditional.NextID] = append(routes[conditional.NextID], CodebookRoute{QuestionID: id, Expression: conditional.Expression, Position: i + 1})
+		}
+	}
+
+	codebook := Codebook{SurveyID: survey.ID, Title: survey.Title, Variables: make([]CodebookVariable, len(columns))}
+
+	for i, column := range columns {
+		variable := variables[i]
+
+		entry := CodebookVariable{
+			Name:        column.Name,
+			SPSSName:    variable.Name,
+			Label:       column.Label,
+			Type:        "numeric",
+			Measure:     variable.Measure.String(),
+			QuestionID:  column.QuestionID,
+			HiddenField: column.HiddenField,
+		}
+
+		switch {
+		case variable.Width > 0:
+			entry.Type, entry.Width = "string", variable.Width
+		case variable.Format == spss.FormatDateTime:
+			entry.Type = "datetime"
+		}
+
+		for _, label := range variable.ValueLabels {
+			missing := false
+			for _, value := range variable.MissingValues {
+				missing = missing || value == label.Value
+			}
+			entry.Codes = append(entry.Codes, CodebookCode{Value: label.Value, Label: label.Label, Missing: missing})
+		}
+
+		switch column.Name {
+		case ExportCompleted:
+			entry.Computed = "1 when the answers reach an ending following the routing, 0 otherwise"
+		case ExportWeight:
+			entry.Computed = "The survey weight of the response, 1 when unweighted"
+		}
+
+		if column.QuestionID != "" {
+			entry.QuestionType = survey.Questions[column.QuestionID].Type.String()
+			entry.Routing = &CodebookRouting{
+				Start:       column.QuestionID == survey.StartID,
+				Unreachable: unreachable[column.QuestionID],
+				From:        routes[column.QuestionID],
+			}
+		}
+		if column.Option != "" {
+			entry.Computed = fmt.Sprintf("The rank given to %q, missing when not ranked", column.Option)
+		}
+
+		codebook.Variables[i] = entry
+	}
+
+	return codebook
+}
+
+// Renders the codebook as JSON or as a document.
+func RenderCodebook(codebook Codebook, format CodebookFormat) (string, error) {
+	switch format {
+	case CodebookJSON:
+		b, err := json.MarshalIndent(codebook, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b) + "\n", nil
+	case CodebookMarkdown:
+		return codebook.markdown(), nil
+	case CodebookHTML:
+		return codebook.html(), nil
+	default:
+		return "", fmt.Errorf("unknown codebook format %d", format)
+	}
+}
+
+// The type of the variable as shown in the documents e.g. "string(12)".
+func (v CodebookVariable) typeName() string {
+	if v.Type == "string" {
+		return fmt.Sprintf("string(%d)", v.Width)
+	}
+
+	return v.Type
+}
+
+// The sentences telling who is asked the question, code formats the expressions
+// and the question IDs.
+func (r CodebookRouting) describe(code func(string) string) []string {
+	var lines []string
+
+	if r.Start {
+		lines = append(lines, "Everyone, first question")
+	}
+	if r.Unreachable {
+		lines = append(lines, "No one, no path leads to the question")
+	}
+
+	for _, route := range r.From {
+		lines = append(lines, fmt.Sprintf("After %s when %s (conditional %d)", code(route.QuestionID), code(route.Expression), route.Position))
+	}
+
+	return lines
+}
+
+func formatCode(code CodebookCode) string {
+	if code.Missing {
+		return formatNumber(code.Value) + " (missing)"
+	}
+
+	return formatNumber(code.Value)
+}
+
+func (c Codebook) markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Codebook: %s\n\n", markdownText(c.Title))
+	b.WriteString("| Variable | SPSS name | Type | Label |\n|---|---|---|---|\n")
+	for _, v := range c.Variables {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", markdownCell(v.Name), markdownCell(v.SPSSName), v.typeName(), markdownCell(v.Label))
+	}
+
+	code := func(s string) string {
+		return "`` " + strings.ReplaceAll(s, "\n", " ") + " ``"
+	}
+
+	for _, v := range c.Variables {
+		fmt.Fprintf(&b, "\n## %s\n\n%s\n\n", markdownText(v.Name), markdownText(v.Label))
+		fmt.Fprintf(&b, "- Type: %s, %s\n", v.typeName(), v.Measure)
+		if v.SPSSName != v.Name {
+			fmt.Fprintf(&b, "- SPSS name: %s\n", markdownText(v.SPSSName))
+		}
+		if v.QuestionID != "" {
+			fmt.Fprintf(&b, "- Question: %s, %s\n", code(v.QuestionID), v.QuestionType)
+		}
+		if v.HiddenField != "" {
+			fmt.Fprintf(&b, "- Hidden field: %s\n", code(v.HiddenField))
+		}
+		if v.Computed != "" {
+			fmt.Fprintf(&b, "- Computed: %s\n", markdownText(v.Computed))
+		}
+		if v.Routing != nil {
+			b.WriteString("- Asked:\n")
+			for _, line := range v.Routing.describe(code) {
+				fmt.Fprintf(&b, "  - %s\n", line)
+			}
+		}
+
+		if len(v.Codes) > 0 {
+			b.WriteString("\n| Code | Label |\n|---|---|\n")
+			for _, c := range v.Codes {
+				fmt.Fprintf(&b, "| %s | %s |\n", formatCode(c), markdownCell(c.Label))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "#", `\#`, "<", "&lt;", "\n", " ")
+
+func markdownText(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+func markdownCell(s string) string {
+	return strings.ReplaceAll(markdownText(s), "|", `\|`)
+}
+
+func (c Codebook) html() string {
+	var b strings.Builder
+
+	title := html.EscapeString("Codebook: " + c.Title)
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n", title, title)
+
+	b.WriteString("<table>\n<tr><th>Variable</th><th>SPSS name</th><th>Type</th><th>Label</th></tr>\n")
+	for _, v := range c.Variables {
+		fmt.Fprintf(&b, "<tr><td><a href=\"#%s\">%s</a></td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			html.EscapeString(v.Name), html.EscapeString(v.Name), html.EscapeString(v.SPSSName), v.typeName(), html.EscapeString(v.Label))
+	}
+	b.WriteString("</table>\n")
+
+	code := func(s string) string {
+		return "<code>" + html.EscapeString(s) + "</code>"
+	}
+
+	for _, v := range c.Variables {
+		fmt.Fprintf(&b, "<h2 id=\"%s\">%s</h2>\n<p>%s</p>\n<ul>\n", html.EscapeString(v.Name), html.EscapeString(v.Name), html.EscapeString(v.Label))
+		fmt.Fprintf(&b, "<li>Type: %s, %s</li>\n", v.typeName(), v.Measure)
+		if v.SPSSName != v.Name {
+			fmt.Fprintf(&b, "<li>SPSS name: %s</li>\n", html.EscapeString(v.SPSSName))
+		}
+		if v.QuestionID != "" {
+			fmt.Fprintf(&b, "<li>Question: %s, %s</li>\n", code(v.QuestionID), v.QuestionType)
+		}
+		if v.HiddenField != "" {
+			fmt.Fprintf(&b, "<li>Hidden field: %s</li>\n", code(v.HiddenField))
+		}
+		if v.Computed != "" {
+			fmt.Fprintf(&b, "<li>Computed: %s</li>\n", html.EscapeString(v.Computed))
+		}
+		if v.Routing != nil {
+			b.WriteString("<li>Asked:<ul>\n")
+			for _, line := range v.Routing.describe(code) {
+				fmt.Fprintf(&b, "<li>%s</li>\n", line)
+			}
+			b.WriteString("</ul></li>\n")
+		}
+		b.WriteString("</ul>\n")
+
+		if len(v.Codes) > 0 {
+			b.WriteString("<table>\n<tr><th>Code</th><th>Label</th></tr>\n")
+			for _, c := range v.Codes {
+				fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td></tr>\n", formatCode(c), html.EscapeString(c.Label))
+			}
+			b.WriteString("</table>\n")
+		}
+	}
+
+	b.WriteString("</body>\n</html>\n")
+
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCodebook(t *testing.T) {
+	survey := exportSurvey()
+	survey.Title = "Plans <2025>"
+
+	codebook := newCodebook(survey, exportLayout{HiddenFields: []string{"utm source"}, Widths: map[string]int{"why": 40}})
+
+	names := make([]string, len(codebook.Variables))
+	for i, variable := range codebook.Variables {
+		names[i] = variable.Name
+	}
+	if got := strings.Join(names, ","); got != "response_id,created_at,completed,weight,hidden_utm source,plan,rank_1,rank_2,rank_3,score,why" {
+		t.Fatalf("expected the export columns, got %s", got)
+	}
+
+	byName := make(map[string]CodebookVariable)
+	for _, variable := range codebook.Variables {
+		byName[variable.Name] = variable
+	}
+
+	if hidden := byName["hidden_utm source"]; hidden.SPSSName != "hidden_utm_source" || hidden.Type != "string" {
+		t.Errorf("unexpected hidden field %+v", hidden)
+	}
+
+	plan := byName["plan"]
+	if !plan.Routing.Start || plan.QuestionType != "multiple_choice" || len(plan.Codes) != 4 || plan.Codes[0].Label != "free" || plan.Codes[0].Missing || !plan.Codes[2].Missing {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+
+	rank := byName["rank_2"]
+	if rank.Computed == "" || len(rank.Routing.From) != 1 || rank.Routing.From[0] != (CodebookRoute{QuestionID: "plan", Expression: `plan == "pro"`, Position: 1}) {
+		t.Errorf("unexpected rank %+v", rank)
+	}
+
+	why := byName["why"]
+	if why.Width != 40 || why.Routing.Start || len(why.Routing.From) != 1 || why.Routing.From[0].Position != 2 {
+		t.Errorf("unexpected why %+v", why)
+	}
+
+	if byName["completed"].Computed == "" || byName["completed"].Routing != nil {
+		t.Errorf("expected completed to be computed")
+	}
+}
+
+func TestRenderCodebook(t *testing.T) {
+	survey := exportSurvey()
+	survey.Title = "Plans <2025>"
+	codebook := newCodebook(survey, exportLayout{})
+
+	out, err := RenderCodebook(codebook, CodebookJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded Codebook
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil || len(decoded.Variables) != len(codebook.Variables) {
+		t.Errorf("unexpected json %v %s", err, out)
+	}
+
+	out, err = RenderCodebook(codebook, CodebookMarkdown)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "| rank\\_1 | rank\\_1 | numeric | Rank the features: speed |") || !strings.Contains(out, "After `` plan `` when `` plan == \"pro\" `` (conditional 1)") {
+		t.Errorf("unexpected markdown:\n%s", out)
+	}
+
+	out, err = RenderCodebook(codebook, CodebookHTML)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "<h1>Codebook: Plans &lt;2025&gt;</h1>") || !strings.Contains(out, "After <code>score</code> when <code>true</code> (conditional 2)") {
+		t.Errorf("unexpected html:\n%s", out)
+	}
+
+	if _, err := ParseCodebookFormat("pdf"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NOTE: the cells differing significantly are found with the adjusted standardized
+// residuals (O - E) / sqrt(E * (1 - row total / N) * (1 - column total / N)), they
+// follow a standard normal distribution when rows and columns are independent.
+// With weighted responses the statistics are computed over the weighted counts and
+// divided by the design effect, a first order Rao-Scott correction.
+
+// What the responses are broken down by, either a question or a hidden field.
+type Dimension struct {
+	QuestionID  string
+	HiddenField string
+	// Groups the values e.g. ages into age groups, the value is skipped when false.
+	// The value itself is the label when nil.
+	Group func(value any) (string, bool)
+	// The labels in order, the labels out of it are skipped. The labels found are
+	// sorted when empty, numbers by their value.
+	Levels []string
+}
+
+// Groups the 0-10 ratings into promoters, passives and detractors.
+func NPSGroup(value any) (string, bool) {
+	category, ok := ClassifyNPS(value)
+	if !ok {
+		return "", false
+	}
+
+	return category.String(), true
+}
+
+// The name of the dimension, the question ID or the hidden field.
+func (d Dimension) Name() string {
+	if d.HiddenField != "" {
+		return d.HiddenField
+	}
+
+	return d.QuestionID
+}
+
+func (d Dimension) label(response SurveyResponse) (string, bool) {
+	var value any
+
+	if d.HiddenField != "" {
+		field, ok := response.HiddenFields[d.HiddenField]
+		if !ok {
+			return "", false
+		}
+		value = field
+	} else {
+		answer, ok := response.answer(d.QuestionID)
+		if !ok || answer.Value == nil {
+			return "", false
+		}
+		value = answer.Value
+	}
+
+	label := fmt.Sprint(value)
+	if d.Group != nil {
+		var ok bool
+		if label, ok = d.Group(value); !ok {
+			return "", false
+		}
+	}
+
+	if len(d.Levels) > 0 && !slices.Contains(d.Levels, label) {
+		return "", false
+	}
+
+	return label, true
+}
+
+// Orders the labels of the dimension.
+func (d Dimension) less(a, b string) bool {
+	if len(d.Levels) > 0 {
+		return slices.Index(d.Levels, a) < slices.Index(d.Levels, b)
+	}
+
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if errX == nil && errY == nil {
+		return x < y
+	}
+
+	return a < b
+}
+
+// A cell of the cross-tabulation.
+type CrossTabCell struct {
+	Count int
+	// The sum of the weights of the responses, the count when unweighted.
+	Weighted      float64
+	RowPercent    float64
+	ColumnPercent float64
+	TotalPercent  float64
+	// The count expected when rows and columns are independent.
+	Expected float64
+	// The adjusted standardized residual, positive when over-represented.
+	Residual float64
+	// The count differs significantly from the expected count.
+	Significant bool
+}
+
+// The responses broken down by the row dimensions against the column dimensions.
+type CrossTab struct {
+	// The labels of the combined dimensions, e.g. "north × 18-34".
+	Rows    []string
+	Columns []string
+	// Indexed by row then column.
+	Cells        [][]CrossTabCell
+	RowTotals    []int
+	ColumnTotals []int
+	// The responses with a label on every dimension.
+	Total int
+	// The weighted totals, the percentages and the statistics are computed from.
+	WeightedRowTotals    []float64
+	WeightedColumnTotals []float64
+	WeightedTotal        float64
+	// The variance inflation due to the weighting, 1 when unweighted.
+	DesignEffect float64
+
+	ChiSquare        float64
+	DegreesOfFreedom int
+	PValue           float64
+	Level            float64
+	Significant      bool
+	// More than 20% of the expected counts are below 5, the chi-square is unreliable.
+	LowExpected bool
+}
+
+// The separator of the combined dimension labels.
+const crossTabSeparator = " × "
+
+// Breaks the responses down by the rows against the columns.
+//
+// Several dimensions on a side are combined e.g. region × age group, responses
+// without a label on every dimension are left out. Zero level defaults to 95%.
+func CrossTabulate(responses []SurveyResponse, rows, columns []Dimension, level float64) (*CrossTab, error) {
+	if len(rows) == 0 || len(columns) == 0 {
+		return nil, errors.New("cross-tabulation needs at least a row and a column dimension")
+	}
+
+	if level == 0 {
+		level = Confidence95
+	}
+	z, err := confidenceZ(level)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[[2]string]int)
+	weights := make(map[[2]string]float64)
+	var squares float64
+	rowParts := make(map[string][]string)
+	columnParts := make(map[string][]string)
+
+	for _, response := range responses {
+		row, rowOK := combinedLabel(response, rows, rowParts)
+		column, columnOK := combinedLabel(response, columns, columnParts)
+		if !rowOK || !columnOK {
+			continue
+		}
+
+		counts[[2]string{row, column}]++
+		weights[[2]string{row, column}] += response.weight()
+		squares += response.weight() * response.weight()
+	}
+
+	tab := &CrossTab{
+		Rows:         sortedLabels(rows, rowParts),
+		Columns:      sortedLabels(columns, columnParts),
+		Level:        level,
+		PValue:       1,
+		DesignEffect: 1,
+	}
+
+	tab.Cells = make([][]CrossTabCell, len(tab.Rows))
+	tab.RowTotals = make([]int, len(tab.Rows))
+	tab.ColumnTotals = make([]int, len(tab.Columns))
+	tab.WeightedRowTotals = make([]float64, len(tab.Rows))
+	tab.WeightedColumnTotals = make([]float64, len(tab.Columns))
+
+	for i, row := range tab.Rows {
+		tab.Cells[i] = make([]CrossTabCell, len(tab.Columns))
+		for j, column := range tab.Columns {
+			count := counts[[2]string{row, column}]
+			weight := weights[[2]string{row, column}]
+			tab.Cells[i][j].Count = count
+			tab.Cells[i][j].Weighted = weight
+			tab.RowTotals[i] += count
+			tab.ColumnTotals[j] += count
+			tab.Total += count
+			tab.WeightedRowTotals[i] += weight
+			tab.WeightedColumnTotals[j] += weight
+			tab.WeightedTotal += weight
+		}
+	}
+
+	if tab.Total == 0 || tab.WeightedTotal == 0 {
+		return tab, nil
+	}
+
+	// n Σw² / (Σw)², the statistics are brought back to the scale of the sample first
+	tab.DesignEffect = float64(tab.Total) * squares / (tab.WeightedTotal * tab.WeightedTotal)
+	scale := float64(tab.Total) / tab.WeightedTotal / tab.DesignEffect
+
+	total := tab.WeightedTotal
+	var low, cells int
+
+	for i := range tab.Rows {
+		for j := range tab.Columns {
+			cell := &tab.Cells[i][j]
+			rowTotal, columnTotal := tab.WeightedRowTotals[i], tab.WeightedColumnTotals[j]
+
+			if rowTotal > 0 {
+				cell.RowPercent = cell.Weighted / rowTotal * 100
+			}
+			if columnTotal > 0 {
+				cell.ColumnPercent = cell.Weighted / columnTotal * 100
+			}
+			cell.TotalPercent = cell.Weighted / total * 100
+
+			cell.Expected = rowTotal * columnTotal / total
+			if cell.Expected == 0 {
+				continue
+			}
+
+			cells++
+			if cell.Expected < 5 {
+				low++
+			}
+
+			tab.ChiSquare += math.Pow(cell.Weighted-cell.Expected, 2) / cell.Expected
+
+			variance := cell.Expected * (1 - rowTotal/total) * (1 - columnTotal/total)
+			if variance > 0 {
+				cell.Residual = (cell.Weighted - cell.Expected) / math.Sqrt(variance) * math.Sqrt(scale)
+				cell.Significant = math.Abs(cell.Residual) > z
+			}
+		}
+	}
+	tab.ChiSquare *= scale
+
+	tab.DegreesOfFreedom = (nonZero(tab.RowTotals) - 1) * (nonZero(tab.ColumnTotals) - 1)
+	if tab.DegreesOfFreedom > 0 {
+		tab.PValue = chiSquareSurvival(tab.ChiSquare, tab.DegreesOfFreedom)
+		tab.Significant = tab.PValue < 1-level
+	}
+	tab.LowExpected = cells > 0 && float64(low)/float64(cells) > 0.2
+
+	return tab, nil
+}
+
+// The labels of the response on every dimension joined, false when one is missing.
+func combinedLabel(response SurveyResponse, dimensions []Dimension, parts map[string][]string) (string, bool) {
+	labels := make([]string, 0, len(dimensions))
+
+	for _, dimension := range dimensions {
+		label, ok := dimension.label(response)
+		if !ok {
+			return "", false
+		}
+		labels = append(labels, label)
+	}
+
+	combined := strings.Join(labels, crossTabSeparator)
+	parts[combined] = labels
+
+	return combined, true
+}
+
+// The combined labels ordered dimension by dimension.
+func sortedLabels(dimensions []Dimension, parts map[string][]string) []string {
+	labels := make([]string, 0, len(parts))
+	for label := range parts {
+		labels = append(labels, label)
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		a, b := parts[labels[i]], parts[labels[j]]
+		for k, dimension := range dimensions {
+			if a[k] != b[k] {
+				return dimension.less(a[k], b[k])
+			}
+		}
+		return false
+	})
+
+	return labels
+}
+
+func nonZero(totals []int) int {
+	var n int
+	for _, total := range totals {
+		if total > 0 {
+			n++
+		}
+	}
+
+	return n
+}
+
+// The probability of a chi-square at least as large, with the degrees of freedom.
+func chiSquareSurvival(x float64, df int) float64 {
+	if x <= 0 {
+		return 1
+	}
+
+	return upperGammaRegularized(float64(df)/2, x/2)
+}
+
+// Q(a, x), by series below a + 1 and by continued fraction above.
+func upperGammaRegularized(a, x float64) float64 {
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lgamma)
+
+	if x < a+1 {
+		term := 1 / a
+		sum := term
+		for n := 1; n < 500; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-15 {
+				break
+			}
+		}
+		return math.Max(0, 1-sum*prefix)
+	}
+
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < 500; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+
+	return prefix * h
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func crossTabResponse(plan string, nps int) SurveyResponse {
+	return SurveyResponse{
+		HiddenFields: map[string]string{"plan": plan},
+		Answers:      []Answer{{QuestionID: "nps", Value: float64(nps)}},
+	}
+}
+
+func TestCrossTabulate(t *testing.T) {
+	var responses []SurveyResponse
+	for i := 0; i < 40; i++ {
+		responses = append(responses, crossTabResponse("pro", 10), crossTabResponse("free", 3))
+	}
+	for i := 0; i < 10; i++ {
+		responses = append(responses, crossTabResponse("pro", 3), crossTabResponse("free", 10), crossTabResponse("free", 8))
+	}
+	// no plan, left out
+	responses = append(responses, SurveyResponse{Answers: []Answer{{QuestionID: "nps", Value: 10.0}}})
+
+	tab, err := CrossTabulate(responses,
+		[]Dimension{{HiddenField: "plan", Levels: []string{"free", "pro"}}},
+		[]Dimension{{QuestionID: "nps", Group: NPSGroup, Levels: []string{"detractor", "passive", "promoter"}}},
+		0,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tab.Total != 110 || len(tab.Rows) != 2 || tab.Rows[0] != "free" || len(tab.Columns) != 3 {
+		t.Fatalf("unexpected table %+v", tab)
+	}
+
+	free := tab.Cells[0]
+	if free[0].Count != 40 || free[1].Count != 10 || free[2].Count != 10 || tab.RowTotals[0] != 60 {
+		t.Errorf("unexpected free plan counts %+v", free)
+	}
+	if math.Abs(free[0].RowPercent-66.667) > 0.001 || free[0].ColumnPercent != 80 {
+		t.Errorf("unexpected percentages %+v", free[0])
+	}
+
+	if !tab.Significant || tab.DegreesOfFreedom != 2 || tab.PValue > 0.001 {
+		t.Errorf("expected the plans to differ significantly, got chi-square %v p %v", tab.ChiSquare, tab.PValue)
+	}
+	if !free[0].Significant || free[0].Residual <= 0 || !tab.Cells[1][2].Significant {
+		t.Errorf("expected the free detractors and pro promoters to be flagged, got %+v %+v", free[0], tab.Cells[1][2])
+	}
+}
+
+func TestCrossTabulate_CombinedDimensions(t *testing.T) {
+	responses := []SurveyResponse{
+		{HiddenFields: map[string]string{"region": "north"}, Answers: []Answer{{QuestionID: "age", Value: 20.0}, {QuestionID: "csat", Value: 5.0}}},
+		{HiddenFields: map[string]string{"region": "north"}, Answers: []Answer{{QuestionID: "age", Value: 9.0}, {QuestionID: "csat", Value: 4.0}}},
+		{HiddenFields: map[string]string{"region": "south"}, Answers: []Answer{{QuestionID: "age", Value: 40.0}, {QuestionID: "csat", Value: 10.0}}},
+	}
+
+	ageGroup := func(value any) (string, bool) {
+		age, ok := numericValue(value)
+		if !ok {
+			return "", false
+		}
+		if age < 35 {
+			return "<35", true
+		}
+		return "35+", true
+	}
+
+	tab, err := CrossTabulate(responses,
+		[]Dimension{{HiddenField: "region"}, {QuestionID: "age", Group: ageGroup}},
+		[]Dimension{{QuestionID: "csat"}},
+		Confidence95,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(tab.Rows) != 2 || tab.Rows[0] != "north × <35" || tab.Rows[1] != "south × 35+" {
+		t.Errorf("unexpected rows %q", tab.Rows)
+	}
+	// numbers are sorted by value
+	if len(tab.Columns) != 3 || tab.Columns[0] != "4" || tab.Columns[2] != "10" {
+		t.Errorf("unexpected columns %q", tab.Columns)
+	}
+	if !tab.LowExpected {
+		t.Error("expected the low expected counts to be reported")
+	}
+}
+
+func TestChiSquareSurvival(t *testing.T) {
+	tests := []struct {
+		x        float64
+		df       int
+		expected float64
+	}{
+		{3.841, 1, 0.05},
+		{5.991, 2, 0.05},
+		{6.635, 1, 0.01},
+		{30, 10, 0.000857},
+	}
+
+	for _, tt := range tests {
+		if got := chiSquareSurvival(tt.x, tt.df); math.Abs(got-tt.expected) > 0.0005 {
+			t.Errorf("chi-square %v with %d df: expected %v, got %v", tt.x, tt.df, tt.expected, got)
+		}
+	}
+}
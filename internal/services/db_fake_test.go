@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// An executed statement with its arguments as sent to the database.
+type recordedExec struct {
+	query string
+	args  []any
+}
+
+// The rows returned to every query.
+type recordedRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+// A database connection recording the statements executed in it, for the hooks
+// writing through the transaction and the queries built out of the filters.
+type recordingConn struct {
+	execs *[]recordedExec
+	rows  recordedRows
+}
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not recorded")
+}
+
+func (c recordingConn) Close() error { return nil }
+
+func (c recordingConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c recordingConn) Commit() error { return nil }
+
+func (c recordingConn) Rollback() error { return nil }
+
+func (c recordingConn) record(query string, args []driver.NamedValue) {
+	exec := recordedExec{query: query}
+	for _, arg := range args {
+		exec.args = append(exec.args, arg.Value)
+	}
+	*c.execs = append(*c.execs, exec)
+}
+
+func (c recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.record(query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (c recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.record(query, args)
+	return &recordedCursor{recordedRows: c.rows}, nil
+}
+
+type recordedCursor struct {
+	recordedRows
+	next int
+}
+
+func (r *recordedCursor) Columns() []string { return r.columns }
+
+func (r *recordedCursor) Close() error { return nil }
+
+func (r *recordedCursor) Next(dest []driver.Value) error {
+	if r.next == len(r.values) {
+		return io.EOF
+	}
+
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
+
+type recordingConnector recordingConn
+
+func (c recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return recordingConn(c), nil
+}
+
+func (c recordingConnector) Driver() driver.Driver { return c }
+
+func (c recordingConnector) Open(string) (driver.Conn, error) {
+	return recordingConn(c), nil
+}
+
+// A database recording the statements executed in it, the queries return the rows.
+func recordingDB(t *testing.T, columns []string, rows ...[]driver.Value) (*sqlx.DB, *[]recordedExec) {
+	t.Helper()
+
+	execs := &[]recordedExec{}
+	db := sqlx.NewDb(sql.OpenDB(recordingConnector{execs: execs, rows: recordedRows{columns: columns, values: rows}}), "postgres")
+	t.Cleanup(func() { db.Close() })
+
+	return db, execs
+}
+
+// A transaction recording the statements executed in it.
+func recordingTx(t *testing.T) (*sqlx.Tx, *[]recordedExec) {
+	t.Helper()
+
+	db, execs := recordingDB(t, nil)
+
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+
+	return tx, execs
+}
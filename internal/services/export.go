@@ -0,0 +1,448 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// NOTE: the wide export has a row per response and a column per question, but for
+// the ranking questions that get a column per option holding its rank. The columns
+// come from the survey definition, not from the answers, so every export of a
+// survey has the same layout whatever the filters.
+
+// The file format of the responses export.
+type ExportFormat int
+
+const (
+	// Wide CSV, a row per response.
+	ExportCSV ExportFormat = iota + 1
+	// JSON Lines, an object per response.
+	ExportJSONL
+	// SPSS system file, a case per response.
+	ExportSAV
+)
+
+var exportFormatNames = map[ExportFormat]string{
+	ExportCSV:   "csv",
+	ExportJSONL: "jsonl",
+	ExportSAV:   "sav",
+}
+
+func (f ExportFormat) String() string {
+	if name, ok := exportFormatNames[f]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ExportFormat(%d)", int(f))
+}
+
+// Parses the name of the export format e.g. "csv".
+func ParseExportFormat(name string) (ExportFormat, error) {
+	for f, n := range exportFormatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown export format %q", name)
+}
+
+// The options of the responses export.
+type ExportOptions struct {
+	Format ExportFormat
+	// The responses created from `From` and before `To`, zero is unbounded.
+	From time.Time
+	To   time.Time
+	// Only the responses reaching an ending, see `Survey.EndingReached`.
+	CompletedOnly bool
+	// Writes the choices as their 1-based position in the options instead of their text.
+	// The SPSS export always writes the codes, labelled with the options.
+	Codes bool
+	// The filter expression the responses must match, see `CompileResponseFilter`.
+	Filter string
+}
+
+func (o ExportOptions) validate() error {
+	if _, ok := exportFormatNames[o.Format]; !ok {
+		return fmt.Errorf("unknown export format %d", o.Format)
+	}
+
+	if !o.From.IsZero() && !o.To.IsZero() && !o.To.After(o.From) {
+		return fmt.Errorf("export range end %s must be after its start %s", o.To.Format(time.RFC3339), o.From.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// Whether the response is kept by the export filters.
+func (o ExportOptions) keeps(flow *flowReplay, response SurveyResponse) bool {
+	if !o.From.IsZero() && response.CreatedAt.Before(o.From) {
+		return false
+	}
+	if !o.To.IsZero() && !response.CreatedAt.Before(o.To) {
+		return false
+	}
+	if o.CompletedOnly {
+		if _, ok := flow.ending(response); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The columns describing the response rather than an answer.
+const (
+	ExportResponseID = "response_id"
+	ExportCreatedAt  = "created_at"
+	ExportCompleted  = "completed"
+	ExportWeight     = "weight"
+)
+
+// A column of the wide export.
+type ExportColumn struct {
+	Name string
+	// The question text, the ranked option or the hidden field.
+	Label      string
+	QuestionID string
+	// The option ranked in the column of a ranking question.
+	Option      string
+	HiddenField string
+}
+
+// The columns of the wide export: the response columns, the hidden fields then the
+// questions in flow order.
+func ExportColumns(survey Survey, hiddenFields []string) []ExportColumn {
+	columns := []ExportColumn{
+		{Name: ExportResponseID, Label: "Response ID"},
+		{Name: ExportCreatedAt, Label: "Created at"},
+		{Name: ExportCompleted, Label: "Reached an ending"},
+		{Name: ExportWeight, Label: "Survey weight"},
+	}
+
+	for _, field := range hiddenFields {
+		columns = append(columns, ExportColumn{Name: "hidden_" + field, Label: field, HiddenField: field})
+	}
+
+	for _, id := range survey.OrderedQuestionIDs() {
+		question := survey.Questions[id]
+
+		if question.Type != Ranking {
+			columns = append(columns, ExportColumn{Name: id, Label: question.Text, QuestionID: id})
+			continue
+		}
+
+		for i, option := range question.Options {
+			columns = append(columns, ExportColumn{
+				Name:       fmt.Sprintf("%s_%d", id, i+1),
+				Label:      fmt.Sprintf("%s: %s", question.Text, option),
+				QuestionID: id,
+				Option:     option,
+			})
+		}
+	}
+
+	return columns
+}
+
+// The ending the answers of the response lead to, following the conditionals from
+// the start question, false when the response stops before an ending.
+//
+// The conditionals referencing unanswered questions see nil rather than failing.
+func (s Survey) EndingReached(response SurveyResponse) (string, bool) {
+	return newFlowReplay(s).ending(response)
+}
+
+// Replays the flow of the survey on the responses, the conditionals compiled once.
+type flowReplay struct {
+	survey   Survey
+	programs map[string]*vm.Program
+}
+
+func newFlowReplay(survey Survey) *flowReplay {
+	return &flowReplay{survey: survey, programs: make(map[string]*vm.Program)}
+}
+
+func (f *flowReplay) ending(response SurveyResponse) (string, bool) {
+	_, ending, ok := f.walk(response)
+	return ending, ok
+}
+
+// The questions asked in order, the last one unanswered when no ending is reached.
+func (f *flowReplay) walk(response SurveyResponse) ([]string, string, bool) {
+	input := response.answerValues()
+	visited := make(map[string]bool)
+	var path []string
+
+	for id := f.survey.StartID; ; {
+		if _, ok := f.survey.Endings[id]; ok {
+			return path, id, true
+		}
+
+		question, ok := f.survey.Questions[id]
+		if !ok || visited[id] {
+			return path, "", false
+		}
+		path = append(path, id)
+		if _, ok := input[id]; !ok {
+			return path, "", false
+		}
+		visited[id] = true
+
+		id = ""
+		for _, conditional := range question.Conditionals {
+			if f.matches(conditional.Expression, input) {
+				id = conditional.NextID
+				break
+			}
+		}
+	}
+}
+
+// Whether the expression holds, the invalid expressions never do.
+func (f *flowReplay) matches(expression string, input map[string]any) bool {
+	program, ok := f.programs[expression]
+	if !ok {
+		program, _ = expr.Compile(expression, expr.AsBool())
+		f.programs[expression] = program
+	}
+	if program == nil {
+		return false
+	}
+
+	output, err := expr.Run(program, input)
+	if err != nil {
+		return false
+	}
+
+	match, _ := output.(bool)
+	return match
+}
+
+// Writes the responses in the export format, `Close` flushes the writer.
+type responseEncoder interface {
+	Encode(response SurveyResponse) error
+	Close() error
+}
+
+// What the layout of the export depends on beyond the survey, read before the responses.
+type exportLayout struct {
+	HiddenFields []string
+	// The longest value in bytes of the string columns keyed by column name, for the
+	// fixed width formats.
+	Widths map[string]int
+}
+
+func newResponseEncoder(w io.Writer, survey Survey, layout exportLayout, options ExportOptions) (responseEncoder, error) {
+	switch options.Format {
+	case ExportCSV:
+		return newCSVEncoder(w, survey, layout.HiddenFields, options)
+	case ExportJSONL:
+		return &jsonlEncoder{writer: bufio.NewWriter(w), survey: survey, flow: newFlowReplay(survey), options: options}, nil
+	case ExportSAV:
+		return newSAVEncoder(w, survey, layout)
+	default:
+		return nil, fmt.Errorf("unknown export format %d", options.Format)
+	}
+}
+
+type csvEncoder struct {
+	writer  *csv.Writer
+	survey  Survey
+	flow    *flowReplay
+	columns []ExportColumn
+	options ExportOptions
+}
+
+func newCSVEncoder(w io.Writer, survey Survey, hiddenFields []string, options ExportOptions) (*csvEncoder, error) {
+	e := &csvEncoder{writer: csv.NewWriter(w), survey: survey, flow: newFlowReplay(survey), columns: ExportColumns(survey, hiddenFields), options: options}
+
+	header := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		header[i] = column.Name
+	}
+
+	if err := e.writer.Write(header); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *csvEncoder) Encode(response SurveyResponse) error {
+	answers := response.answerValues()
+	record := make([]string, len(e.columns))
+
+	for i, column := range e.columns {
+		switch {
+		case column.Name == ExportResponseID:
+			record[i] = response.ID
+		case column.Name == ExportCreatedAt:
+			record[i] = response.CreatedAt.UTC().Format(time.RFC3339)
+		case column.Name == ExportCompleted:
+			record[i] = "0"
+			if _, ok := e.flow.ending(response); ok {
+				record[i] = "1"
+			}
+		case column.Name == ExportWeight:
+			record[i] = formatNumber(response.weight())
+		case column.HiddenField != "":
+			record[i] = response.HiddenFields[column.HiddenField]
+		case column.Option != "":
+			if rank := rankOf(answers[column.QuestionID], column.Option); rank > 0 {
+				record[i] = strconv.Itoa(rank)
+			}
+		default:
+			record[i] = exportText(e.survey.Questions[column.QuestionID], answers[column.QuestionID], e.options.Codes)
+		}
+	}
+
+	return e.writer.Write(record)
+}
+
+func (e *csvEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+type jsonlEncoder struct {
+	writer  *bufio.Writer
+	survey  Survey
+	flow    *flowReplay
+	options ExportOptions
+}
+
+// A line of the JSONL export.
+type exportObject struct {
+	ResponseID   string            `json:"response_id"`
+	CreatedAt    time.Time         `json:"created_at"`
+	Completed    bool              `json:"completed"`
+	EndingID     string            `json:"ending_id,omitempty"`
+	Weight       float64           `json:"weight"`
+	HiddenFields map[string]string `json:"hidden_fields,omitempty"`
+	Answers      map[string]any    `json:"answers"`
+}
+
+func (e *jsonlEncoder) Encode(response SurveyResponse) error {
+	object := exportObject{
+		ResponseID:   response.ID,
+		CreatedAt:    response.CreatedAt.UTC(),
+		Weight:       response.weight(),
+		HiddenFields: response.HiddenFields,
+		Answers:      make(map[string]any, len(response.Answers)),
+	}
+	object.EndingID, object.Completed = e.flow.ending(response)
+
+	for id, value := range response.answerValues() {
+		question, ok := e.survey.Questions[id]
+		if !ok || !e.options.Codes {
+			object.Answers[id] = value
+			continue
+		}
+		object.Answers[id] = exportCode(question, value)
+	}
+
+	line, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+
+	if _, err := e.writer.Write(line); err != nil {
+		return err
+	}
+
+	return e.writer.WriteByte('\n')
+}
+
+func (e *jsonlEncoder) Close() error {
+	return e.writer.Flush()
+}
+
+// The first answer to each question keyed by question ID.
+func (r SurveyResponse) answerValues() map[string]any {
+	values := make(map[string]any, len(r.Answers))
+	for _, answer := range r.Answers {
+		if _, ok := values[answer.QuestionID]; !ok {
+			values[answer.QuestionID] = answer.Value
+		}
+	}
+
+	return values
+}
+
+// The answer written in a CSV cell, empty when unanswered.
+func exportText(question Question, value any, codes bool) string {
+	if value == nil {
+		return ""
+	}
+
+	if codes {
+		value = exportCode(question, value)
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any, []string, map[string]any:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	default:
+		if number, ok := numericValue(v); ok {
+			return formatNumber(number)
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+// The code of the choices, the values out of the options are kept as is.
+func exportCode(question Question, value any) any {
+	switch question.Type {
+	case MultipleChoice:
+		if choice, ok := value.(string); ok {
+			if i := slices.Index(question.Options, choice); i >= 0 {
+				return i + 1
+			}
+		}
+	case Ranking:
+		if ranked, ok := rankedOptions(value); ok {
+			codes := make([]any, len(ranked))
+			for i, option := range ranked {
+				codes[i] = exportCode(Question{Type: MultipleChoice, Options: question.Options}, option)
+			}
+			return codes
+		}
+	}
+
+	return value
+}
+
+// The 1-based rank of the option in the ranking answer, 0 when not ranked.
+func rankOf(value any, option string) int {
+	ranked, ok := rankedOptions(value)
+	if !ok {
+		return 0
+	}
+
+	return slices.Index(ranked, option) + 1
+}
+
+func formatNumber(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+		return strconv.FormatInt(int64(value), 10)
+	}
+
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,479 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/store"
+	"github.com/paulexconde/justasking/internal/pkg/workerpool"
+)
+
+// NOTE: the responses are streamed from a single query joining the answers, ordered
+// by response and filtered by the SQL condition of the response filter, and written
+// as they are read so the export never holds more than a response in memory. The
+// exports queued as jobs write a file in the export directory, renamed in place once
+// complete so a download never sees a partial file. The finished jobs and their files
+// are kept for `exportTTL`, then removed.
+
+// The responses with their answers, %s is the condition of the response filter.
+const exportQuery = `SELECT r.id, r.response_id, r.hidden_fields, r.weight, r.created_at,
+		a.question_id, a.value, a.shown_at, a.answered_at
+	FROM survey_responses r LEFT JOIN survey_answers a ON a.response_id = r.id
+	WHERE r.survey_id = $1
+		AND ($2::timestamptz IS NULL OR r.created_at >= $2)
+		AND ($3::timestamptz IS NULL OR r.created_at < $3)
+		AND (%s)
+	ORDER BY r.created_at, r.id`
+
+// The widths of the string columns of the export, see `exportLayout`.
+const exportWidthsQuery = `SELECT 'response_id' AS name, COALESCE(MAX(octet_length(response_id)), 0) AS width
+		FROM survey_responses WHERE survey_id = $1
+	UNION ALL
+	SELECT 'hidden_' || f.key, MAX(octet_length(f.value))
+		FROM survey_responses r CROSS JOIN LATERAL jsonb_each_text(r.hidden_fields) AS f
+		WHERE r.survey_id = $1 GROUP BY f.key
+	UNION ALL
+	SELECT a.question_id, MAX(octet_length(a.value #>> '{}'))
+		FROM survey_answers a JOIN survey_responses r ON r.id = a.response_id
+		WHERE r.survey_id = $1 AND jsonb_typeof(a.value) = 'string' GROUP BY a.question_id`
+
+// How long the finished export jobs are kept along with their file.
+const exportTTL = 24 * time.Hour
+
+// The state of an export job.
+type ExportStatus int
+
+const (
+	ExportPending ExportStatus = iota + 1
+	ExportRunning
+	ExportDone
+	ExportFailed
+)
+
+var exportStatusNames = map[ExportStatus]string{
+	ExportPending: "pending",
+	ExportRunning: "running",
+	ExportDone:    "done",
+	ExportFailed:  "failed",
+}
+
+func (s ExportStatus) String() string {
+	if name, ok := exportStatusNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ExportStatus(%d)", int(s))
+}
+
+// An export of the responses running in the background.
+type ExportJob struct {
+	ID       string
+	SurveyID string
+	Options  ExportOptions
+	Status   ExportStatus
+	// The name to download the file under e.g. "survey-12-20250301T100000Z.csv".
+	FileName string
+	// The file written, set once done.
+	Path string
+	// The responses written.
+	Responses  int
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Handles the exports of the responses.
+type ExportService interface {
+	// Streams the responses of the survey to w, returns the number of responses written.
+	ExportResponses(surveyID string, options ExportOptions, w io.Writer) (int, error)
+	// Queues the export of the responses of the survey into a file.
+	StartExport(surveyID string, options ExportOptions) (*ExportJob, error)
+	// The state of the export job.
+	GetExport(jobID string) (*ExportJob, error)
+	// Opens the file of the finished export job for download.
+	OpenExport(jobID string) (io.ReadCloser, *ExportJob, error)
+	// Removes the finished export job along with its file, the jobs are removed a day
+	// after they finish otherwise.
+	DeleteExport(jobID string) error
+	// The codebook of the exports of the survey, see `RenderCodebook`.
+	GetCodebook(surveyID string) (*Codebook, error)
+}
+
+type exportServiceImpl struct {
+	surveyservice SurveyService
+	responses     store.Datastorer[models.SurveyResponse]
+	jobQueue      *workerpool.WorkerPool
+	dir           string
+
+	mu   sync.RWMutex
+	jobs map[string]*ExportJob
+}
+
+// Instantiate the `ExportService`, the export jobs write their files into dir.
+func NewExportService(surveyservice SurveyService, responses store.Datastorer[models.SurveyResponse], jobQueue *workerpool.WorkerPool, dir string) ExportService {
+	return &exportServiceImpl{
+		surveyservice: surveyservice,
+		responses:     responses,
+		jobQueue:      jobQueue,
+		dir:           dir,
+		jobs:          make(map[string]*ExportJob),
+	}
+}
+
+func (s *exportServiceImpl) ExportResponses(surveyID string, options ExportOptions, w io.Writer) (int, error) {
+	survey, err := s.surveyservice.GetSurvey(surveyID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := options.validate(); err != nil {
+		return 0, fault.NewClientError("invalid export options", err)
+	}
+
+	return s.export(context.Background(), *survey, options, w)
+}
+
+func (s *exportServiceImpl) export(ctx context.Context, survey Survey, options ExportOptions, w io.Writer) (int, error) {
+	id, err := strconv.Atoi(survey.ID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid survey id %q: %w", survey.ID, err)
+	}
+
+	filter, err := CompileResponseFilter(survey, options.Filter)
+	if err != nil {
+		return 0, err
+	}
+
+	db := s.responses.Base()
+
+	layout, err := readExportLayout(ctx, db, id, options.Format == ExportSAV)
+	if err != nil {
+		return 0, err
+	}
+
+	encoder, err := newResponseEncoder(w, survey, layout, options)
+	if err != nil {
+		return 0, err
+	}
+
+	flow := newFlowReplay(survey)
+	var written int
+
+	err = streamResponses(ctx, db, id, options.From, options.To, filter, func(response SurveyResponse) error {
+		if !options.keeps(flow, response) {
+			return nil
+		}
+
+		written++
+		return encoder.Encode(response)
+	})
+	if err != nil {
+		return written, err
+	}
+
+	return written, encoder.Close()
+}
+
+// Reads the hidden fields of the responses of the survey and, for the fixed width
+// formats, the widths of the string columns.
+func readExportLayout(ctx context.Context, db *sqlx.DB, surveyID int, widths bool) (exportLayout, error) {
+	var layout exportLayout
+	if err := db.SelectContext(ctx, &layout.HiddenFields, "SELECT DISTINCT jsonb_object_keys(hidden_fields) FROM survey_responses WHERE survey_id = $1 ORDER BY 1", surveyID); err != nil {
+		return layout, err
+	}
+
+	if !widths {
+		return layout, nil
+	}
+
+	var rows []models.ColumnWidth
+	if err := db.SelectContext(ctx, &rows, exportWidthsQuery, surveyID); err != nil {
+		return layout, err
+	}
+
+	layout.Widths = make(map[string]int, len(rows))
+	for _, row := range rows {
+		layout.Widths[row.Name] = row.Width
+	}
+
+	return layout, nil
+}
+
+// Reads the responses of the survey created in the range and matching the filter
+// one at a time.
+func streamResponses(ctx context.Context, db *sqlx.DB, surveyID int, from, to time.Time, filter *ResponseFilter, fn func(response SurveyResponse) error) error {
+	where, args := filter.condition(3)
+
+	rows, err := db.QueryxContext(ctx, fmt.Sprintf(exportQuery, where), append([]any{surveyID, timePtr(from), timePtr(to)}, args...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var (
+		current *models.ResponseAnswer
+		answers []models.Answer
+	)
+
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+
+		response, err := responseFromModel(models.SurveyResponse{
+			ID:           current.ID,
+			SurveyID:     strconv.Itoa(surveyID),
+			ResponseID:   current.ResponseID,
+			HiddenFields: current.HiddenFields,
+			Weight:       current.Weight,
+			CreatedAt:    current.CreatedAt,
+		}, answers)
+		if err != nil {
+			return err
+		}
+
+		if filter.inMemory() && !filter.Matches(response) {
+			return nil
+		}
+
+		return fn(response)
+	}
+
+	for rows.Next() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var row models.ResponseAnswer
+		if err := rows.StructScan(&row); err != nil {
+			return err
+		}
+
+		if current == nil || current.ID != row.ID {
+			if err := flush(); err != nil {
+				return err
+			}
+			current, answers = &row, answers[:0]
+		}
+
+		if row.QuestionID != nil {
+			answers = append(answers, models.Answer{
+				QuestionID: *row.QuestionID,
+				Value:      row.Value,
+				ShownAt:    row.ShownAt,
+				AnsweredAt: row.AnsweredAt,
+			})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+func (s *exportServiceImpl) StartExport(surveyID string, options ExportOptions) (*ExportJob, error) {
+	survey, err := s.surveyservice.GetSurvey(surveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := options.validate(); err != nil {
+		return nil, fault.NewClientError("invalid export options", err)
+	}
+
+	// the job would fail on the invalid filters
+	if _, err := CompileResponseFilter(*survey, options.Filter); err != nil {
+		return nil, err
+	}
+
+	id, err := exportJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt := now()
+	job := &ExportJob{
+		ID:        id,
+		SurveyID:  survey.ID,
+		Options:   options,
+		Status:    ExportPending,
+		FileName:  fmt.Sprintf("survey-%s-%s.%s", survey.ID, createdAt.UTC().Format("20060102T150405Z"), options.Format),
+		CreatedAt: createdAt,
+	}
+
+	s.mu.Lock()
+	s.jobs[id] = job
+	s.mu.Unlock()
+
+	s.jobQueue.Submit(func(ctx context.Context) {
+		s.run(ctx, job.ID, *survey)
+	})
+
+	return s.GetExport(id)
+}
+
+// Writes the export file of the job.
+func (s *exportServiceImpl) run(ctx context.Context, jobID string, survey Survey) {
+	job := s.update(jobID, func(job *ExportJob) { job.Status = ExportRunning })
+
+	path := filepath.Join(s.dir, job.ID+"-"+job.FileName)
+	responses, err := s.writeFile(ctx, survey, job.Options, path)
+
+	finished := s.update(jobID, func(job *ExportJob) {
+		job.FinishedAt = now()
+		job.Responses = responses
+		if err != nil {
+			log.Printf("Export %s of survey %s failed: %v", job.ID, job.SurveyID, err)
+			job.Status = ExportFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = ExportDone
+		job.Path = path
+	})
+
+	s.jobQueue.SubmitAt(finished.FinishedAt.Add(exportTTL), func(ctx context.Context) {
+		// the job may already be deleted
+		if err := s.DeleteExport(jobID); err != nil && !errors.Is(err, fault.ErrNotFound) {
+			log.Printf("Cannot remove expired export %s: %v", jobID, err)
+		}
+	})
+}
+
+func (s *exportServiceImpl) writeFile(ctx context.Context, survey Survey, options ExportOptions, path string) (responses int, err error) {
+	file, err := os.CreateTemp(s.dir, ".export-*")
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	if responses, err = s.export(ctx, survey, options, file); err != nil {
+		return responses, err
+	}
+
+	if err = file.Close(); err != nil {
+		return responses, err
+	}
+
+	return responses, os.Rename(file.Name(), path)
+}
+
+// Applies the change to the job, returns a copy of the job changed.
+func (s *exportServiceImpl) update(jobID string, change func(job *ExportJob)) ExportJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.jobs[jobID]
+	change(job)
+	return *job
+}
+
+func (s *exportServiceImpl) GetExport(jobID string) (*ExportJob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return nil, fault.ErrNotFound
+	}
+
+	snapshot := *job
+	return &snapshot, nil
+}
+
+func (s *exportServiceImpl) OpenExport(jobID string) (io.ReadCloser, *ExportJob, error) {
+	job, err := s.GetExport(jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if job.Status != ExportDone {
+		return nil, job, fault.NewClientError(fmt.Sprintf("export is %s", job.Status), nil)
+	}
+
+	file, err := os.Open(job.Path)
+	if err != nil {
+		return nil, job, err
+	}
+
+	return file, job, nil
+}
+
+func (s *exportServiceImpl) DeleteExport(jobID string) error {
+	s.mu.Lock()
+	job, ok := s.jobs[jobID]
+	if !ok {
+		s.mu.Unlock()
+		return fault.ErrNotFound
+	}
+
+	// the running job would write its file once deleted
+	if job.Status == ExportPending || job.Status == ExportRunning {
+		s.mu.Unlock()
+		return fault.NewClientError(fmt.Sprintf("export is %s", job.Status), nil)
+	}
+
+	delete(s.jobs, jobID)
+	path := job.Path
+	s.mu.Unlock()
+
+	if path == "" {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *exportServiceImpl) GetCodebook(surveyID string) (*Codebook, error) {
+	survey, err := s.surveyservice.GetSurvey(surveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.Atoi(survey.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid survey id %q: %w", survey.ID, err)
+	}
+
+	layout, err := readExportLayout(context.Background(), s.responses.Base(), id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	codebook := newCodebook(*survey, layout)
+	return &codebook, nil
+}
+
+func exportJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
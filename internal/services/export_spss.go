@@ -0,0 +1,221 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/paulexconde/justasking/internal/pkg/spss"
+)
+
+// NOTE: the SPSS export has the columns of the wide export as variables. The choices
+// are written as their codes labelled with the options and the unanswered questions
+// as user-missing codes telling the questions routed around from the ones the
+// respondent stopped at. The free numbers have no code to spare, they are left
+// system-missing instead. The cases are weighted by the survey weight.
+
+// The user-missing codes of the SPSS export.
+const (
+	// The flow of the response went around the question.
+	SPSSNotAsked = -99
+	// The respondent stopped on the question or before it.
+	SPSSNotAnswered = -98
+)
+
+var spssMissingLabels = []spss.ValueLabel{
+	{Value: SPSSNotAsked, Label: "Not asked"},
+	{Value: SPSSNotAnswered, Label: "Not answered"},
+}
+
+type savEncoder struct {
+	writer  *spss.Writer
+	survey  Survey
+	flow    *flowReplay
+	columns []ExportColumn
+}
+
+func newSAVEncoder(w io.Writer, survey Survey, layout exportLayout) (*savEncoder, error) {
+	columns := ExportColumns(survey, layout.HiddenFields)
+	variables := SPSSVariables(survey, columns, layout.Widths)
+
+	writer, err := spss.NewWriter(w, spss.Header{Label: survey.Title, Created: now(), WeightVariable: ExportWeight}, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	return &savEncoder{writer: writer, survey: survey, flow: newFlowReplay(survey), columns: columns}, nil
+}
+
+// The SPSS variables of the export columns, in the same order.
+//
+// The string variables are as wide as the longest value in widths, keyed by column
+// name, up to `spss.MaxStringWidth` bytes.
+func SPSSVariables(survey Survey, columns []ExportColumn, widths map[string]int) []spss.Variable {
+	variables := make([]spss.Variable, len(columns))
+	taken := make(map[string]bool, len(columns))
+
+	for i, column := range columns {
+		variable := spss.Variable{Name: spssName(column.Name, taken), Label: column.Label}
+
+		text := func() {
+			variable.Width = min(max(widths[column.Name], 1), spss.MaxStringWidth)
+			variable.Measure = spss.Nominal
+		}
+
+		switch {
+		case column.Name == ExportResponseID:
+			text()
+		case column.Name == ExportCreatedAt:
+			variable.Format, variable.FormatWidth, variable.Measure = spss.FormatDateTime, 20, spss.Scale
+		case column.Name == ExportCompleted:
+			variable.FormatWidth, variable.Measure = 1, spss.Nominal
+			variable.ValueLabels = []spss.ValueLabel{{Value: 0, Label: "No"}, {Value: 1, Label: "Yes"}}
+		case column.Name == ExportWeight:
+			variable.FormatWidth, variable.Decimals, variable.Measure = 10, 4, spss.Scale
+		case column.HiddenField != "":
+			text()
+		case column.Option != "":
+			question := survey.Questions[column.QuestionID]
+			variable.FormatWidth, variable.Measure = max(3, len(strconv.Itoa(len(question.Options)))), spss.Ordinal
+			variable.ValueLabels = slices.Clone(spssMissingLabels)
+			variable.MissingValues = []float64{SPSSNotAsked, SPSSNotAnswered}
+		default:
+			question := survey.Questions[column.QuestionID]
+
+			switch question.Type {
+			case MultipleChoice:
+				variable.FormatWidth, variable.Measure = max(3, len(strconv.Itoa(len(question.Options)))), spss.Nominal
+				for code, option := range question.Options {
+					variable.ValueLabels = append(variable.ValueLabels, spss.ValueLabel{Value: float64(code + 1), Label: option})
+				}
+			case Rating:
+				variable.FormatWidth, variable.Measure = 3, spss.Ordinal
+				for _, option := range question.Options {
+					if point, err := strconv.ParseFloat(option, 64); err == nil {
+						variable.ValueLabels = append(variable.ValueLabels, spss.ValueLabel{Value: point, Label: option})
+					}
+				}
+			case Numeric:
+				variable.FormatWidth, variable.Decimals, variable.Measure = 12, 2, spss.Scale
+			default:
+				text()
+			}
+
+			if question.Type == MultipleChoice || question.Type == Rating {
+				variable.ValueLabels = append(variable.ValueLabels, spssMissingLabels...)
+				variable.MissingValues = []float64{SPSSNotAsked, SPSSNotAnswered}
+			}
+		}
+
+		variables[i] = variable
+	}
+
+	return variables
+}
+
+// A valid and unique SPSS variable name out of the column name.
+func spssName(name string, taken map[string]bool) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '@', r == '#', r == '$':
+		case r >= '0' && r <= '9', r == '_', r == '.':
+			if i == 0 {
+				b.WriteByte('v')
+			}
+		default:
+			if i == 0 {
+				b.WriteByte('v')
+			}
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+
+	base := b.String()
+	if base == "" {
+		base = "v"
+	}
+	base = strings.TrimSuffix(base[:min(len(base), spss.MaxNameLength-4)], ".")
+
+	candidate := base
+	for n := 2; !spss.ValidName(candidate) || taken[strings.ToUpper(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s_%d", base, n)
+	}
+	taken[strings.ToUpper(candidate)] = true
+
+	return candidate
+}
+
+func (e *savEncoder) Encode(response SurveyResponse) error {
+	answers := response.answerValues()
+	path, _, _ := e.flow.walk(response)
+
+	// the value of an unanswered coded question
+	unanswered := func(questionID string) any {
+		if slices.Contains(path, questionID) {
+			return float64(SPSSNotAnswered)
+		}
+		return float64(SPSSNotAsked)
+	}
+
+	values := make([]any, len(e.columns))
+
+	for i, column := range e.columns {
+		value, answered := answers[column.QuestionID]
+		answered = answered && value != nil
+
+		switch {
+		case column.Name == ExportResponseID:
+			values[i] = response.ID
+		case column.Name == ExportCreatedAt:
+			values[i] = spss.DateTime(response.CreatedAt)
+		case column.Name == ExportCompleted:
+			values[i] = 0.0
+			if _, ok := e.flow.ending(response); ok {
+				values[i] = 1.0
+			}
+		case column.Name == ExportWeight:
+			values[i] = response.weight()
+		case column.HiddenField != "":
+			values[i] = response.HiddenFields[column.HiddenField]
+		case column.Option != "":
+			if !answered {
+				values[i] = unanswered(column.QuestionID)
+			} else if rank := rankOf(value, column.Option); rank > 0 {
+				values[i] = float64(rank)
+			}
+		default:
+			question := e.survey.Questions[column.QuestionID]
+
+			switch question.Type {
+			case MultipleChoice, Rating:
+				if !answered {
+					values[i] = unanswered(column.QuestionID)
+					break
+				}
+				// the answers out of the options are left system-missing
+				if code, ok := numericValue(exportCode(question, value)); ok {
+					values[i] = code
+				}
+			case Numeric:
+				if number, ok := numericValue(value); ok && answered {
+					values[i] = number
+				}
+			default:
+				values[i] = ""
+				if answered {
+					values[i] = exportText(question, value, false)
+				}
+			}
+		}
+	}
+
+	return e.writer.WriteCase(values)
+}
+
+func (e *savEncoder) Close() error {
+	return e.writer.Flush()
+}
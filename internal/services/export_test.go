@@ -0,0 +1,266 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+func exportSurvey() Survey {
+	return Survey{
+		ID:      "1",
+		StartID: "plan",
+		Questions: map[string]Question{
+			"plan": {ID: "plan", Text: "Your plan?", Type: MultipleChoice, Options: []string{"free", "pro"}, Conditionals: []ConditionalNext{
+				{Expression: `plan == "pro"`, NextID: "rank"},
+				{Expression: `true`, NextID: "score"},
+			}},
+			"rank": {ID: "rank", Text: "Rank the features", Type: Ranking, Options: []string{"speed", "price", "support"}, Conditionals: []ConditionalNext{
+				{Expression: `true`, NextID: "score"},
+			}},
+			"score": {ID: "score", Text: "Score?", Type: Rating, Options: RatingScale(0, 10), Conditionals: []ConditionalNext{
+				{Expression: `score >= 9 || rank != nil`, NextID: "end"},
+				{Expression: `true`, NextID: "why"},
+			}},
+			"why": {ID: "why", Text: "Why?", Type: Text, Conditionals: []ConditionalNext{
+				{Expression: `true`, NextID: "end"},
+			}},
+		},
+		Endings: map[string]Ending{"end": {ID: "end", Title: "Thanks"}},
+	}
+}
+
+func exportResponses() []SurveyResponse {
+	createdAt := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	return []SurveyResponse{
+		{ID: "r1", CreatedAt: createdAt, HiddenFields: map[string]string{"region": "north"}, Answers: []Answer{
+			{QuestionID: "plan", Value: "pro"},
+			{QuestionID: "rank", Value: []any{"price", "speed"}},
+			{QuestionID: "score", Value: 6.0},
+		}},
+		{ID: "r2", CreatedAt: createdAt.Add(time.Hour), Weight: 1.5, Answers: []Answer{
+			{QuestionID: "plan", Value: "free"},
+			{QuestionID: "score", Value: 3.0},
+		}},
+	}
+}
+
+func TestEndingReached(t *testing.T) {
+	survey := exportSurvey()
+	responses := exportResponses()
+
+	// the conditional on the skipped ranking sees nil
+	if ending, ok := survey.EndingReached(responses[0]); !ok || ending != "end" {
+		t.Errorf("expected the ending, got %q %v", ending, ok)
+	}
+
+	if _, ok := survey.EndingReached(responses[1]); ok {
+		t.Errorf("expected the response to stop before the ending")
+	}
+
+	options := ExportOptions{Format: ExportCSV, CompletedOnly: true, From: responses[0].CreatedAt}
+	flow := newFlowReplay(survey)
+	if !options.keeps(flow, responses[0]) || options.keeps(flow, responses[1]) {
+		t.Errorf("unexpected completed filter")
+	}
+
+	options = ExportOptions{Format: ExportCSV, To: responses[1].CreatedAt}
+	if !options.keeps(flow, responses[0]) || options.keeps(flow, responses[1]) {
+		t.Errorf("expected the range end to be exclusive")
+	}
+}
+
+func TestCSVExport(t *testing.T) {
+	for _, codes := range []bool{false, true} {
+		var buf bytes.Buffer
+
+		encoder, err := newResponseEncoder(&buf, exportSurvey(), exportLayout{HiddenFields: []string{"region"}}, ExportOptions{Format: ExportCSV, Codes: codes})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, response := range exportResponses() {
+			if err := encoder.Encode(response); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("invalid csv: %v", err)
+		}
+
+		header := "response_id,created_at,completed,weight,hidden_region,plan,rank_1,rank_2,rank_3,score,why"
+		if len(records) != 3 || strings.Join(records[0], ",") != header {
+			t.Fatalf("unexpected records %v", records)
+		}
+
+		plan := "pro,2,1,,6,"
+		if codes {
+			plan = "2,2,1,,6,"
+		}
+		if got := strings.Join(records[1], ","); got != "r1,2025-03-01T10:00:00Z,1,1,north,"+plan {
+			t.Errorf("unexpected first row %q", got)
+		}
+
+		if got := strings.Join(records[2][2:5], ","); got != "0,1.5," {
+			t.Errorf("unexpected second row %v", records[2])
+		}
+	}
+}
+
+func TestJSONLExport(t *testing.T) {
+	var buf bytes.Buffer
+
+	encoder, err := newResponseEncoder(&buf, exportSurvey(), exportLayout{}, ExportOptions{Format: ExportJSONL, Codes: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, response := range exportResponses() {
+		if err := encoder.Encode(response); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per response, got %q", buf.String())
+	}
+
+	var first struct {
+		ResponseID string         `json:"response_id"`
+		Completed  bool           `json:"completed"`
+		EndingID   string         `json:"ending_id"`
+		Answers    map[string]any `json:"answers"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+
+	rank, _ := first.Answers["rank"].([]any)
+	if first.ResponseID != "r1" || !first.Completed || first.EndingID != "end" || first.Answers["plan"] != 2.0 || len(rank) != 2 || rank[0] != 2.0 {
+		t.Errorf("unexpected object %+v", first)
+	}
+}
+
+func TestParseExportFormat(t *testing.T) {
+	if format, err := ParseExportFormat("jsonl"); err != nil || format != ExportJSONL || format.String() != "jsonl" {
+		t.Errorf("unexpected format %v %v", format, err)
+	}
+
+	if _, err := ParseExportFormat("xlsx"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+
+	if err := (ExportOptions{Format: ExportCSV, From: time.Now(), To: time.Now().Add(-time.Hour)}).validate(); err == nil {
+		t.Errorf("expected an error for an empty range")
+	}
+}
+
+func TestSAVExport(t *testing.T) {
+	var buf bytes.Buffer
+
+	encoder, err := newResponseEncoder(&buf, exportSurvey(), exportLayout{HiddenFields: []string{"region"}, Widths: map[string]int{"response_id": 2, "hidden_region": 5}}, ExportOptions{Format: ExportSAV})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, response := range exportResponses() {
+		if err := encoder.Encode(response); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("$FL2")) {
+		t.Fatalf("expected a system file, got %q", data[:min(len(data), 4)])
+	}
+
+	// the cases follow the dictionary terminator, 8 bytes per numeric and string segment
+	end := bytes.Index(data, []byte{0xe7, 0x03, 0, 0, 0, 0, 0, 0})
+	if end < 0 {
+		t.Fatalf("missing the dictionary terminator")
+	}
+
+	variables := SPSSVariables(exportSurvey(), ExportColumns(exportSurvey(), []string{"region"}), map[string]int{"response_id": 2, "hidden_region": 5})
+	segments := 0
+	for _, variable := range variables {
+		segments += max(1, (variable.Width+7)/8)
+	}
+	if got := len(data) - end - 8; got != 2*segments*8 {
+		t.Errorf("expected %d bytes of cases, got %d", 2*segments*8, got)
+	}
+}
+
+func TestSPSSVariables(t *testing.T) {
+	survey := exportSurvey()
+	variables := SPSSVariables(survey, ExportColumns(survey, []string{"utm source", "region"}), nil)
+
+	names := make([]string, len(variables))
+	for i, variable := range variables {
+		names[i] = variable.Name
+	}
+	if got := strings.Join(names, ","); got != "response_id,created_at,completed,weight,hidden_utm_source,hidden_region,plan,rank_1,rank_2,rank_3,score,why" {
+		t.Errorf("unexpected names %s", got)
+	}
+
+	plan := variables[6]
+	if len(plan.ValueLabels) != 4 || plan.ValueLabels[1].Value != 2 || plan.ValueLabels[1].Label != "pro" || len(plan.MissingValues) != 2 {
+		t.Errorf("unexpected plan variable %+v", plan)
+	}
+
+	if why := variables[11]; why.Width != 1 || len(why.ValueLabels) != 0 {
+		t.Errorf("expected a string variable, got %+v", why)
+	}
+
+	taken := map[string]bool{}
+	if a, b := spssName("1st", taken), spssName("1ST", taken); a != "v1st" || b != "v1ST_2" {
+		t.Errorf("unexpected names %s %s", a, b)
+	}
+	if name := spssName("and", taken); name != "and_2" {
+		t.Errorf("expected the reserved name renamed, got %s", name)
+	}
+}
+
+func TestDeleteExport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "job1-survey-1.csv")
+	if err := os.WriteFile(path, []byte("id\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	exportservice := NewExportService(nil, nil, nil, dir)
+	s := exportservice.(*exportServiceImpl)
+	s.jobs["job1"] = &ExportJob{ID: "job1", Status: ExportDone, Path: path}
+	s.jobs["job2"] = &ExportJob{ID: "job2", Status: ExportRunning}
+
+	if err := exportservice.DeleteExport("job2"); err == nil || !fault.IsClientError(err) {
+		t.Errorf("expected a client error deleting the running export, got %v", err)
+	}
+
+	if err := exportservice.DeleteExport("job1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the export file to be removed, got %v", err)
+	}
+	if _, err := exportservice.GetExport("job1"); !errors.Is(err, fault.ErrNotFound) {
+		t.Errorf("expected the export job to be removed, got %v", err)
+	}
+}
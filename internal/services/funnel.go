@@ -0,0 +1,232 @@
+package services
+
+import (
+	"sort"
+)
+
+// NOTE: the path of each respondent is rebuilt from the time the questions were
+// shown, so the funnel follows the branches actually taken rather than a linear
+// order. A session is completed once it reaches an ending.
+//
+// The sessions are not persisted, only the responses are. The funnel of a survey is
+// computed out of its saved responses, the partial ones included, see
+// `SessionsFromResponses`. The sessions abandoned before any response was saved are
+// only counted when passed to `ComputeFunnel` by whoever holds them.
+
+// The respondents reaching, answering and leaving a question.
+type FunnelStep struct {
+	QuestionID string
+	// The sessions the question was shown in.
+	Seen     int
+	Answered int
+	// The sessions abandoned on the question.
+	DroppedOut int
+	// Of the sessions, the share reaching the question.
+	ReachRate float64
+	// Of the sessions reaching the question, the share abandoning it.
+	DropOffRate float64
+	// Where the respondents went after the question, keyed by question or ending ID.
+	Next map[string]int
+}
+
+// The drop-off analysis of the sessions of a survey.
+type Funnel struct {
+	Sessions  int
+	Completed int
+	// In flow order.
+	Steps []FunnelStep
+}
+
+// Computes the funnel of the survey out of the sessions.
+//
+// The sessions are the ones given, in progress or rebuilt with `SessionsFromResponses`.
+func ComputeFunnel(survey Survey, sessions []SurveySession) Funnel {
+	funnel := Funnel{Sessions: len(sessions)}
+
+	steps := make(map[string]*FunnelStep, len(survey.Questions))
+	for id := range survey.Questions {
+		steps[id] = &FunnelStep{QuestionID: id, Next: make(map[string]int)}
+	}
+
+	for _, session := range sessions {
+		path := session.path()
+
+		for i, id := range path {
+			step, ok := steps[id]
+			if !ok {
+				continue
+			}
+
+			step.Seen++
+			if _, ok := session.Answers[id]; ok {
+				step.Answered++
+			}
+
+			if i+1 < len(path) {
+				step.Next[path[i+1]]++
+			} else if session.EndingID != "" {
+				step.Next[session.EndingID]++
+			}
+		}
+
+		if session.EndingID != "" {
+			funnel.Completed++
+			continue
+		}
+
+		// abandoned on the question shown last
+		if len(path) > 0 {
+			if step, ok := steps[path[len(path)-1]]; ok {
+				step.DroppedOut++
+			}
+		}
+	}
+
+	for _, id := range survey.OrderedQuestionIDs() {
+		step := steps[id]
+		if funnel.Sessions > 0 {
+			step.ReachRate = float64(step.Seen) / float64(funnel.Sessions) * 100
+		}
+		if step.Seen > 0 {
+			step.DropOffRate = float64(step.DroppedOut) / float64(step.Seen) * 100
+		}
+
+		funnel.Steps = append(funnel.Steps, *step)
+	}
+
+	return funnel
+}
+
+// The questions abandoned the most, by drop-off rate then number of drop-outs.
+//
+// Only the questions with drop-outs are returned, at most n of them when n > 0.
+func (f Funnel) TopDropOffs(n int) []FunnelStep {
+	var steps []FunnelStep
+	for _, step := range f.Steps {
+		if step.DroppedOut > 0 {
+			steps = append(steps, step)
+		}
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		if steps[i].DropOffRate == steps[j].DropOffRate {
+			return steps[i].DroppedOut > steps[j].DroppedOut
+		}
+		return steps[i].DropOffRate > steps[j].DropOffRate
+	})
+
+	if n > 0 && len(steps) > n {
+		steps = steps[:n]
+	}
+
+	return steps
+}
+
+// The sessions of the saved responses, in the same order.
+//
+// The flow is replayed on the answers: the responses reaching an ending are completed
+// and the others are left on the question the flow led them to. The questions are
+// ordered by the time they were shown when the answers have it.
+func SessionsFromResponses(survey Survey, responses []SurveyResponse) []SurveySession {
+	flow := newFlowReplay(survey)
+	sessions := make([]SurveySession, 0, len(responses))
+
+	for _, response := range responses {
+		session := SurveySession{
+			ID:           response.ID,
+			SurveyID:     response.SurveyID,
+			Answers:      response.answerValues(),
+			Timings:      make(map[string]AnswerTiming, len(response.Answers)),
+			HiddenFields: response.HiddenFields,
+		}
+
+		for _, answer := range response.Answers {
+			if !answer.ShownAt.IsZero() || !answer.AnsweredAt.IsZero() {
+				session.Timings[answer.QuestionID] = AnswerTiming{ShownAt: answer.ShownAt, AnsweredAt: answer.AnsweredAt}
+			}
+		}
+
+		path, ending, ok := flow.walk(response)
+		session.Walked = path
+		switch {
+		case ok:
+			session.Completed = true
+			session.EndingID = ending
+		case len(path) > 0:
+			// the respondent stopped on the last question of the path
+			session.CurrentID = path[len(path)-1]
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+// The questions shown in the session in order, the current question last.
+//
+// The questions without timings follow the walked order, then their ID.
+func (session SurveySession) path() []string {
+	seen := make(map[string]bool, len(session.Answers)+1)
+	var path []string
+
+	walked := make(map[string]int, len(session.Walked))
+	for i, id := range session.Walked {
+		if _, ok := walked[id]; !ok {
+			walked[id] = i
+		}
+	}
+
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			path = append(path, id)
+		}
+	}
+
+	for id, timing := range session.Timings {
+		if !timing.ShownAt.IsZero() {
+			add(id)
+		}
+	}
+	for _, id := range session.Walked {
+		add(id)
+	}
+	for id := range session.Answers {
+		add(id)
+	}
+
+	sort.Slice(path, func(i, j int) bool {
+		a, b := session.Timings[path[i]].ShownAt, session.Timings[path[j]].ShownAt
+		switch {
+		case a.IsZero() != b.IsZero():
+			return !a.IsZero()
+		case !a.Equal(b):
+			return a.Before(b)
+		}
+
+		x, xok := walked[path[i]]
+		y, yok := walked[path[j]]
+		switch {
+		case xok != yok:
+			return xok
+		case x != y:
+			return x < y
+		default:
+			return path[i] < path[j]
+		}
+	})
+
+	// the question being shown comes last, answered or not
+	if session.CurrentID != "" {
+		for i, id := range path {
+			if id == session.CurrentID {
+				path = append(path[:i], path[i+1:]...)
+				break
+			}
+		}
+		path = append(path, session.CurrentID)
+	}
+
+	return path
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func funnelSession(ending string, path ...string) SurveySession {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	session := SurveySession{Answers: map[string]any{}, Timings: map[string]AnswerTiming{}, EndingID: ending}
+
+	for i, id := range path {
+		shown := start.Add(time.Duration(i) * time.Minute)
+		session.Timings[id] = AnswerTiming{ShownAt: shown, AnsweredAt: shown.Add(time.Minute)}
+		session.Answers[id] = "x"
+	}
+
+	if ending == "" {
+		// the last question is shown but not answered
+		last := path[len(path)-1]
+		delete(session.Answers, last)
+		session.Timings[last] = AnswerTiming{ShownAt: session.Timings[last].ShownAt}
+		session.CurrentID = last
+	}
+
+	return session
+}
+
+func TestComputeFunnel(t *testing.T) {
+	survey := definitionSurvey()
+	survey.Questions["q2"] = Question{ID: "q2", Type: Text, Conditionals: []ConditionalNext{{Expression: "true", NextID: "underage"}}}
+
+	sessions := []SurveySession{
+		funnelSession("underage", "q1", "q2"),
+		funnelSession("underage", "q1"),
+		funnelSession("", "q1", "q2"),
+		funnelSession("", "q1", "q2"),
+		funnelSession("", "q1"),
+	}
+
+	funnel := ComputeFunnel(survey, sessions)
+
+	if funnel.Sessions != 5 || funnel.Completed != 2 || len(funnel.Steps) != 2 {
+		t.Fatalf("unexpected funnel %+v", funnel)
+	}
+
+	q1, q2 := funnel.Steps[0], funnel.Steps[1]
+	if q1.Seen != 5 || q1.Answered != 4 || q1.DroppedOut != 1 || q1.Next["q2"] != 3 || q1.Next["underage"] != 1 {
+		t.Errorf("unexpected q1 step %+v", q1)
+	}
+	if q2.Seen != 3 || q2.Answered != 1 || q2.DroppedOut != 2 || q2.ReachRate != 60 {
+		t.Errorf("unexpected q2 step %+v", q2)
+	}
+
+	top := funnel.TopDropOffs(1)
+	if len(top) != 1 || top[0].QuestionID != "q2" {
+		t.Errorf("expected q2 to be abandoned the most, got %+v", top)
+	}
+}
+
+func TestSessionsFromResponses(t *testing.T) {
+	survey := definitionSurvey()
+	survey.Questions["q2"] = Question{ID: "q2", Type: Text, Conditionals: []ConditionalNext{{Expression: "true", NextID: "underage"}}}
+
+	shown := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	responses := []SurveyResponse{
+		{ID: "r1", Answers: []Answer{{QuestionID: "q2", Value: "developer", ShownAt: shown.Add(time.Minute)}, {QuestionID: "q1", Value: "yes", ShownAt: shown}}},
+		{ID: "r2", Answers: []Answer{{QuestionID: "q1", Value: "yes"}}},
+		{ID: "r3", Answers: []Answer{{QuestionID: "q1", Value: "no"}}},
+		{ID: "r4"},
+	}
+
+	sessions := SessionsFromResponses(survey, responses)
+
+	if len(sessions) != 4 || !sessions[0].Completed || sessions[0].EndingID != "underage" || sessions[2].EndingID != "underage" {
+		t.Fatalf("expected r1 and r3 to be completed, got %+v", sessions)
+	}
+	if sessions[1].CurrentID != "q2" || sessions[3].CurrentID != "q1" {
+		t.Errorf("expected the partial responses to stop on the next question, got %q and %q", sessions[1].CurrentID, sessions[3].CurrentID)
+	}
+	if got := sessions[0].path(); len(got) != 2 || got[0] != "q1" {
+		t.Errorf("expected the path ordered by the time shown, got %v", got)
+	}
+
+	funnel := ComputeFunnel(survey, sessions)
+
+	q1, q2 := funnel.Steps[0], funnel.Steps[1]
+	if funnel.Completed != 2 || q1.Seen != 4 || q1.Answered != 3 || q1.DroppedOut != 1 {
+		t.Errorf("unexpected q1 step %+v", q1)
+	}
+	if q2.Seen != 2 || q2.Answered != 1 || q2.DroppedOut != 1 {
+		t.Errorf("unexpected q2 step %+v", q2)
+	}
+}
+
+func TestSessionsFromResponses_WalkedOrder(t *testing.T) {
+	survey := Survey{
+		ID:      "s1",
+		StartID: "q2",
+		Questions: map[string]Question{
+			"q2": {ID: "q2", Type: Text, Conditionals: []ConditionalNext{{Expression: "true", NextID: "q1"}}},
+			"q1": {ID: "q1", Type: Text, Conditionals: []ConditionalNext{{Expression: "true", NextID: "done"}}},
+		},
+		Endings: map[string]Ending{"done": {ID: "done"}},
+	}
+
+	// no timings, the questions follow the flow rather than their ID
+	responses := []SurveyResponse{
+		{ID: "r1", Answers: []Answer{{QuestionID: "q1", Value: "b"}, {QuestionID: "q2", Value: "a"}}},
+	}
+
+	sessions := SessionsFromResponses(survey, responses)
+
+	if got := sessions[0].path(); len(got) != 2 || got[0] != "q2" || got[1] != "q1" {
+		t.Errorf("expected the walked path, got %v", got)
+	}
+
+	funnel := ComputeFunnel(survey, sessions)
+	for _, step := range funnel.Steps {
+		if step.QuestionID == "q1" && (step.Next["q2"] != 0 || step.Next["done"] != 1) {
+			t.Errorf("unexpected q1 step %+v", step)
+		}
+	}
+}
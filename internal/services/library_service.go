@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/paginator"
+	"github.com/paulexconde/justasking/internal/pkg/store"
+)
+
+const libraryQuestionColumns = "id, text, question_type, options, tags, version, updated_at"
+
+// Points a survey question to the library question it comes from.
+type LibraryLink struct {
+	// The library question ID.
+	QuestionID string
+	// The library version the survey question is based on.
+	Version int
+	// Linked questions are offered the library updates, copies are not.
+	Linked bool
+}
+
+// A question stored independently of the surveys so it can be reused across them.
+type LibraryQuestion struct {
+	ID        string
+	Text      string
+	Type      QuestionType
+	Options   []string
+	Tags      []string
+	Version   int
+	UpdatedAt time.Time
+}
+
+// How the library question is inserted into the survey.
+type LibraryInsertMode int
+
+const (
+	// The survey question follows the library updates.
+	InsertByReference LibraryInsertMode = iota + 1
+	// The survey question is a copy, it only keeps track of its origin for the analytics.
+	InsertByCopy
+)
+
+// An update of the library question that a linked survey question has not applied yet.
+type LibraryUpdate struct {
+	// The survey question ID.
+	QuestionID string
+	Current    Question
+	Latest     LibraryQuestion
+}
+
+// Handles the question bank shared by the surveys.
+type QuestionLibraryService interface {
+	CreateLibraryQuestion(question LibraryQuestion) (*LibraryQuestion, error)
+	GetLibraryQuestion(libraryID string) (*LibraryQuestion, error)
+	ListLibraryQuestions(page, limit int) (*paginator.PaginatedResponse[LibraryQuestion], error)
+	// Updates the library question and bumps its version.
+	UpdateLibraryQuestion(question LibraryQuestion) (*LibraryQuestion, error)
+	// Adds the library question to the survey under the given question ID, routed right
+	// after the question afterID or as the start question when afterID is empty, and
+	// saves the survey.
+	InsertIntoSurvey(surveyID, libraryID, questionID, afterID string, mode LibraryInsertMode) (*Survey, error)
+	// Lists the library updates the linked questions of the survey have not applied yet.
+	PendingUpdates(survey Survey) ([]LibraryUpdate, error)
+	// Applies the latest library version to the linked question, keeping its routing.
+	ApplyUpdate(survey *Survey, questionID string) error
+	// Lists the surveys with a linked question behind the latest library version.
+	SurveysToUpdate(libraryID string) ([]string, error)
+}
+
+type questionLibraryServiceImpl struct {
+	library       store.Datastorer[models.LibraryQuestion]
+	questions     store.Datastorer[models.Question]
+	surveyservice SurveyService
+}
+
+// Instantiate the `QuestionLibraryService`.
+func NewQuestionLibraryService(library store.Datastorer[models.LibraryQuestion], questions store.Datastorer[models.Question], surveyservice SurveyService) QuestionLibraryService {
+	return &questionLibraryServiceImpl{library: library, questions: questions, surveyservice: surveyservice}
+}
+
+func (s *questionLibraryServiceImpl) CreateLibraryQuestion(question LibraryQuestion) (*LibraryQuestion, error) {
+	if err := question.validate(); err != nil {
+		return nil, err
+	}
+
+	question.Version = 1
+	question.UpdatedAt = now()
+
+	created, err := s.library.Create(context.Background(), libraryQuestionToDTO(question))
+	if err != nil {
+		return nil, err
+	}
+
+	model, ok := created.(*models.LibraryQuestion)
+	if !ok {
+		return nil, fault.NewInternalError("unexpected library question model", fmt.Errorf("got %T", created))
+	}
+
+	question.ID = model.ID
+	return &question, nil
+}
+
+func (s *questionLibraryServiceImpl) GetLibraryQuestion(libraryID string) (*LibraryQuestion, error) {
+	id, err := strconv.Atoi(libraryID)
+	if err != nil {
+		return nil, fault.ErrNotFound
+	}
+
+	model, err := s.library.Get(context.Background(), fmt.Sprintf("SELECT %s FROM library_questions WHERE id = $1", libraryQuestionColumns), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return libraryQuestionFromModel(*model)
+}
+
+func (s *questionLibraryServiceImpl) ListLibraryQuestions(page, limit int) (*paginator.PaginatedResponse[LibraryQuestion], error) {
+	result, err := paginator.NewPaginator(s.library).PaginateQuery(context.Background(), fmt.Sprintf("SELECT %s FROM library_questions ORDER BY id", libraryQuestionColumns), nil, page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	questions := make([]LibraryQuestion, 0, len(result.Items))
+	for _, item := range result.Items {
+		question, err := libraryQuestionFromModel(item)
+		if err != nil {
+			return nil, err
+		}
+		questions = append(questions, *question)
+	}
+
+	return &paginator.PaginatedResponse[LibraryQuestion]{
+		Items:       questions,
+		CurrentPage: result.CurrentPage,
+		TotalPages:  result.TotalPages,
+		PrevPage:    result.PrevPage,
+		NextPage:    result.NextPage,
+		TotalItems:  result.TotalItems,
+	}, nil
+}
+
+func (s *questionLibraryServiceImpl) UpdateLibraryQuestion(question LibraryQuestion) (*LibraryQuestion, error) {
+	current, err := s.GetLibraryQuestion(question.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := question.validate(); err != nil {
+		return nil, err
+	}
+
+	question.Version = current.Version + 1
+	question.UpdatedAt = now()
+
+	id, _ := strconv.Atoi(question.ID)
+
+	if _, err := s.library.Update(context.Background(), id, libraryQuestionToDTO(question)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fault.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &question, nil
+}
+
+func (s *questionLibraryServiceImpl) InsertIntoSurvey(surveyID, libraryID, questionID, afterID string, mode LibraryInsertMode) (*Survey, error) {
+	if mode != InsertByReference && mode != InsertByCopy {
+		return nil, fmt.Errorf("unknown library insert mode %d", mode)
+	}
+
+	if !dslIdentifier.MatchString(questionID) {
+		return nil, fault.NewClientError(fmt.Sprintf("invalid question id %q", questionID), nil)
+	}
+
+	survey, err := s.surveyservice.GetSurvey(surveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if survey.hasTarget(questionID) {
+		return nil, fault.NewClientError(fmt.Sprintf("question %q already exists", questionID), nil)
+	}
+
+	libraryQuestion, err := s.GetLibraryQuestion(libraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	question := Question{
+		ID:      questionID,
+		Text:    libraryQuestion.Text,
+		Type:    libraryQuestion.Type,
+		Options: append([]string(nil), libraryQuestion.Options...),
+		Library: &LibraryLink{
+			QuestionID: libraryQuestion.ID,
+			Version:    libraryQuestion.Version,
+			Linked:     mode == InsertByReference,
+		},
+	}
+
+	questions := make(map[string]Question, len(survey.Questions)+1)
+	for id, q := range survey.Questions {
+		questions[id] = q
+	}
+
+	if afterID == "" {
+		// the previous start question follows the inserted one
+		if survey.StartID != "" {
+			question.Conditionals = []ConditionalNext{{Expression: "true", NextID: survey.StartID}}
+		}
+		survey.StartID = questionID
+	} else {
+		after, ok := questions[afterID]
+		if !ok {
+			return nil, fault.NewClientError(fmt.Sprintf("question %q does not exist", afterID), nil)
+		}
+
+		// the inserted question takes over the routing of the question it follows, the
+		// expressions still see the earlier answers
+		question.Conditionals = after.Conditionals
+		after.Conditionals = []ConditionalNext{{Expression: "true", NextID: questionID}}
+		questions[afterID] = after
+	}
+
+	questions[questionID] = question
+	survey.Questions = questions
+
+	return s.surveyservice.UpdateSurvey(*survey)
+}
+
+func (s *questionLibraryServiceImpl) PendingUpdates(survey Survey) ([]LibraryUpdate, error) {
+	var updates []LibraryUpdate
+
+	for _, id := range survey.OrderedQuestionIDs() {
+		question := survey.Questions[id]
+		if question.Library == nil || !question.Library.Linked {
+			continue
+		}
+
+		latest, err := s.GetLibraryQuestion(question.Library.QuestionID)
+		if err != nil {
+			if errors.Is(err, fault.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		if latest.Version > question.Library.Version {
+			updates = append(updates, LibraryUpdate{QuestionID: id, Current: question, Latest: *latest})
+		}
+	}
+
+	return updates, nil
+}
+
+func (s *questionLibraryServiceImpl) ApplyUpdate(survey *Survey, questionID string) error {
+	question, ok := survey.Questions[questionID]
+	if !ok {
+		return fault.NewClientError(fmt.Sprintf("question %q does not exist", questionID), nil)
+	}
+
+	if question.Library == nil || !question.Library.Linked {
+		return fault.NewClientError(fmt.Sprintf("question %q is not linked to the library", questionID), nil)
+	}
+
+	latest, err := s.GetLibraryQuestion(question.Library.QuestionID)
+	if err != nil {
+		return err
+	}
+
+	question.Text = latest.Text
+	question.Type = latest.Type
+	question.Options = append([]string(nil), latest.Options...)
+	question.Library = &LibraryLink{QuestionID: latest.ID, Version: latest.Version, Linked: true}
+
+	survey.Questions[questionID] = question
+	return nil
+}
+
+func (s *questionLibraryServiceImpl) SurveysToUpdate(libraryID string) ([]string, error) {
+	latest, err := s.GetLibraryQuestion(libraryID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.questions.Select(context.Background(), "SELECT DISTINCT survey_id FROM survey_questions WHERE library_id = $1 AND library_linked AND library_version < $2 ORDER BY survey_id", latest.ID, latest.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	surveyIDs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		surveyIDs = append(surveyIDs, row.SurveyID)
+	}
+
+	return surveyIDs, nil
+}
+
+// The question ID the library question is answered under in the combined responses.
+func LibraryQuestionKey(libraryID string) string {
+	return "library_" + libraryID
+}
+
+// Combines the answers of the library question across surveys.
+//
+// Each response keeps only the answer of the survey question coming from the library
+// question, re-keyed under `LibraryQuestionKey` so the analytics can run on the
+// combined responses as if they were from a single survey.
+func CombineLibraryResponses(libraryID string, surveys []Survey, responses []SurveyResponse) []SurveyResponse {
+	key := LibraryQuestionKey(libraryID)
+
+	// the local question ID of the library question, keyed by survey
+	local := make(map[string]string, len(surveys))
+	for _, survey := range surveys {
+		for id, question := range survey.Questions {
+			if question.Library != nil && question.Library.QuestionID == libraryID {
+				local[survey.ID] = id
+			}
+		}
+	}
+
+	var combined []SurveyResponse
+
+	for _, response := range responses {
+		questionID, ok := local[response.SurveyID]
+		if !ok {
+			continue
+		}
+
+		for _, answer := range response.Answers {
+			if answer.QuestionID != questionID {
+				continue
+			}
+
+			answer.QuestionID = key
+			combined = append(combined, SurveyResponse{
+				ID:           response.ID,
+				SurveyID:     response.SurveyID,
+				Answers:      []Answer{answer},
+				HiddenFields: response.HiddenFields,
+				Weight:       response.Weight,
+				CreatedAt:    response.CreatedAt,
+			})
+			break
+		}
+	}
+
+	return combined
+}
+
+func (q LibraryQuestion) validate() error {
+	if q.Text == "" {
+		return fault.NewClientError("library question text is required", nil)
+	}
+
+	if _, ok := questionTypeNames[q.Type]; !ok {
+		return fault.NewClientError(fmt.Sprintf("unknown question type %d", q.Type), nil)
+	}
+
+	return nil
+}
+
+func libraryQuestionToDTO(question LibraryQuestion) *models.LibraryQuestionDTO {
+	return &models.LibraryQuestionDTO{
+		Text:      question.Text,
+		Type:      question.Type.String(),
+		Options:   stringArray(question.Options),
+		Tags:      stringArray(question.Tags),
+		Version:   question.Version,
+		UpdatedAt: question.UpdatedAt,
+	}
+}
+
+func libraryQuestionFromModel(model models.LibraryQuestion) (*LibraryQuestion, error) {
+	questionType, err := ParseQuestionType(model.Type)
+	if err != nil {
+		return nil, fault.NewInternalError("invalid stored library question", err)
+	}
+
+	return &LibraryQuestion{
+		ID:        model.ID,
+		Text:      model.Text,
+		Type:      questionType,
+		Options:   model.Options,
+		Tags:      model.Tags,
+		Version:   model.Version,
+		UpdatedAt: model.UpdatedAt,
+	}, nil
+}
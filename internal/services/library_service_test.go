@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"math"
+	"testing"
+
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/store"
+)
+
+// In memory library store, only `Get` by id is supported.
+type memoryLibraryStore struct {
+	store.Datastorer[models.LibraryQuestion]
+	questions map[int]models.LibraryQuestion
+}
+
+func (m *memoryLibraryStore) Get(ctx context.Context, query string, args ...any) (*models.LibraryQuestion, error) {
+	question, ok := m.questions[args[0].(int)]
+	if !ok {
+		return nil, fault.ErrNotFound
+	}
+
+	return &question, nil
+}
+
+func TestQuestionLibrary_InsertAndUpdate(t *testing.T) {
+	library := &memoryLibraryStore{questions: map[int]models.LibraryQuestion{
+		7: {ID: "7", Text: "What is your age?", Type: "multiple_choice", Options: []string{"<18", "18-34", "35+"}, Version: 1},
+	}}
+	surveys := &memorySurveyService{surveys: map[string]Survey{"s1": definitionSurvey()}}
+	libraryservice := NewQuestionLibraryService(library, nil, surveys)
+
+	if _, err := libraryservice.InsertIntoSurvey("s1", "7", "age", "q1", InsertByReference); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := libraryservice.InsertIntoSurvey("s1", "7", "age", "", InsertByCopy); err == nil || !fault.IsClientError(err) {
+		t.Errorf("expected a client error inserting an existing question id, got %v", err)
+	}
+	if _, err := libraryservice.InsertIntoSurvey("s1", "7", "age2", "q9", InsertByCopy); err == nil || !fault.IsClientError(err) {
+		t.Errorf("expected a client error inserting after an unknown question, got %v", err)
+	}
+
+	survey, err := surveys.GetSurvey("s1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the age question is asked right after q1, which routes on as before
+	q1, age := survey.Questions["q1"], survey.Questions["age"]
+	if len(q1.Conditionals) != 1 || q1.Conditionals[0].NextID != "age" {
+		t.Errorf("expected q1 to route to the inserted question, got %+v", q1.Conditionals)
+	}
+	if len(age.Conditionals) != 2 || age.Conditionals[0].NextID != "q2" || age.Conditionals[1].NextID != "underage" {
+		t.Errorf("expected the inserted question to route like q1 did, got %+v", age.Conditionals)
+	}
+	if ending, ok := survey.EndingReached(SurveyResponse{Answers: []Answer{{QuestionID: "q1", Value: "no"}, {QuestionID: "age", Value: "<18"}}}); !ok || ending != "underage" {
+		t.Errorf("expected the underage ending to be reached through the inserted question, got %q", ending)
+	}
+
+	updates, err := libraryservice.PendingUpdates(*survey)
+	if err != nil || len(updates) != 0 {
+		t.Fatalf("expected no pending updates, got %v %v", updates, err)
+	}
+
+	library.questions[7] = models.LibraryQuestion{ID: "7", Text: "How old are you?", Type: "multiple_choice", Options: []string{"<18", "18-34", "35-54", "55+"}, Version: 2}
+
+	updates, err = libraryservice.PendingUpdates(*survey)
+	if err != nil || len(updates) != 1 || updates[0].QuestionID != "age" {
+		t.Fatalf("expected the age question to be offered the update, got %v %v", updates, err)
+	}
+
+	if err := libraryservice.ApplyUpdate(survey, "age"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	age = survey.Questions["age"]
+	if age.Text != "How old are you?" || len(age.Options) != 4 || age.Library.Version != 2 {
+		t.Errorf("expected the latest library version to be applied, got %+v", age)
+	}
+}
+
+func TestQuestionLibrary_InsertAsStart(t *testing.T) {
+	library := &memoryLibraryStore{questions: map[int]models.LibraryQuestion{
+		7: {ID: "7", Text: "Do you consent?", Type: "multiple_choice", Options: []string{"yes", "no"}, Version: 1},
+	}}
+	surveys := &memorySurveyService{surveys: map[string]Survey{"s1": definitionSurvey()}}
+	libraryservice := NewQuestionLibraryService(library, nil, surveys)
+
+	survey, err := libraryservice.InsertIntoSurvey("s1", "7", "consent", "", InsertByCopy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	consent := survey.Questions["consent"]
+	if survey.StartID != "consent" || len(consent.Conditionals) != 1 || consent.Conditionals[0].NextID != "q1" {
+		t.Errorf("expected the inserted question to lead to the previous start question, got %q %+v", survey.StartID, consent.Conditionals)
+	}
+	if consent.Library == nil || consent.Library.Linked {
+		t.Errorf("expected a copy keeping track of the library question, got %+v", consent.Library)
+	}
+}
+
+func TestLibraryQuestionToDTO_NoOptions(t *testing.T) {
+	dto := libraryQuestionToDTO(LibraryQuestion{Text: "Anything else?", Type: Text})
+
+	for name, column := range map[string]driver.Valuer{"options": dto.Options, "tags": dto.Tags} {
+		value, err := column.Value()
+		if err != nil || value != "{}" {
+			t.Errorf("expected an empty array for the %s, got %#v %v", name, value, err)
+		}
+	}
+}
+
+func TestCombineLibraryResponses(t *testing.T) {
+	link := &LibraryLink{QuestionID: "7", Version: 1}
+
+	surveys := []Survey{
+		{ID: "s1", Questions: map[string]Question{"age": {ID: "age", Library: link}}},
+		{ID: "s2", Questions: map[string]Question{"q3": {ID: "q3", Library: link}}},
+	}
+
+	responses := []SurveyResponse{
+		{ID: "r1", SurveyID: "s1", Answers: []Answer{{QuestionID: "age", Value: "18-34"}, {QuestionID: "q2", Value: "x"}}},
+		{ID: "r2", SurveyID: "s2", Answers: []Answer{{QuestionID: "q3", Value: "35+"}}},
+		{ID: "r3", SurveyID: "s3", Answers: []Answer{{QuestionID: "age", Value: "<18"}}},
+	}
+
+	combined := CombineLibraryResponses("7", surveys, responses)
+	if len(combined) != 2 {
+		t.Fatalf("expected 2 combined responses, got %+v", combined)
+	}
+
+	for _, response := range combined {
+		if len(response.Answers) != 1 || response.Answers[0].QuestionID != LibraryQuestionKey("7") {
+			t.Errorf("expected a single answer keyed by the library question, got %+v", response.Answers)
+		}
+	}
+}
+
+func TestCombineLibraryResponses_Weighted(t *testing.T) {
+	link := &LibraryLink{QuestionID: "7", Version: 1}
+
+	surveys := []Survey{
+		{ID: "s1", Questions: map[string]Question{"age": {ID: "age", Library: link}}},
+		{ID: "s2", Questions: map[string]Question{"q3": {ID: "q3", Library: link}}},
+	}
+
+	responses := []SurveyResponse{
+		{ID: "r1", SurveyID: "s1", Answers: []Answer{{QuestionID: "age", Value: "18-34"}}},
+		{ID: "r2", SurveyID: "s2", Weight: 3, HiddenFields: map[string]string{"source": "email"}, Answers: []Answer{{QuestionID: "q3", Value: "35+"}}},
+	}
+
+	combined := CombineLibraryResponses("7", surveys, responses)
+	if len(combined) != 2 {
+		t.Fatalf("expected 2 combined responses, got %+v", combined)
+	}
+
+	if combined[1].Weight != 3 || combined[1].HiddenFields["source"] != "email" {
+		t.Errorf("expected the weight and hidden fields to be kept, got %+v", combined[1])
+	}
+	// (1 + 3)^2 / (1 + 9)
+	if got := EffectiveSampleSize(combined); math.Abs(got-1.6) > 1e-9 {
+		t.Errorf("expected an effective sample size of 1.6, got %v", got)
+	}
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/workerpool"
+)
+
+// The lifecycle state of the survey.
+type SurveyStatus int
+
+const (
+	SurveyDraft SurveyStatus = iota + 1
+	SurveyScheduled
+	SurveyOpen
+	SurveyPaused
+	SurveyClosed
+	SurveyArchived
+)
+
+var surveyStatusNames = map[SurveyStatus]string{
+	SurveyDraft:     "draft",
+	SurveyScheduled: "scheduled",
+	SurveyOpen:      "open",
+	SurveyPaused:    "paused",
+	SurveyClosed:    "closed",
+	SurveyArchived:  "archived",
+}
+
+// The allowed transitions keyed by the current status.
+var surveyTransitions = map[SurveyStatus][]SurveyStatus{
+	SurveyDraft:     {SurveyScheduled, SurveyOpen, SurveyArchived},
+	SurveyScheduled: {SurveyDraft, SurveyOpen, SurveyClosed, SurveyArchived},
+	SurveyOpen:      {SurveyPaused, SurveyClosed},
+	SurveyPaused:    {SurveyOpen, SurveyClosed},
+	SurveyClosed:    {SurveyOpen, SurveyArchived},
+	SurveyArchived:  {},
+}
+
+func (s SurveyStatus) String() string {
+	if name, ok := surveyStatusNames[s]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("SurveyStatus(%d)", int(s))
+}
+
+// Parses the name of the survey status.
+func ParseSurveyStatus(name string) (SurveyStatus, error) {
+	for s, n := range surveyStatusNames {
+		if n == name {
+			return s, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown survey status %q", name)
+}
+
+// Whether the survey can move from the status to the other.
+func (s SurveyStatus) CanTransitionTo(to SurveyStatus) bool {
+	for _, allowed := range surveyTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether the survey accepts answers at the given time.
+//
+// The dates and the response limit are checked too so a late or dropped
+// scheduled job never keeps the survey open.
+func (s Survey) IsOpen(at time.Time) bool {
+	if s.Status != SurveyOpen {
+		return false
+	}
+
+	if !s.OpensAt.IsZero() && at.Before(s.OpensAt) {
+		return false
+	}
+
+	if !s.ClosesAt.IsZero() && !at.Before(s.ClosesAt) {
+		return false
+	}
+
+	if s.MaxResponses > 0 && s.ResponseCount >= s.MaxResponses {
+		return false
+	}
+
+	return true
+}
+
+// Moves the survey to the given status, invalid transitions are client errors.
+func (s *Survey) Transition(to SurveyStatus) error {
+	if !s.Status.CanTransitionTo(to) {
+		return fault.NewClientError(fmt.Sprintf("cannot move survey from %s to %s", s.Status, to), nil)
+	}
+
+	if to == SurveyScheduled && s.OpensAt.IsZero() {
+		return fault.NewClientError("cannot schedule survey without an opening date", nil)
+	}
+
+	if !s.OpensAt.IsZero() && !s.ClosesAt.IsZero() && !s.ClosesAt.After(s.OpensAt) {
+		return fault.NewClientError("survey closing date must be after its opening date", nil)
+	}
+
+	s.Status = to
+	return nil
+}
+
+// Handles the status of the surveys including the scheduled open and close.
+type SurveyLifecycleService interface {
+	// Moves the survey to the given status.
+	Transition(surveyID string, to SurveyStatus) (*Survey, error)
+	// Schedules the opening and closing of the survey at its configured dates.
+	Schedule(survey Survey) error
+	// Closes the survey once it reached its maximum responses.
+	OnResponseSaved(surveyID string) error
+}
+
+type surveyLifecycleServiceImpl struct {
+	surveyservice SurveyService
+	jobQueue      *workerpool.WorkerPool
+
+	mu sync.Mutex
+	// The cancels of the scheduled jobs keyed by survey ID.
+	scheduled map[string][]func() bool
+}
+
+// Instantiate the `SurveyLifecycleService`.
+//
+// The surveys are closed on reaching their maximum responses as the responses are
+// saved through the response service, and rescheduled as their dates are updated.
+func NewSurveyLifecycleService(surveyservice SurveyService, responseservice SurveyResponseService, jobQueue *workerpool.WorkerPool) SurveyLifecycleService {
+	s := &surveyLifecycleServiceImpl{surveyservice: surveyservice, jobQueue: jobQueue, scheduled: make(map[string][]func() bool)}
+
+	if surveyservice != nil {
+		surveyservice.SubscribeSurveyUpdated(func(ctx context.Context, previous, survey Survey) {
+			if previous.OpensAt.Equal(survey.OpensAt) && previous.ClosesAt.Equal(survey.ClosesAt) {
+				return
+			}
+
+			if err := s.Schedule(survey); err != nil {
+				log.Printf("Cannot reschedule survey %s: %v", survey.ID, err)
+			}
+		})
+	}
+
+	if responseservice != nil {
+		responseservice.SubscribeResponseCompleted(func(ctx context.Context, response SurveyResponse) {
+			if err := s.OnResponseSaved(response.SurveyID); err != nil {
+				log.Printf("Cannot close survey %s on its maximum responses: %v", response.SurveyID, err)
+			}
+		})
+	}
+
+	return s
+}
+
+func (s *surveyLifecycleServiceImpl) Transition(surveyID string, to SurveyStatus) (*Survey, error) {
+	survey, err := s.surveyservice.GetSurvey(surveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := survey.Transition(to); err != nil {
+		return nil, err
+	}
+
+	if err := s.surveyservice.UpdateSurveyStatus(surveyID, to); err != nil {
+		return nil, err
+	}
+
+	if to == SurveyScheduled || to == SurveyOpen {
+		if err := s.Schedule(*survey); err != nil {
+			return nil, err
+		}
+	} else {
+		s.unschedule(survey.ID)
+	}
+
+	return survey, nil
+}
+
+func (s *surveyLifecycleServiceImpl) Schedule(survey Survey) error {
+	if survey.Status == SurveyScheduled && survey.OpensAt.IsZero() {
+		return fault.NewClientError("cannot schedule survey without an opening date", nil)
+	}
+
+	// the jobs of the previous dates are replaced
+	s.unschedule(survey.ID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if survey.Status == SurveyScheduled {
+		opensAt := survey.OpensAt
+		s.scheduled[survey.ID] = append(s.scheduled[survey.ID], s.jobQueue.SubmitAt(opensAt, s.job(survey.ID, func(current *Survey) bool {
+			// skip when the survey was rescheduled or moved in the meantime
+			return current.Status == SurveyScheduled && current.OpensAt.Equal(opensAt)
+		}, SurveyOpen)))
+	}
+
+	if (survey.Status == SurveyScheduled || survey.Status == SurveyOpen) && !survey.ClosesAt.IsZero() {
+		closesAt := survey.ClosesAt
+		s.scheduled[survey.ID] = append(s.scheduled[survey.ID], s.jobQueue.SubmitAt(closesAt, s.job(survey.ID, func(current *Survey) bool {
+			// pausing cancels the job so only the open surveys are closed
+			return current.Status == SurveyOpen && current.ClosesAt.Equal(closesAt)
+		}, SurveyClosed)))
+	}
+
+	return nil
+}
+
+// Cancels the scheduled jobs of the survey.
+func (s *surveyLifecycleServiceImpl) unschedule(surveyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cancel := range s.scheduled[surveyID] {
+		cancel()
+	}
+	delete(s.scheduled, surveyID)
+}
+
+func (s *surveyLifecycleServiceImpl) OnResponseSaved(surveyID string) error {
+	survey, err := s.surveyservice.GetSurvey(surveyID)
+	if err != nil {
+		return err
+	}
+
+	if survey.MaxResponses == 0 || survey.ResponseCount < survey.MaxResponses || survey.Status != SurveyOpen {
+		return nil
+	}
+
+	if err := survey.Transition(SurveyClosed); err != nil {
+		return err
+	}
+
+	return s.surveyservice.UpdateSurveyStatus(surveyID, SurveyClosed)
+}
+
+// The scheduled job moving the survey to the given status when it still applies.
+func (s *surveyLifecycleServiceImpl) job(surveyID string, applies func(current *Survey) bool, to SurveyStatus) workerpool.Job {
+	return workerpool.WithRetry(3, 500*time.Millisecond, func() error {
+		current, err := s.surveyservice.GetSurvey(surveyID)
+		if err != nil {
+			return err
+		}
+
+		if !applies(current) {
+			log.Printf("Skipping scheduled %s of survey %s", to, surveyID)
+			return nil
+		}
+
+		if err := current.Transition(to); err != nil {
+			return err
+		}
+
+		return s.surveyservice.UpdateSurveyStatus(surveyID, to)
+	})
+}
+
+// Schedules the jobs of every scheduled or open survey, typically on startup.
+func ScheduleSurveys(ctx context.Context, lifecycle SurveyLifecycleService, surveys []Survey) error {
+	for _, survey := range surveys {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := lifecycle.Schedule(survey); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
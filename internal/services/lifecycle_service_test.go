@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/workerpool"
+)
+
+// In memory `SurveyService` for the lifecycle tests.
+type memorySurveyService struct {
+	SurveyService
+	mu       sync.Mutex
+	surveys  map[string]Survey
+	handlers []SurveyUpdatedHandler
+}
+
+func (m *memorySurveyService) GetSurvey(surveyID string) (*Survey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	survey, ok := m.surveys[surveyID]
+	if !ok {
+		return nil, fault.ErrNotFound
+	}
+
+	return &survey, nil
+}
+
+func (m *memorySurveyService) UpdateSurveyStatus(surveyID string, status SurveyStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	survey, ok := m.surveys[surveyID]
+	if !ok {
+		return fault.ErrNotFound
+	}
+
+	survey.Status = status
+	m.surveys[surveyID] = survey
+	return nil
+}
+
+func (m *memorySurveyService) UpdateSurvey(survey Survey) (*Survey, error) {
+	if err := survey.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	previous, ok := m.surveys[survey.ID]
+	if !ok {
+		m.mu.Unlock()
+		return nil, fault.ErrNotFound
+	}
+
+	survey.Status = previous.Status
+	m.surveys[survey.ID] = survey
+	handlers := m.handlers
+	m.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(context.Background(), previous, survey)
+	}
+
+	return &survey, nil
+}
+
+func (m *memorySurveyService) SubscribeSurveyUpdated(handler SurveyUpdatedHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlers = append(m.handlers, handler)
+}
+
+func (m *memorySurveyService) status(surveyID string) SurveyStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.surveys[surveyID].Status
+}
+
+func TestSurveyTransition(t *testing.T) {
+	tests := []struct {
+		name        string
+		from        SurveyStatus
+		to          SurveyStatus
+		opensAt     time.Time
+		expectError bool
+	}{
+		{name: "Draft to open", from: SurveyDraft, to: SurveyOpen},
+		{name: "Draft to scheduled", from: SurveyDraft, to: SurveyScheduled, opensAt: time.Now().Add(time.Hour)},
+		{name: "Schedule without date", from: SurveyDraft, to: SurveyScheduled, expectError: true},
+		{name: "Open to paused", from: SurveyOpen, to: SurveyPaused},
+		{name: "Draft to closed", from: SurveyDraft, to: SurveyClosed, expectError: true},
+		{name: "Archived to open", from: SurveyArchived, to: SurveyOpen, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			survey := Survey{ID: "s1", Status: tt.from, OpensAt: tt.opensAt}
+
+			err := survey.Transition(tt.to)
+			if tt.expectError {
+				if err == nil || !fault.IsClientError(err) {
+					t.Errorf("expected a client error, got %v", err)
+				}
+				if survey.Status != tt.from {
+					t.Errorf("expected status to stay %s, got %s", tt.from, survey.Status)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if survey.Status != tt.to {
+				t.Errorf("expected status %s, got %s", tt.to, survey.Status)
+			}
+		})
+	}
+}
+
+func TestSurveyIsOpen(t *testing.T) {
+	at := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	if (Survey{Status: SurveyPaused}).IsOpen(at) {
+		t.Error("expected paused survey to be closed")
+	}
+	if !(Survey{Status: SurveyOpen}).IsOpen(at) {
+		t.Error("expected open survey to be open")
+	}
+	if (Survey{Status: SurveyOpen, OpensAt: at.Add(time.Hour)}).IsOpen(at) {
+		t.Error("expected survey before its opening date to be closed")
+	}
+	if (Survey{Status: SurveyOpen, ClosesAt: at}).IsOpen(at) {
+		t.Error("expected survey past its closing date to be closed")
+	}
+	if (Survey{Status: SurveyOpen, MaxResponses: 10, ResponseCount: 10}).IsOpen(at) {
+		t.Error("expected survey that reached its max responses to be closed")
+	}
+}
+
+func TestAnswerQuestion_SurveyNotOpen(t *testing.T) {
+	responseservice := NewSurveyResponseService(NewSurveyService(nil, nil), nil)
+
+	survey := Survey{
+		ID:        "s1",
+		StartID:   "q1",
+		Status:    SurveyPaused,
+		Questions: map[string]Question{"q1": {ID: "q1", Type: Text}},
+	}
+
+	if _, err := responseservice.StartSession("sess1", survey); err == nil || !fault.IsClientError(err) {
+		t.Errorf("expected a client error starting a session, got %v", err)
+	}
+
+	session := &SurveySession{ID: "sess1", SurveyID: "s1", Answers: make(map[string]any), CurrentID: "q1"}
+	if _, err := responseservice.AnswerQuestion(session, "q1", "answer", survey); err == nil || !fault.IsClientError(err) {
+		t.Errorf("expected a client error answering, got %v", err)
+	}
+}
+
+func TestSurveyLifecycle_ScheduledOpenAndClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pool := workerpool.NewWorkerPool(ctx, 1, 10)
+
+	opensAt := time.Now().Add(20 * time.Millisecond)
+	closesAt := opensAt.Add(40 * time.Millisecond)
+
+	surveys := &memorySurveyService{surveys: map[string]Survey{
+		"s1": {ID: "s1", Status: SurveyDraft, OpensAt: opensAt, ClosesAt: closesAt},
+	}}
+	lifecycle := NewSurveyLifecycleService(surveys, nil, pool)
+
+	if _, err := lifecycle.Transition("s1", SurveyScheduled); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	waitForStatus(t, surveys, "s1", SurveyOpen)
+	waitForStatus(t, surveys, "s1", SurveyClosed)
+}
+
+func TestSurveyLifecycle_MaxResponses(t *testing.T) {
+	surveys := &memorySurveyService{surveys: map[string]Survey{
+		"s1": {ID: "s1", Status: SurveyOpen, MaxResponses: 2, ResponseCount: 1},
+	}}
+	lifecycle := NewSurveyLifecycleService(surveys, nil, nil)
+
+	if err := lifecycle.OnResponseSaved("s1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := surveys.status("s1"); got != SurveyOpen {
+		t.Fatalf("expected survey to stay open, got %s", got)
+	}
+
+	surveys.surveys["s1"] = Survey{ID: "s1", Status: SurveyOpen, MaxResponses: 2, ResponseCount: 2}
+
+	if err := lifecycle.OnResponseSaved("s1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := surveys.status("s1"); got != SurveyClosed {
+		t.Errorf("expected survey to be closed, got %s", got)
+	}
+}
+
+func TestSurveyLifecycle_ClosesOnSavedResponse(t *testing.T) {
+	surveys := &memorySurveyService{surveys: map[string]Survey{
+		"s1": {ID: "s1", StartID: "q1", Status: SurveyOpen, MaxResponses: 1, Questions: map[string]Question{
+			"q1": {ID: "q1", Type: Text},
+		}},
+	}}
+	responseservice := NewSurveyResponseService(surveys, &memoryResponseStore{saved: make(map[string]*models.SurveyResponseDTO)})
+
+	// the saved responses are counted before the lifecycle handler runs
+	responseservice.SubscribeResponseCompleted(func(ctx context.Context, response SurveyResponse) {
+		surveys.mu.Lock()
+		defer surveys.mu.Unlock()
+
+		survey := surveys.surveys[response.SurveyID]
+		survey.ResponseCount++
+		surveys.surveys[response.SurveyID] = survey
+	})
+	NewSurveyLifecycleService(surveys, responseservice, nil)
+
+	response := SurveyResponse{ID: "r1", SurveyID: "s1", Answers: []Answer{{QuestionID: "q1", Value: "hi"}}}
+	if err := responseservice.SaveResponse(response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := surveys.status("s1"); got != SurveyClosed {
+		t.Errorf("expected survey to be closed, got %s", got)
+	}
+}
+
+func TestSurveyLifecycle_RescheduledOnUpdate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	pool := workerpool.NewWorkerPool(ctx, 1, 10)
+
+	survey := Survey{ID: "s1", StartID: "q1", Status: SurveyScheduled, OpensAt: time.Now().Add(time.Hour), Questions: map[string]Question{
+		"q1": {ID: "q1", Type: Text},
+	}}
+	surveys := &memorySurveyService{surveys: map[string]Survey{"s1": survey}}
+	lifecycle := NewSurveyLifecycleService(surveys, nil, pool)
+
+	if err := lifecycle.Schedule(survey); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	survey.OpensAt = time.Now().Add(20 * time.Millisecond)
+	if _, err := surveys.UpdateSurvey(survey); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	waitForStatus(t, surveys, "s1", SurveyOpen)
+}
+
+func TestSurveyLifecycle_ScheduleAfterShutdown(t *testing.T) {
+	pool := workerpool.NewWorkerPool(context.Background(), 1, 1)
+	pool.Shutdown(context.Background())
+
+	surveys := &memorySurveyService{surveys: map[string]Survey{}}
+	lifecycle := NewSurveyLifecycleService(surveys, nil, pool)
+
+	survey := Survey{ID: "s1", Status: SurveyScheduled, OpensAt: time.Now().Add(time.Hour)}
+	if err := lifecycle.Schedule(survey); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// rescheduling cancels the jobs scheduled
+	if err := lifecycle.Schedule(survey); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func waitForStatus(t *testing.T, surveys *memorySurveyService, surveyID string, status SurveyStatus) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if surveys.status(surveyID) == status {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("expected survey %s to be %s, got %s", surveyID, status, surveys.status(surveyID))
+}
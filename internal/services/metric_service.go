@@ -0,0 +1,292 @@
+package services
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+// NOTE: the built-in metrics are configured against a single question, the custom
+// ones are expr-lang expressions over all the answers e.g.
+//
+//	count(responses, .csat >= 4) / len(responses) * 100
+//
+// where `responses` holds one map of the answers keyed by question ID per response
+// and `weights` the weight of each response in the same order.
+
+// A score computed over a set of responses.
+type Metric interface {
+	// The name the metric is reported under.
+	Name() string
+	Compute(responses []SurveyResponse) (MetricResult, error)
+}
+
+// The value of a metric.
+type MetricResult struct {
+	Name  string
+	Value float64
+	// The responses the value is computed over.
+	Responses int
+	// The responses without an answer to the question.
+	Missing int
+	// The answers the metric cannot score.
+	Invalid int
+	// The sum of the weights of the responses the value is computed over.
+	Weighted float64
+}
+
+// Computes the metrics over the same responses, in order.
+func ComputeMetrics(responses []SurveyResponse, metrics ...Metric) ([]MetricResult, error) {
+	results := make([]MetricResult, 0, len(metrics))
+
+	for _, metric := range metrics {
+		result, err := metric.Compute(responses)
+		if err != nil {
+			return nil, fmt.Errorf("metric %q: %w", metric.Name(), err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+type npsMetric struct {
+	questionID string
+	options    NPSOptions
+}
+
+// Instantiate the NPS `Metric`, see `ComputeNPS`.
+func NewNPSMetric(questionID string, options NPSOptions) Metric {
+	return &npsMetric{questionID: questionID, options: options}
+}
+
+func (m *npsMetric) Name() string {
+	return "nps"
+}
+
+func (m *npsMetric) Compute(responses []SurveyResponse) (MetricResult, error) {
+	result := ComputeNPS(responses, m.questionID, m.options)
+
+	return MetricResult{
+		Name:      m.Name(),
+		Value:     result.Score,
+		Responses: result.TotalSurvey,
+		Missing:   result.Missing,
+		Invalid:   result.Invalid,
+		Weighted:  result.WeightedTotal,
+	}, nil
+}
+
+type meanMetric struct {
+	name       string
+	questionID string
+}
+
+// Instantiate the `Metric` averaging the numeric answers to the question.
+func NewMeanMetric(questionID string) Metric {
+	return &meanMetric{name: "mean_" + questionID, questionID: questionID}
+}
+
+// Instantiate the Customer Effort Score `Metric`, the mean of the effort rating.
+func NewCESMetric(questionID string) Metric {
+	return &meanMetric{name: "ces", questionID: questionID}
+}
+
+func (m *meanMetric) Name() string {
+	return m.name
+}
+
+func (m *meanMetric) Compute(responses []SurveyResponse) (MetricResult, error) {
+	result := MetricResult{Name: m.Name()}
+
+	var sum float64
+	for _, response := range responses {
+		answer, ok := response.answer(m.questionID)
+		if !ok || answer.Value == nil {
+			result.Missing++
+			continue
+		}
+
+		value, ok := numericValue(answer.Value)
+		if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+			result.Invalid++
+			continue
+		}
+
+		sum += value * response.weight()
+		result.Weighted += response.weight()
+		result.Responses++
+	}
+
+	if result.Weighted > 0 {
+		result.Value = sum / result.Weighted
+	}
+
+	return result, nil
+}
+
+type boxMetric struct {
+	name       string
+	questionID string
+	// The points counted in the box, inclusive.
+	low, high int
+	min, max  int
+}
+
+// Instantiate the `Metric` of the percentage of answers in the top points of the rating scale.
+func NewTopBoxMetric(question Question, boxes int) (Metric, error) {
+	return newBoxMetric(fmt.Sprintf("top_%d_box_%s", boxes, question.ID), question, boxes, true)
+}
+
+// Instantiate the `Metric` of the percentage of answers in the bottom points of the rating scale.
+func NewBottomBoxMetric(question Question, boxes int) (Metric, error) {
+	return newBoxMetric(fmt.Sprintf("bottom_%d_box_%s", boxes, question.ID), question, boxes, false)
+}
+
+// Instantiate the Customer Satisfaction `Metric`, the top-2-box percentage of the satisfaction rating.
+func NewCSATMetric(question Question) (Metric, error) {
+	return newBoxMetric("csat", question, 2, true)
+}
+
+func newBoxMetric(name string, question Question, boxes int, top bool) (Metric, error) {
+	min, max, err := question.ScaleBounds()
+	if err != nil {
+		return nil, fault.NewClientError("invalid metric question", err)
+	}
+
+	if boxes < 1 || boxes > max-min+1 {
+		return nil, fault.NewClientError(fmt.Sprintf("cannot take %d boxes out of a %d to %d scale", boxes, min, max), nil)
+	}
+
+	metric := &boxMetric{name: name, questionID: question.ID, min: min, max: max}
+	if top {
+		metric.low, metric.high = max-boxes+1, max
+	} else {
+		metric.low, metric.high = min, min+boxes-1
+	}
+
+	return metric, nil
+}
+
+func (m *boxMetric) Name() string {
+	return m.name
+}
+
+func (m *boxMetric) Compute(responses []SurveyResponse) (MetricResult, error) {
+	result := MetricResult{Name: m.Name()}
+
+	var inBox float64
+	for _, response := range responses {
+		answer, ok := response.answer(m.questionID)
+		if !ok || answer.Value == nil {
+			result.Missing++
+			continue
+		}
+
+		value, ok := numericValue(answer.Value)
+		if !ok || value != math.Trunc(value) || value < float64(m.min) || value > float64(m.max) {
+			result.Invalid++
+			continue
+		}
+
+		if value >= float64(m.low) && value <= float64(m.high) {
+			inBox += response.weight()
+		}
+		result.Weighted += response.weight()
+		result.Responses++
+	}
+
+	if result.Weighted > 0 {
+		result.Value = inBox / result.Weighted * 100
+	}
+
+	return result, nil
+}
+
+type expressionMetric struct {
+	name    string
+	program *vm.Program
+}
+
+// Instantiate a team-defined `Metric` out of an expr-lang expression returning a number.
+//
+// The expression is compiled once, it is evaluated against `responses`, the answers of
+// each response keyed by question ID, and `weights`, the weight of each response.
+// A response without answer to a question yields nil.
+func NewExpressionMetric(name, expression string) (Metric, error) {
+	if !dslIdentifier.MatchString(name) {
+		return nil, fault.NewClientError(fmt.Sprintf("invalid metric name %q", name), nil)
+	}
+
+	program, err := expr.Compile(expression, expr.Env(metricEnv(nil)), expr.AsFloat64())
+	if err != nil {
+		return nil, fault.NewClientError("invalid metric expression", err)
+	}
+
+	return &expressionMetric{name: name, program: program}, nil
+}
+
+func (m *expressionMetric) Name() string {
+	return m.name
+}
+
+func (m *expressionMetric) Compute(responses []SurveyResponse) (MetricResult, error) {
+	output, err := expr.Run(m.program, metricEnv(responses))
+	if err != nil {
+		return MetricResult{}, err
+	}
+
+	value, ok := output.(float64)
+	if !ok {
+		return MetricResult{}, fmt.Errorf("expression returned %T instead of a number", output)
+	}
+
+	result := MetricResult{Name: m.Name(), Value: value, Responses: len(responses)}
+	for _, response := range responses {
+		result.Weighted += response.weight()
+	}
+
+	return result, nil
+}
+
+func metricEnv(responses []SurveyResponse) map[string]any {
+	answers := make([]map[string]any, 0, len(responses))
+	weights := make([]float64, 0, len(responses))
+
+	for _, response := range responses {
+		values := make(map[string]any, len(response.Answers))
+		for _, answer := range response.Answers {
+			if _, ok := values[answer.QuestionID]; !ok {
+				values[answer.QuestionID] = answer.Value
+			}
+		}
+		answers = append(answers, values)
+		weights = append(weights, response.weight())
+	}
+
+	return map[string]any{"responses": answers, "weights": weights}
+}
+
+// The metric the template is designed for.
+func (t SurveyTemplate) Metric(survey Survey) (Metric, error) {
+	questionID := t.ScoreQuestionID()
+
+	question, ok := survey.Questions[questionID]
+	if !ok {
+		return nil, fault.NewClientError(fmt.Sprintf("survey has no %q question", questionID), nil)
+	}
+
+	switch t {
+	case TemplateNPS, TemplateENPS:
+		return NewNPSMetric(questionID, NPSOptions{}), nil
+	case TemplateCSAT:
+		return NewCSATMetric(question)
+	case TemplateCES:
+		return NewCESMetric(questionID), nil
+	default:
+		return nil, fmt.Errorf("unknown survey template %d", t)
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+func TestComputeMetrics(t *testing.T) {
+	survey, err := NewSurveyFromTemplate(TemplateCSAT, TemplateParams{CompanyName: "Acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	question := survey.Questions["csat"]
+
+	csat, err := TemplateCSAT.Metric(*survey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bottom, err := NewBottomBoxMetric(question, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	custom, err := NewExpressionMetric("unhappy", `count(responses, .csat != nil && .csat <= 2)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 2 in the top 2 boxes out of 5 valid scores, 1 missing and 1 invalid
+	responses := answerResponses("csat", 5, 4, 3, 1.0, 2, nil, 9)
+
+	results, err := ComputeMetrics(responses, csat, bottom, NewMeanMetric("csat"), custom)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if results[0].Name != "csat" || results[0].Value != 40 || results[0].Responses != 5 || results[0].Missing != 1 || results[0].Invalid != 1 {
+		t.Errorf("unexpected csat %+v", results[0])
+	}
+	if results[1].Value != 20 {
+		t.Errorf("expected 20%% in the bottom box, got %+v", results[1])
+	}
+	// the mean accepts any number, 9 included
+	if math.Abs(results[2].Value-24.0/6) > 1e-9 {
+		t.Errorf("unexpected mean %+v", results[2])
+	}
+	if results[3].Value != 2 {
+		t.Errorf("expected the custom metric to count 2 unhappy respondents, got %+v", results[3])
+	}
+}
+
+func TestNewExpressionMetric_Invalid(t *testing.T) {
+	if _, err := NewExpressionMetric("broken", `count(responses,`); !fault.IsClientError(err) {
+		t.Errorf("expected a client error for an invalid expression, got %v", err)
+	}
+
+	if _, err := NewTopBoxMetric(Question{ID: "q1", Type: Text}, 2); !fault.IsClientError(err) {
+		t.Errorf("expected a client error for a question without scale, got %v", err)
+	}
+}
@@ -1,10 +1,20 @@
 package services
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+)
 
 // NOTE: the formula for determining the NPS
 // NPS = %Promoters − %Detractors
 
+const (
+	// The lowest rating of a promoter.
+	NPSPromoterMin = 9
+	// The lowest rating of a passive, anything below is a detractor.
+	NPSPassiveMin = 7
+)
+
 type NPS struct {
 	// The total of surveyed people
 	TotalSurvey int
@@ -32,3 +42,185 @@ func (n *NPS) CalculateNPS() (int, error) {
 
 	return int(promoterCalc - detractorCalc), nil
 }
+
+// The group a 0-10 rating falls in.
+type NPSCategory int
+
+const (
+	Detractor NPSCategory = iota + 1
+	Passive
+	Promoter
+)
+
+var npsCategoryNames = map[NPSCategory]string{
+	Detractor: "detractor",
+	Passive:   "passive",
+	Promoter:  "promoter",
+}
+
+func (c NPSCategory) String() string {
+	if name, ok := npsCategoryNames[c]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("NPSCategory(%d)", int(c))
+}
+
+// Classifies the answer, false when it is not a whole number from 0 to 10.
+func ClassifyNPS(value any) (NPSCategory, bool) {
+	score, ok := numericValue(value)
+	if !ok || score != math.Trunc(score) || score < 0 || score > 10 {
+		return 0, false
+	}
+
+	switch {
+	case score >= NPSPromoterMin:
+		return Promoter, true
+	case score >= NPSPassiveMin:
+		return Passive, true
+	default:
+		return Detractor, true
+	}
+}
+
+// How the computed NPS and percentages are rounded.
+type NPSRounding int
+
+const (
+	// Rounds half away from zero, the default.
+	RoundHalfUp NPSRounding = iota + 1
+	// Rounds half to even.
+	RoundHalfEven
+	// Drops the extra decimals like `CalculateNPS` does.
+	RoundTruncate
+	// Keeps the float as computed, the precision is ignored.
+	RoundNone
+)
+
+// The options of `ComputeNPS`.
+type NPSOptions struct {
+	// The number of decimals kept, 0 rounds to whole points.
+	Precision int
+	// Defaults to `RoundHalfUp` when zero.
+	Rounding NPSRounding
+}
+
+func (o NPSOptions) round(value float64) float64 {
+	if o.Rounding == RoundNone {
+		return value
+	}
+
+	scale := math.Pow(10, float64(o.Precision))
+
+	switch o.Rounding {
+	case RoundHalfEven:
+		return math.RoundToEven(value*scale) / scale
+	case RoundTruncate:
+		return math.Trunc(value*scale) / scale
+	default:
+		return math.Round(value*scale) / scale
+	}
+}
+
+// The NPS computed from the raw responses.
+type NPSResult struct {
+	// The counts of the valid scores, `TotalSurvey` is the number of valid scores.
+	NPS
+	// The responses without an answer to the question.
+	Missing int
+	// The answers that are not a whole number from 0 to 10.
+	Invalid int
+
+	// The sums of the weights of the valid scores, the counts when unweighted.
+	WeightedTotal      float64
+	WeightedPromoters  float64
+	WeightedPassives   float64
+	WeightedDetractors float64
+	// Kish's effective sample size of the valid scores.
+	EffectiveSampleSize float64
+
+	// Out of the weighted counts.
+	Score             float64
+	PromotersPercent  float64
+	PassivesPercent   float64
+	DetractorsPercent float64
+}
+
+// Computes the NPS out of the answers to the 0-10 question.
+//
+// Missing and invalid answers are counted apart and left out of the score,
+// a response answering the question more than once only counts its first answer.
+// The percentages and the score are weighted by the response weights.
+func ComputeNPS(responses []SurveyResponse, questionID string, options NPSOptions) NPSResult {
+	var (
+		result  NPSResult
+		squares float64
+	)
+
+	for _, response := range responses {
+		answer, ok := response.answer(questionID)
+		if !ok || answer.Value == nil {
+			result.Missing++
+			continue
+		}
+
+		category, ok := ClassifyNPS(answer.Value)
+		if !ok {
+			result.Invalid++
+			continue
+		}
+
+		weight := response.weight()
+		squares += weight * weight
+		result.add(category, 1, weight)
+	}
+
+	if squares > 0 {
+		result.EffectiveSampleSize = result.WeightedTotal * result.WeightedTotal / squares
+	}
+
+	result.finish(options)
+	return result
+}
+
+func (r *NPSResult) add(category NPSCategory, count int, weight float64) {
+	r.TotalSurvey += count
+	r.WeightedTotal += weight
+
+	switch category {
+	case Promoter:
+		r.Promoters += count
+		r.WeightedPromoters += weight
+	case Passive:
+		r.Passives += count
+		r.WeightedPassives += weight
+	case Detractor:
+		r.Detractors += count
+		r.WeightedDetractors += weight
+	}
+}
+
+func (r *NPSResult) finish(options NPSOptions) {
+	if r.WeightedTotal == 0 {
+		return
+	}
+
+	promoters := r.WeightedPromoters / r.WeightedTotal * 100
+	detractors := r.WeightedDetractors / r.WeightedTotal * 100
+
+	r.Score = options.round(promoters - detractors)
+	r.PromotersPercent = options.round(promoters)
+	r.PassivesPercent = options.round(r.WeightedPassives / r.WeightedTotal * 100)
+	r.DetractorsPercent = options.round(detractors)
+}
+
+// The first answer to the question.
+func (r SurveyResponse) answer(questionID string) (Answer, bool) {
+	for _, answer := range r.Answers {
+		if answer.QuestionID == questionID {
+			return answer, true
+		}
+	}
+
+	return Answer{}, false
+}
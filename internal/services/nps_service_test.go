@@ -1,6 +1,8 @@
 package services
 
 import (
+	"fmt"
+	"math"
 	"testing"
 )
 
@@ -88,3 +90,64 @@ func TestCalculateNPS(t *testing.T) {
 		})
 	}
 }
+
+// One response per value answering the question, nil values leave it unanswered.
+func answerResponses(questionID string, values ...any) []SurveyResponse {
+	responses := make([]SurveyResponse, 0, len(values))
+	for i, value := range values {
+		response := SurveyResponse{ID: fmt.Sprintf("r%d", i)}
+		if value != nil {
+			response.Answers = []Answer{{QuestionID: questionID, Value: value}}
+		}
+		responses = append(responses, response)
+	}
+
+	return responses
+}
+
+func TestComputeNPS(t *testing.T) {
+	// 3 promoters, 2 passives, 1 detractor, 1 missing and 3 invalid
+	responses := answerResponses("nps", 10, 9.0, "9", 8, 7, 0, nil, 11, 6.5, "great")
+
+	result := ComputeNPS(responses, "nps", NPSOptions{Precision: 1})
+
+	if result.TotalSurvey != 6 || result.Promoters != 3 || result.Passives != 2 || result.Detractors != 1 {
+		t.Errorf("unexpected breakdown %+v", result.NPS)
+	}
+	if result.Missing != 1 || result.Invalid != 3 {
+		t.Errorf("expected 1 missing and 3 invalid, got %d and %d", result.Missing, result.Invalid)
+	}
+	if result.Score != 33.3 || result.PromotersPercent != 50 || result.PassivesPercent != 33.3 || result.DetractorsPercent != 16.7 {
+		t.Errorf("unexpected score %+v", result)
+	}
+
+	legacy, err := result.CalculateNPS()
+	if err != nil || legacy != 33 {
+		t.Errorf("expected the breakdown to agree with CalculateNPS, got %d %v", legacy, err)
+	}
+}
+
+func TestComputeNPS_Rounding(t *testing.T) {
+	// 2 promoters and 1 detractor out of 3, 33.333...
+	responses := answerResponses("nps", 10, 10, 0)
+
+	tests := []struct {
+		options  NPSOptions
+		expected float64
+	}{
+		{NPSOptions{}, 33},
+		{NPSOptions{Precision: 2}, 33.33},
+		{NPSOptions{Rounding: RoundTruncate}, 33},
+		{NPSOptions{Rounding: RoundNone}, 100.0 / 3},
+	}
+
+	for _, tt := range tests {
+		if got := ComputeNPS(responses, "nps", tt.options).Score; math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("options %+v: expected %v, got %v", tt.options, tt.expected, got)
+		}
+	}
+
+	if got := ComputeNPS(answerResponses("nps", 10, 0, 8, 8, 8, 8, 8, 8), "nps", NPSOptions{Rounding: RoundHalfEven}).PassivesPercent; got != 75 {
+		t.Errorf("expected 75, got %v", got)
+	}
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"fmt"
+	"math"
+)
+
+// NOTE: each respondent scores +100 as a promoter, 0 as a passive and -100 as a
+// detractor, the NPS being the mean of these scores its variance per respondent is
+// 100² * (%P + %D - (%P - %D)²) with the percentages as fractions. The statistics
+// use the weighted percentages over Kish's effective sample size, the plain counts
+// when unweighted, see `NPS.Unweighted`.
+
+// The usual confidence levels.
+const (
+	Confidence90 = 0.90
+	Confidence95 = 0.95
+	Confidence99 = 0.99
+)
+
+// The default statistical power of `NPSSampleSize`.
+const DefaultPower = 0.80
+
+// The bounds of the NPS at the confidence level, clamped to -100 and 100.
+type ConfidenceInterval struct {
+	Level float64
+	Lower float64
+	Upper float64
+}
+
+// The comparison of two NPS samples.
+type NPSComparison struct {
+	// The NPS of the first sample minus the NPS of the second.
+	Difference    float64
+	StandardError float64
+	Z             float64
+	// The two-tailed probability of a difference at least this large when there is none.
+	PValue      float64
+	Level       float64
+	Significant bool
+	// The responses needed in each sample to detect the difference at `DefaultPower`,
+	// zero when there is no difference.
+	RequiredSampleSize int
+}
+
+// The counts as an unweighted result, for the statistics of plain counts.
+func (n NPS) Unweighted() NPSResult {
+	result := NPSResult{NPS: n}
+	result.add(Promoter, 0, float64(n.Promoters))
+	result.add(Passive, 0, float64(n.Passives))
+	result.add(Detractor, 0, float64(n.Detractors))
+	result.EffectiveSampleSize = float64(n.TotalSurvey)
+
+	result.finish(NPSOptions{Rounding: RoundNone})
+	return result
+}
+
+// The weighted NPS as a float, unlike `Score` it is not rounded.
+func (r NPSResult) Float() float64 {
+	if r.WeightedTotal == 0 {
+		return 0
+	}
+
+	return (r.WeightedPromoters - r.WeightedDetractors) / r.WeightedTotal * 100
+}
+
+// The variance of the score of a single respondent, in NPS points squared.
+func (r NPSResult) Variance() float64 {
+	if r.WeightedTotal == 0 {
+		return 0
+	}
+
+	promoters := r.WeightedPromoters / r.WeightedTotal
+	detractors := r.WeightedDetractors / r.WeightedTotal
+
+	return (promoters + detractors - math.Pow(promoters-detractors, 2)) * 100 * 100
+}
+
+// The standard error of the weighted NPS over the effective sample size, in NPS points.
+func (r NPSResult) StandardError() float64 {
+	if r.EffectiveSampleSize == 0 {
+		return 0
+	}
+
+	return math.Sqrt(r.Variance() / r.EffectiveSampleSize)
+}
+
+// The margin of error of the NPS at the confidence level, in NPS points.
+func (r NPSResult) MarginOfError(level float64) (float64, error) {
+	z, err := confidenceZ(level)
+	if err != nil {
+		return 0, err
+	}
+
+	return z * r.StandardError(), nil
+}
+
+// The confidence interval of the NPS at the confidence level.
+func (r NPSResult) ConfidenceInterval(level float64) (ConfidenceInterval, error) {
+	margin, err := r.MarginOfError(level)
+	if err != nil {
+		return ConfidenceInterval{}, err
+	}
+
+	score := r.Float()
+
+	return ConfidenceInterval{
+		Level: level,
+		Lower: math.Max(score-margin, -100),
+		Upper: math.Min(score+margin, 100),
+	}, nil
+}
+
+// The confidence intervals at 90, 95 and 99%.
+func (r NPSResult) ConfidenceIntervals() []ConfidenceInterval {
+	intervals := make([]ConfidenceInterval, 0, 3)
+	for _, level := range []float64{Confidence90, Confidence95, Confidence99} {
+		interval, _ := r.ConfidenceInterval(level)
+		intervals = append(intervals, interval)
+	}
+
+	return intervals
+}
+
+// Tests whether the NPS of the two samples differ at the confidence level.
+//
+// The samples are assumed independent e.g. two periods or two segments, the test is a
+// two-tailed z-test on the difference of the weighted NPS.
+func CompareNPS(a, b NPSResult, level float64) (NPSComparison, error) {
+	z, err := confidenceZ(level)
+	if err != nil {
+		return NPSComparison{}, err
+	}
+
+	if a.EffectiveSampleSize == 0 || b.EffectiveSampleSize == 0 {
+		return NPSComparison{}, fmt.Errorf("cannot compare nps with an empty sample: %d and %d responses", a.TotalSurvey, b.TotalSurvey)
+	}
+
+	comparison := NPSComparison{
+		Difference:    a.Float() - b.Float(),
+		StandardError: math.Hypot(a.StandardError(), b.StandardError()),
+		PValue:        1,
+		Level:         level,
+	}
+
+	if comparison.StandardError > 0 {
+		comparison.Z = comparison.Difference / comparison.StandardError
+		comparison.PValue = math.Erfc(math.Abs(comparison.Z) / math.Sqrt2)
+	} else if comparison.Difference != 0 {
+		// both samples are unanimous yet different
+		comparison.Z = math.Inf(int(math.Copysign(1, comparison.Difference)))
+		comparison.PValue = 0
+	}
+
+	comparison.Significant = math.Abs(comparison.Z) > z
+
+	if comparison.Difference != 0 {
+		comparison.RequiredSampleSize, _ = NPSSampleSize(b, comparison.Difference, level, DefaultPower)
+	}
+
+	return comparison, nil
+}
+
+// The number of responses needed in each sample to detect a change of the NPS.
+//
+// The change is in NPS points, the variance is estimated from the weighted baseline or
+// assumed the worst case when the baseline has no responses. The size is an effective
+// sample size, weighted samples need more responses by their design effect. Zero power
+// defaults to `DefaultPower`.
+func NPSSampleSize(baseline NPSResult, change, level, power float64) (int, error) {
+	if change == 0 {
+		return 0, fmt.Errorf("cannot size a sample to detect no change")
+	}
+
+	z, err := confidenceZ(level)
+	if err != nil {
+		return 0, err
+	}
+
+	if power == 0 {
+		power = DefaultPower
+	}
+	if power <= 0 || power >= 1 {
+		return 0, fmt.Errorf("power must be between 0 and 1, got %v", power)
+	}
+
+	variance := baseline.Variance()
+	if baseline.WeightedTotal == 0 || variance == 0 {
+		// half promoters and half detractors
+		variance = 100 * 100
+	}
+
+	n := math.Pow(z+normalQuantile(power), 2) * 2 * variance / (change * change)
+	return int(math.Ceil(n)), nil
+}
+
+// The two-tailed critical value of the standard normal distribution at the confidence level.
+func confidenceZ(level float64) (float64, error) {
+	if level <= 0 || level >= 1 {
+		return 0, fmt.Errorf("confidence level must be between 0 and 1, got %v", level)
+	}
+
+	return normalQuantile(1 - (1-level)/2), nil
+}
+
+// The inverse of the standard normal cumulative distribution, found by bisection.
+func normalQuantile(p float64) float64 {
+	low, high := -10.0, 10.0
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+		if 0.5*math.Erfc(-mid/math.Sqrt2) < p {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return (low + high) / 2
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNPS_ConfidenceInterval(t *testing.T) {
+	// 50% promoters, 30% passives and 20% detractors, NPS 30
+	nps := NPS{TotalSurvey: 400, Promoters: 200, Passives: 120, Detractors: 80}.Unweighted()
+
+	// variance 0.7 - 0.09 = 0.61, standard error sqrt(0.61 / 400) * 100
+	if se := nps.StandardError(); math.Abs(se-3.905) > 0.001 {
+		t.Errorf("expected a standard error of 3.905, got %v", se)
+	}
+
+	interval, err := nps.ConfidenceInterval(Confidence95)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(interval.Lower-22.345) > 0.01 || math.Abs(interval.Upper-37.655) > 0.01 {
+		t.Errorf("unexpected 95%% interval %+v", interval)
+	}
+
+	intervals := nps.ConfidenceIntervals()
+	if len(intervals) != 3 || intervals[0].Upper >= intervals[1].Upper || intervals[1].Upper >= intervals[2].Upper {
+		t.Errorf("expected the intervals to widen with the level, got %+v", intervals)
+	}
+
+	if _, err := nps.ConfidenceInterval(95); err == nil {
+		t.Error("expected an error for a level out of 0 and 1")
+	}
+}
+
+func TestCompareNPS(t *testing.T) {
+	lastMonth := NPS{TotalSurvey: 200, Promoters: 100, Passives: 60, Detractors: 40}.Unweighted()
+	thisMonth := NPS{TotalSurvey: 200, Promoters: 106, Passives: 60, Detractors: 34}.Unweighted()
+
+	comparison, err := CompareNPS(thisMonth, lastMonth, Confidence95)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if comparison.Difference != 6 || comparison.Significant || comparison.PValue < 0.05 {
+		t.Errorf("expected a 6 point move on 200 responses not to be significant, got %+v", comparison)
+	}
+	if comparison.RequiredSampleSize <= 200 {
+		t.Errorf("expected more responses to be required, got %d", comparison.RequiredSampleSize)
+	}
+
+	bigger := NPS{TotalSurvey: 4000, Promoters: 2120, Passives: 1200, Detractors: 680}.Unweighted()
+	baseline := NPS{TotalSurvey: 4000, Promoters: 2000, Passives: 1200, Detractors: 800}.Unweighted()
+
+	comparison, err = CompareNPS(bigger, baseline, Confidence95)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !comparison.Significant {
+		t.Errorf("expected the same move on 4000 responses to be significant, got %+v", comparison)
+	}
+
+	if _, err := CompareNPS(NPSResult{}, baseline, Confidence95); err == nil {
+		t.Error("expected an error comparing an empty sample")
+	}
+}
+
+func TestNPSSampleSize(t *testing.T) {
+	// worst case variance, (1.96 + 0.8416)² * 2 * 100² / 10²
+	n, err := NPSSampleSize(NPSResult{}, 10, Confidence95, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n != 1570 {
+		t.Errorf("expected 1570 responses per sample, got %d", n)
+	}
+
+	if _, err := NPSSampleSize(NPSResult{}, 0, Confidence95, 0); err == nil {
+		t.Error("expected an error for no change")
+	}
+}
+
+func TestNPSResult_Weighted(t *testing.T) {
+	// the first promoters and the detractors weigh less than the last promoters
+	responses := answerResponses("nps", 10, 10, 0, 0)
+	responses[0].Weight, responses[1].Weight = 0.5, 0.5
+	responses[2].Weight, responses[3].Weight = 0.5, 0.5
+	responses = append(responses, answerResponses("nps", 9, 9)...)
+	responses[4].Weight, responses[5].Weight = 2, 2
+
+	weighted := ComputeNPS(responses, "nps", NPSOptions{Rounding: RoundNone})
+	unweighted := weighted.NPS.Unweighted()
+
+	// 4 promoters and 2 detractors, 5 of the 6 of weight are promoters and 1 detractors
+	if math.Abs(unweighted.Float()-33.333) > 0.001 || math.Abs(weighted.Float()-66.667) > 0.001 {
+		t.Errorf("expected the weighted shares to be used, got %v and %v", unweighted.Float(), weighted.Float())
+	}
+
+	// 6² / (4 * 0.25 + 2 * 4) effective responses
+	if math.Abs(weighted.EffectiveSampleSize-4) > 1e-9 {
+		t.Fatalf("expected 4 effective responses, got %v", weighted.EffectiveSampleSize)
+	}
+	if se := math.Sqrt(weighted.Variance() / 4); math.Abs(weighted.StandardError()-se) > 1e-9 || weighted.StandardError() <= math.Sqrt(weighted.Variance()/6) {
+		t.Errorf("expected the standard error over the effective sample size, got %v", weighted.StandardError())
+	}
+
+	comparison, err := CompareNPS(weighted, unweighted, Confidence95)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(comparison.Difference-33.333) > 0.001 {
+		t.Errorf("expected the difference of the weighted NPS, got %+v", comparison)
+	}
+}
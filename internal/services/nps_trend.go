@@ -0,0 +1,195 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The size of the buckets of a trend series.
+type TrendInterval int
+
+const (
+	TrendDaily TrendInterval = iota + 1
+	// Weeks start on monday.
+	TrendWeekly
+	TrendMonthly
+)
+
+var trendIntervalNames = map[TrendInterval]string{
+	TrendDaily:   "daily",
+	TrendWeekly:  "weekly",
+	TrendMonthly: "monthly",
+}
+
+func (i TrendInterval) String() string {
+	if name, ok := trendIntervalNames[i]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("TrendInterval(%d)", int(i))
+}
+
+// Parses the name of the trend interval.
+func ParseTrendInterval(name string) (TrendInterval, error) {
+	for i, n := range trendIntervalNames {
+		if n == name {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown trend interval %q", name)
+}
+
+// The options of `NPSTrend`.
+type NPSTrendOptions struct {
+	Interval TrendInterval
+	// The timezone the buckets are aligned on, UTC when nil.
+	Location *time.Location
+	// Bounds the series, the first and last responses are used when zero.
+	From time.Time
+	To   time.Time
+	// Computes each point over the trailing days ending with its bucket e.g. 90,
+	// zero computes each point over its bucket only.
+	RollingDays int
+	// Points computed over fewer valid scores are marked insufficient.
+	MinResponses int
+	// How the scores and percentages are rounded.
+	NPS NPSOptions
+}
+
+// A point of the NPS trend series.
+type NPSTrendPoint struct {
+	// The bucket, the end is exclusive.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// The window the NPS is computed over, the bucket itself unless rolling.
+	WindowStart time.Time `json:"window_start"`
+
+	// The counts of the valid scores.
+	Responses  int `json:"responses"`
+	Promoters  int `json:"promoters"`
+	Passives   int `json:"passives"`
+	Detractors int `json:"detractors"`
+	// The sums of the weights of the valid scores, the counts when unweighted.
+	WeightedResponses  float64 `json:"weighted_responses"`
+	WeightedPromoters  float64 `json:"weighted_promoters"`
+	WeightedPassives   float64 `json:"weighted_passives"`
+	WeightedDetractors float64 `json:"weighted_detractors"`
+	// Kish's effective sample size of the valid scores.
+	EffectiveSampleSize float64 `json:"effective_sample_size"`
+	// Out of the weighted counts.
+	Score             float64 `json:"score"`
+	PromotersPercent  float64 `json:"promoters_percent"`
+	PassivesPercent   float64 `json:"passives_percent"`
+	DetractorsPercent float64 `json:"detractors_percent"`
+	// Fewer valid scores than the minimum, the score should not be charted.
+	Insufficient bool `json:"insufficient"`
+}
+
+// Computes the NPS over time out of the responses creation time.
+//
+// Every bucket between the bounds is returned, empty ones included, so the series can
+// be charted as is.
+func NPSTrend(responses []SurveyResponse, questionID string, options NPSTrendOptions) ([]NPSTrendPoint, error) {
+	if _, ok := trendIntervalNames[options.Interval]; !ok {
+		return nil, fmt.Errorf("unknown trend interval %d", options.Interval)
+	}
+
+	if options.RollingDays < 0 {
+		return nil, fmt.Errorf("rolling days cannot be negative, got %d", options.RollingDays)
+	}
+
+	location := options.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	sorted := make([]SurveyResponse, len(responses))
+	copy(sorted, responses)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	from, to := options.From, options.To
+	if from.IsZero() && len(sorted) > 0 {
+		from = sorted[0].CreatedAt
+	}
+	if to.IsZero() && len(sorted) > 0 {
+		to = sorted[len(sorted)-1].CreatedAt
+	}
+
+	if from.IsZero() || to.Before(from) {
+		return nil, nil
+	}
+
+	// the responses created in [start, end)
+	between := func(start, end time.Time) []SurveyResponse {
+		low := sort.Search(len(sorted), func(i int) bool { return !sorted[i].CreatedAt.Before(start) })
+		high := sort.Search(len(sorted), func(i int) bool { return !sorted[i].CreatedAt.Before(end) })
+		return sorted[low:high]
+	}
+
+	var points []NPSTrendPoint
+
+	for start := options.Interval.truncate(from.In(location)); !start.After(to); start = options.Interval.next(start) {
+		end := options.Interval.next(start)
+
+		windowStart := start
+		if options.RollingDays > 0 {
+			windowStart = end.AddDate(0, 0, -options.RollingDays)
+		}
+
+		result := ComputeNPS(between(windowStart, end), questionID, options.NPS)
+
+		points = append(points, NPSTrendPoint{
+			Start:               start,
+			End:                 end,
+			WindowStart:         windowStart,
+			Responses:           result.TotalSurvey,
+			Promoters:           result.Promoters,
+			Passives:            result.Passives,
+			Detractors:          result.Detractors,
+			WeightedResponses:   result.WeightedTotal,
+			WeightedPromoters:   result.WeightedPromoters,
+			WeightedPassives:    result.WeightedPassives,
+			WeightedDetractors:  result.WeightedDetractors,
+			EffectiveSampleSize: result.EffectiveSampleSize,
+			Score:               result.Score,
+			PromotersPercent:    result.PromotersPercent,
+			PassivesPercent:     result.PassivesPercent,
+			DetractorsPercent:   result.DetractorsPercent,
+			Insufficient:        result.TotalSurvey == 0 || result.TotalSurvey < options.MinResponses,
+		})
+	}
+
+	return points, nil
+}
+
+// The start of the bucket the time falls in, in the location of the time.
+func (i TrendInterval) truncate(t time.Time) time.Time {
+	year, month, day := t.Date()
+
+	switch i {
+	case TrendWeekly:
+		// monday is 0
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, t.Location())
+	case TrendMonthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// The start of the following bucket, calendar based so DST days keep their boundaries.
+func (i TrendInterval) next(start time.Time) time.Time {
+	switch i {
+	case TrendWeekly:
+		return start.AddDate(0, 0, 7)
+	case TrendMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
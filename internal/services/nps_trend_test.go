@@ -0,0 +1,109 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func trendResponse(at time.Time, score int) SurveyResponse {
+	return SurveyResponse{CreatedAt: at, Answers: []Answer{{QuestionID: "nps", Value: score}}}
+}
+
+func TestNPSTrend_Daily(t *testing.T) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	responses := []SurveyResponse{
+		trendResponse(day.Add(10*time.Hour), 10),
+		trendResponse(day.Add(12*time.Hour), 0),
+		// empty day in between
+		trendResponse(day.Add(50*time.Hour), 9),
+	}
+
+	points, err := NPSTrend(responses, "nps", NPSTrendOptions{Interval: TrendDaily, MinResponses: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(points) != 3 {
+		t.Fatalf("expected 3 daily points, got %+v", points)
+	}
+	if points[0].Responses != 2 || points[0].Score != 0 || points[0].Insufficient {
+		t.Errorf("unexpected first point %+v", points[0])
+	}
+	if points[1].Responses != 0 || !points[1].Insufficient {
+		t.Errorf("expected the empty day to be insufficient, got %+v", points[1])
+	}
+	if points[2].Responses != 1 || points[2].Score != 100 || !points[2].Insufficient {
+		t.Errorf("expected a single response to be insufficient, got %+v", points[2])
+	}
+}
+
+func TestNPSTrend_Timezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("timezone database unavailable: %v", err)
+	}
+
+	// sunday night in UTC is monday morning in Tokyo
+	responses := []SurveyResponse{trendResponse(time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC), 10)}
+
+	points, err := NPSTrend(responses, "nps", NPSTrendOptions{Interval: TrendWeekly, Location: tokyo})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := time.Date(2026, 3, 2, 0, 0, 0, 0, tokyo)
+	if len(points) != 1 || !points[0].Start.Equal(expected) {
+		t.Errorf("expected a single week starting %v, got %+v", expected, points)
+	}
+}
+
+func TestNPSTrend_Rolling(t *testing.T) {
+	responses := []SurveyResponse{
+		trendResponse(time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC), 10),
+		trendResponse(time.Date(2026, 2, 15, 0, 0, 0, 0, time.UTC), 0),
+		trendResponse(time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC), 10),
+	}
+
+	points, err := NPSTrend(responses, "nps", NPSTrendOptions{Interval: TrendMonthly, RollingDays: 45})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(points) != 3 {
+		t.Fatalf("expected 3 monthly points, got %+v", points)
+	}
+
+	// the trailing 45 days of march reach mid february, not january
+	if points[2].Responses != 2 || points[2].Score != 0 {
+		t.Errorf("unexpected rolling point %+v", points[2])
+	}
+	if points[0].Responses != 1 || points[0].Score != 100 {
+		t.Errorf("unexpected first point %+v", points[0])
+	}
+}
+
+func TestNPSTrend_Weighted(t *testing.T) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	promoter, detractor := trendResponse(day.Add(time.Hour), 10), trendResponse(day.Add(2*time.Hour), 0)
+	promoter.Weight, detractor.Weight = 3, 1
+
+	points, err := NPSTrend([]SurveyResponse{promoter, detractor}, "nps", NPSTrendOptions{Interval: TrendDaily})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(points) != 1 {
+		t.Fatalf("expected a single point, got %+v", points)
+	}
+
+	point := points[0]
+	if point.Responses != 2 || point.Promoters != 1 || point.WeightedResponses != 4 || point.WeightedPromoters != 3 || point.WeightedDetractors != 1 {
+		t.Errorf("expected both the counts and the weighted counts, got %+v", point)
+	}
+	// 4² / (3² + 1²)
+	if point.Score != 50 || point.EffectiveSampleSize != 1.6 {
+		t.Errorf("expected the weighted score and effective sample size, got %+v", point)
+	}
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+// NOTE: raking, or iterative proportional fitting, adjusts the weights margin by
+// margin until the weighted share of every category matches the population target.
+// The weights are trimmed after each pass so a few respondents of an under-represented
+// group cannot dominate, the following passes then spread the excess on the others.
+
+// The defaults of `RakingOptions`.
+const (
+	DefaultRakingIterations = 50
+	DefaultRakingTolerance  = 1e-6
+)
+
+// The population shares of the categories of a dimension e.g. the age bands.
+type RakingMargin struct {
+	Dimension Dimension
+	// The share or the count of each category keyed by label, normalized to sum 1.
+	Targets map[string]float64
+}
+
+// The options of `Rake`.
+type RakingOptions struct {
+	// Defaults to `DefaultRakingIterations` when zero.
+	MaxIterations int
+	// The largest gap allowed between a weighted share and its target, defaults to `DefaultRakingTolerance`.
+	Tolerance float64
+	// Bounds the weights relative to the mean weight e.g. 0.3 and 3, zero is unbounded.
+	TrimMin float64
+	TrimMax float64
+}
+
+// The outcome of the raking.
+type RakingResult struct {
+	// The weights keyed by response ID, their mean is 1.
+	Weights    map[string]float64
+	Iterations int
+	Converged  bool
+	// The weights bounded by the trimming on the last pass.
+	Trimmed int
+	// Kish's effective sample size (Σw)² / Σw².
+	EffectiveSampleSize float64
+	// The variance inflation due to the weighting, responses / effective sample size.
+	DesignEffect float64
+	// The weighted share of each category keyed by dimension name then label.
+	Margins map[string]map[string]float64
+	// The responses without a category on every margin, left unweighted.
+	Skipped []string
+}
+
+// The weight of the response, 1 when unweighted.
+func (r SurveyResponse) weight() float64 {
+	if r.Weight == 0 {
+		return 1
+	}
+
+	return r.Weight
+}
+
+// Kish's effective sample size of the weighted responses.
+func EffectiveSampleSize(responses []SurveyResponse) float64 {
+	var sum, squares float64
+	for _, response := range responses {
+		w := response.weight()
+		sum += w
+		squares += w * w
+	}
+
+	if squares == 0 {
+		return 0
+	}
+
+	return sum * sum / squares
+}
+
+// Computes the weights matching the responses to the population margins by raking.
+func Rake(responses []SurveyResponse, margins []RakingMargin, options RakingOptions) (*RakingResult, error) {
+	if len(margins) == 0 {
+		return nil, fault.NewClientError("raking needs at least a margin", nil)
+	}
+	if options.MaxIterations == 0 {
+		options.MaxIterations = DefaultRakingIterations
+	}
+	if options.Tolerance == 0 {
+		options.Tolerance = DefaultRakingTolerance
+	}
+	if options.TrimMin < 0 || (options.TrimMax != 0 && options.TrimMax < math.Max(1, options.TrimMin)) {
+		return nil, fault.NewClientError(fmt.Sprintf("invalid trimming bounds %v and %v", options.TrimMin, options.TrimMax), nil)
+	}
+
+	targets := make([]map[string]float64, len(margins))
+	for m, margin := range margins {
+		var total float64
+		for label, target := range margin.Targets {
+			if target <= 0 {
+				return nil, fault.NewClientError(fmt.Sprintf("target of %s %q must be positive", margin.Dimension.Name(), label), nil)
+			}
+			total += target
+		}
+
+		targets[m] = make(map[string]float64, len(margin.Targets))
+		for label, target := range margin.Targets {
+			targets[m][label] = target / total
+		}
+	}
+
+	result := &RakingResult{Weights: make(map[string]float64)}
+
+	// the category of each raked response on each margin
+	var (
+		ids        []string
+		categories [][]string
+	)
+
+	for _, response := range responses {
+		labels := make([]string, len(margins))
+		complete := true
+
+		for m, margin := range margins {
+			label, ok := margin.Dimension.label(response)
+			if !ok {
+				complete = false
+				break
+			}
+			if _, ok := targets[m][label]; !ok {
+				return nil, fault.NewClientError(fmt.Sprintf("%s %q of response %q has no target", margin.Dimension.Name(), label, response.ID), nil)
+			}
+			labels[m] = label
+		}
+
+		if !complete {
+			result.Skipped = append(result.Skipped, response.ID)
+			continue
+		}
+
+		ids = append(ids, response.ID)
+		categories = append(categories, labels)
+	}
+
+	if len(ids) == 0 {
+		return nil, fault.NewClientError("no response has a category on every margin", nil)
+	}
+
+	for m, margin := range margins {
+		present := make(map[string]bool)
+		for _, labels := range categories {
+			present[labels[m]] = true
+		}
+		for label := range targets[m] {
+			if !present[label] {
+				return nil, fault.NewClientError(fmt.Sprintf("no response in %s %q to weight up", margin.Dimension.Name(), label), nil)
+			}
+		}
+	}
+
+	weights := make([]float64, len(ids))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	shares := func(m int) map[string]float64 {
+		sums := make(map[string]float64)
+		var total float64
+		for i, labels := range categories {
+			sums[labels[m]] += weights[i]
+			total += weights[i]
+		}
+		for label := range sums {
+			sums[label] /= total
+		}
+		return sums
+	}
+
+	for result.Iterations < options.MaxIterations {
+		result.Iterations++
+
+		for m := range margins {
+			achieved := shares(m)
+			for i, labels := range categories {
+				weights[i] *= targets[m][labels[m]] / achieved[labels[m]]
+			}
+		}
+
+		result.Trimmed = trimWeights(weights, options.TrimMin, options.TrimMax)
+
+		gap := 0.0
+		for m := range margins {
+			for label, share := range shares(m) {
+				gap = math.Max(gap, math.Abs(share-targets[m][label]))
+			}
+		}
+
+		if gap <= options.Tolerance {
+			result.Converged = true
+			break
+		}
+	}
+
+	// mean 1 so the weighted counts stay on the scale of the sample
+	var sum, squares float64
+	for _, w := range weights {
+		sum += w
+	}
+	for i := range weights {
+		weights[i] *= float64(len(weights)) / sum
+		squares += weights[i] * weights[i]
+		result.Weights[ids[i]] = weights[i]
+	}
+
+	result.EffectiveSampleSize = float64(len(weights)) * float64(len(weights)) / squares
+	result.DesignEffect = float64(len(weights)) / result.EffectiveSampleSize
+
+	result.Margins = make(map[string]map[string]float64, len(margins))
+	for m, margin := range margins {
+		result.Margins[margin.Dimension.Name()] = shares(m)
+	}
+
+	sort.Strings(result.Skipped)
+	return result, nil
+}
+
+// Bounds the weights relative to their mean, returns how many were bounded.
+//
+// Bounding moves the mean, so it is repeated until the weights hold within the bounds
+// of their own mean.
+func trimWeights(weights []float64, low, high float64) int {
+	if low == 0 && high == 0 {
+		return 0
+	}
+
+	bounded := make([]bool, len(weights))
+
+	for pass := 0; pass < 100; pass++ {
+		var sum float64
+		for _, w := range weights {
+			sum += w
+		}
+		mean := sum / float64(len(weights))
+
+		changed := false
+		for i, w := range weights {
+			bound := w
+			switch {
+			case low > 0 && w < low*mean:
+				bound = low * mean
+			case high > 0 && w > high*mean:
+				bound = high * mean
+			}
+
+			if math.Abs(bound-w) > 1e-12*mean {
+				weights[i] = bound
+				bounded[i] = true
+				changed = true
+			}
+		}
+
+		if !changed {
+			break
+		}
+	}
+
+	var trimmed int
+	for _, b := range bounded {
+		if b {
+			trimmed++
+		}
+	}
+
+	return trimmed
+}
+
+// Sets the weights on the responses, the responses without weight are left unweighted.
+func ApplyWeights(responses []SurveyResponse, weights map[string]float64) {
+	for i := range responses {
+		if weight, ok := weights[responses[i].ID]; ok {
+			responses[i].Weight = weight
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func rakingResponses() []SurveyResponse {
+	var responses []SurveyResponse
+
+	add := func(n int, gender, age string, nps float64) {
+		for i := 0; i < n; i++ {
+			responses = append(responses, SurveyResponse{
+				ID:           fmt.Sprintf("r%d", len(responses)+1),
+				HiddenFields: map[string]string{"gender": gender, "age": age},
+				Answers:      []Answer{{QuestionID: "nps", Value: nps}},
+			})
+		}
+	}
+
+	// skewed young
+	add(40, "female", "young", 10)
+	add(30, "male", "young", 9)
+	add(20, "female", "old", 2)
+	add(10, "male", "old", 5)
+
+	return responses
+}
+
+func TestRake(t *testing.T) {
+	responses := rakingResponses()
+	responses = append(responses, SurveyResponse{ID: "nogender", HiddenFields: map[string]string{"age": "old"}})
+
+	result, err := Rake(responses, []RakingMargin{
+		{Dimension: Dimension{HiddenField: "gender"}, Targets: map[string]float64{"female": 50, "male": 50}},
+		{Dimension: Dimension{HiddenField: "age"}, Targets: map[string]float64{"young": 0.4, "old": 0.6}},
+	}, RakingOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !result.Converged || len(result.Weights) != 100 || len(result.Skipped) != 1 || result.Skipped[0] != "nogender" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	if math.Abs(result.Margins["age"]["old"]-0.6) > 1e-6 || math.Abs(result.Margins["gender"]["male"]-0.5) > 1e-6 {
+		t.Errorf("unexpected margins %v", result.Margins)
+	}
+
+	var sum float64
+	for _, w := range result.Weights {
+		sum += w
+	}
+	if math.Abs(sum-100) > 1e-9 {
+		t.Errorf("expected mean weight of 1, got sum %v", sum)
+	}
+
+	if result.EffectiveSampleSize >= 100 || result.DesignEffect <= 1 {
+		t.Errorf("unexpected effective sample size %v and design effect %v", result.EffectiveSampleSize, result.DesignEffect)
+	}
+
+	ApplyWeights(responses, result.Weights)
+	if math.Abs(EffectiveSampleSize(responses[:100])-result.EffectiveSampleSize) > 1e-9 {
+		t.Errorf("unexpected effective sample size of the weighted responses")
+	}
+
+	// the old detractors weigh more than in the raw sample
+	unweighted := ComputeNPS(rakingResponses(), "nps", NPSOptions{})
+	weighted := ComputeNPS(responses, "nps", NPSOptions{})
+	if weighted.Score >= unweighted.Score || weighted.TotalSurvey != unweighted.TotalSurvey {
+		t.Errorf("expected a lower weighted score, got %v against %v", weighted.Score, unweighted.Score)
+	}
+	if math.Abs(weighted.DetractorsPercent-weighted.WeightedDetractors/weighted.WeightedTotal*100) > 0.5 || weighted.StandardError() <= unweighted.StandardError() {
+		t.Errorf("unexpected weighted result %+v", weighted)
+	}
+}
+
+func TestRakeTrimming(t *testing.T) {
+	result, err := Rake(rakingResponses(), []RakingMargin{
+		{Dimension: Dimension{HiddenField: "age"}, Targets: map[string]float64{"young": 0.1, "old": 0.9}},
+	}, RakingOptions{TrimMax: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Converged || result.Trimmed != 30 || result.Iterations != DefaultRakingIterations {
+		t.Fatalf("expected the trimming to prevent convergence, got %+v", result)
+	}
+
+	for id, w := range result.Weights {
+		if w > 2+1e-9 {
+			t.Errorf("weight %v of %s above the trimming bound", w, id)
+		}
+	}
+}
+
+func TestRakeErrors(t *testing.T) {
+	responses := rakingResponses()
+	age := Dimension{HiddenField: "age"}
+
+	for name, margins := range map[string][]RakingMargin{
+		"no margin":       nil,
+		"missing target":  {{Dimension: age, Targets: map[string]float64{"young": 1}}},
+		"negative target": {{Dimension: age, Targets: map[string]float64{"young": 1, "old": -1}}},
+		"empty category":  {{Dimension: age, Targets: map[string]float64{"young": 1, "old": 1, "middle": 1}}},
+	} {
+		if _, err := Rake(responses, margins, RakingOptions{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestWeightedCrossTab(t *testing.T) {
+	responses := rakingResponses()
+	for i := range responses {
+		responses[i].Weight = 2
+	}
+
+	tab, err := CrossTabulate(responses, []Dimension{{HiddenField: "age"}}, []Dimension{{HiddenField: "gender"}}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	unweighted, _ := CrossTabulate(rakingResponses(), []Dimension{{HiddenField: "age"}}, []Dimension{{HiddenField: "gender"}}, 0)
+
+	// constant weights change the weighted counts only
+	if tab.WeightedTotal != 200 || tab.Total != 100 || math.Abs(tab.DesignEffect-1) > 1e-9 || math.Abs(tab.ChiSquare-unweighted.ChiSquare) > 1e-9 {
+		t.Fatalf("unexpected table %+v", tab)
+	}
+}
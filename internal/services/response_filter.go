@@ -0,0 +1,559 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+// NOTE: the response filters are expr-lang expressions over the answers keyed by
+// question ID, the same as the routing conditionals, and over the response fields
+// e.g.
+//
+//	plan == "pro" && score >= 9 && created_at > date("2026-01-01")
+//
+// The comparisons of an answer, a response field or a hidden field with a constant
+// are translated into a SQL condition the database filters the responses with. The
+// rest of the expression is evaluated in memory on the responses the condition
+// selects, so the condition only has to hold for every matching response. As with
+// the routing, the expressions failing on a response e.g. comparing an unanswered
+// question with a number, do not hold.
+
+// The response fields of the filters, taking precedence over the questions with the
+// same ID.
+const (
+	FilterResponseID = "response_id"
+	FilterCreatedAt  = "created_at"
+	FilterWeight     = "weight"
+	// Whether the response reaches an ending, see `Survey.EndingReached`.
+	FilterCompleted = "completed"
+	// The hidden fields keyed by name e.g. `hidden.region`.
+	FilterHidden = "hidden"
+)
+
+var filterFields = map[string]bool{
+	FilterResponseID: true,
+	FilterCreatedAt:  true,
+	FilterWeight:     true,
+	FilterCompleted:  true,
+	FilterHidden:     true,
+}
+
+// A compiled response filter, not safe for concurrent use.
+type ResponseFilter struct {
+	Expression string
+
+	program *vm.Program
+	flow    *flowReplay
+	// The SQL condition on the responses `r`, the placeholders numbered from $1, empty
+	// when no part of the expression translates.
+	where string
+	args  []any
+	// Whether the condition selects exactly the matching responses.
+	exact bool
+}
+
+// Compiles the filter expression over the answers to the survey, nil for a blank
+// expression which keeps every response.
+//
+// Errors are client errors, the identifiers must be question IDs or response fields.
+func CompileResponseFilter(survey Survey, expression string) (*ResponseFilter, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+
+	tree, err := parser.Parse(expression)
+	if err != nil {
+		return nil, fault.NewClientError("invalid filter expression", err)
+	}
+
+	// the declarations are walked after the expressions using them
+	checker := filterChecker{survey: survey, declared: make(map[string]bool)}
+	ast.Walk(&tree.Node, &checker)
+	checker.checking = true
+	ast.Walk(&tree.Node, &checker)
+	if checker.unknown != "" {
+		return nil, fault.NewClientError(fmt.Sprintf("unknown identifier %q in the filter expression", checker.unknown), nil)
+	}
+
+	program, err := expr.Compile(expression, expr.AsBool())
+	if err != nil {
+		return nil, fault.NewClientError("invalid filter expression", err)
+	}
+
+	filter := &ResponseFilter{Expression: expression, program: program, flow: newFlowReplay(survey)}
+
+	compiler := filterCompiler{survey: survey}
+	if condition, ok := compiler.translate(tree.Node); ok {
+		filter.where, filter.args, filter.exact = condition.where, compiler.args, condition.exact
+	}
+
+	return filter, nil
+}
+
+// Rejects the identifiers that are neither a question, a response field nor declared
+// with `let`.
+type filterChecker struct {
+	survey   Survey
+	declared map[string]bool
+	// Checks the identifiers once the declarations are known.
+	checking bool
+	unknown  string
+}
+
+func (c *filterChecker) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.VariableDeclaratorNode:
+		c.declared[n.Name] = true
+	case *ast.IdentifierNode:
+		_, question := c.survey.Questions[n.Value]
+		if c.checking && !question && !filterFields[n.Value] && !c.declared[n.Value] && c.unknown == "" {
+			c.unknown = n.Value
+		}
+	}
+}
+
+// Whether the response matches the filter, a nil filter matches every response.
+func (f *ResponseFilter) Matches(response SurveyResponse) bool {
+	if f == nil {
+		return true
+	}
+
+	env := make(map[string]any, len(response.Answers)+len(filterFields))
+	for id, value := range response.answerValues() {
+		env[id] = value
+	}
+
+	hidden := make(map[string]any, len(response.HiddenFields))
+	for key, value := range response.HiddenFields {
+		hidden[key] = value
+	}
+
+	env[FilterResponseID] = response.ID
+	env[FilterCreatedAt] = response.CreatedAt
+	env[FilterWeight] = response.weight()
+	env[FilterHidden] = hidden
+	_, env[FilterCompleted] = f.flow.ending(response)
+
+	output, err := expr.Run(f.program, env)
+	if err != nil {
+		return false
+	}
+
+	match, _ := output.(bool)
+	return match
+}
+
+// The responses matching the filter, for the aggregates computed in memory.
+func FilterResponses(responses []SurveyResponse, filter *ResponseFilter) []SurveyResponse {
+	if filter == nil {
+		return responses
+	}
+
+	matched := make([]SurveyResponse, 0, len(responses))
+	for _, response := range responses {
+		if filter.Matches(response) {
+			matched = append(matched, response)
+		}
+	}
+
+	return matched
+}
+
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+// The SQL condition on the responses `r` with its placeholders numbered after the
+// offset arguments of the query, "TRUE" for a nil filter.
+func (f *ResponseFilter) condition(offset int) (string, []any) {
+	if f == nil || f.where == "" {
+		return "TRUE", nil
+	}
+
+	where := placeholderPattern.ReplaceAllStringFunc(f.where, func(placeholder string) string {
+		n, _ := strconv.Atoi(placeholder[1:])
+		return fmt.Sprintf("$%d", n+offset)
+	})
+
+	return where, f.args
+}
+
+// Whether the responses selected by the condition must be matched in memory.
+func (f *ResponseFilter) inMemory() bool {
+	return f != nil && !f.exact
+}
+
+// Restricts the query over the responses of a survey, selected as `r` by
+// `r.survey_id = $1`, to the responses matching the exact filter, see `resolveFilter`.
+func (f *ResponseFilter) restrict(query string, args ...any) (string, []any) {
+	where, filterArgs := f.condition(len(args))
+	if where == "TRUE" {
+		return query, args
+	}
+
+	return strings.ReplaceAll(query, "r.survey_id = $1", "r.survey_id = $1 AND ("+where+")"), append(args, filterArgs...)
+}
+
+// The filter selecting exactly the matching responses of the survey in the database.
+//
+// The responses the SQL condition cannot decide on are read and matched in memory,
+// the filter returned selects the response IDs of those matching.
+func resolveFilter(ctx context.Context, db *sqlx.DB, surveyID int, filter *ResponseFilter) (*ResponseFilter, error) {
+	if !filter.inMemory() {
+		return filter, nil
+	}
+
+	// the responses are identified by their response ID within the survey
+	ids := []string{}
+	err := streamResponses(ctx, db, surveyID, time.Time{}, time.Time{}, filter, func(response SurveyResponse) error {
+		ids = append(ids, response.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResponseFilter{
+		Expression: filter.Expression,
+		program:    filter.program,
+		flow:       filter.flow,
+		where:      "r.response_id = ANY($1)",
+		args:       []any{pq.Array(ids)},
+		exact:      true,
+	}, nil
+}
+
+// A SQL condition translated from a part of the filter expression.
+type filterCondition struct {
+	where string
+	// The condition holds exactly for the responses the expression holds for.
+	exact bool
+	// The expression never fails, so a failing left side of `||` cannot hide the right one.
+	safe bool
+}
+
+// Translates the filter expression into a SQL condition on the responses `r`.
+type filterCompiler struct {
+	survey Survey
+	args   []any
+}
+
+// The placeholder of the argument.
+func (c *filterCompiler) arg(value any) string {
+	c.args = append(c.args, value)
+	return fmt.Sprintf("$%d", len(c.args))
+}
+
+// The condition holding for every response the expression holds for, false when the
+// expression cannot be translated.
+func (c *filterCompiler) translate(node ast.Node) (condition filterCondition, ok bool) {
+	// the arguments of the parts dropped are dropped too
+	args := len(c.args)
+	defer func() {
+		if !ok {
+			c.args = c.args[:args]
+		}
+	}()
+
+	switch n := node.(type) {
+	case *ast.BoolNode:
+		if n.Value {
+			return filterCondition{where: "TRUE", exact: true, safe: true}, true
+		}
+		return filterCondition{where: "FALSE", exact: true, safe: true}, true
+	case *ast.UnaryNode:
+		if n.Operator != "!" && n.Operator != "not" {
+			return filterCondition{}, false
+		}
+		// a failing expression holds neither negated
+		inner, ok := c.translate(n.Node)
+		if !ok || !inner.exact || !inner.safe {
+			return filterCondition{}, false
+		}
+		return filterCondition{where: "NOT (" + inner.where + ")", exact: true, safe: true}, true
+	case *ast.BinaryNode:
+		switch n.Operator {
+		case "&&", "and":
+			left, lok := c.translate(n.Left)
+			right, rok := c.translate(n.Right)
+			switch {
+			case lok && rok:
+				return filterCondition{where: "(" + left.where + ") AND (" + right.where + ")", exact: left.exact && right.exact, safe: left.safe && right.safe}, true
+			case lok:
+				return filterCondition{where: left.where}, true
+			case rok:
+				return filterCondition{where: right.where}, true
+			}
+			return filterCondition{}, false
+		case "||", "or":
+			left, lok := c.translate(n.Left)
+			if !lok {
+				return filterCondition{}, false
+			}
+			right, rok := c.translate(n.Right)
+			if !rok {
+				return filterCondition{}, false
+			}
+			return filterCondition{where: "(" + left.where + ") OR (" + right.where + ")", exact: left.exact && right.exact && left.safe, safe: left.safe && right.safe}, true
+		default:
+			return c.comparison(n)
+		}
+	}
+
+	return filterCondition{}, false
+}
+
+// The operators of the comparisons with the operands swapped.
+var swappedOperators = map[string]string{"==": "==", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+var sqlOperators = map[string]string{"==": "=", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+// Translates the comparison of an answer or a field with a constant.
+func (c *filterCompiler) comparison(n *ast.BinaryNode) (filterCondition, bool) {
+	if n.Operator == "in" {
+		if value, ok := filterConstant(n.Left); ok {
+			// the option ranked or chosen among the array answer
+			questionID, ok := c.question(n.Right)
+			text, isText := value.(string)
+			if !ok || !isText {
+				return filterCondition{}, false
+			}
+			return filterCondition{where: c.answerExists(c.arg(questionID), "jsonb_typeof(fa.value) = 'array' AND fa.value @> jsonb_build_array(CAST("+c.arg(text)+" AS text))"), exact: true}, true
+		}
+
+		list, ok := n.Right.(*ast.ArrayNode)
+		if !ok || len(list.Nodes) == 0 {
+			return filterCondition{}, false
+		}
+
+		var conditions []string
+		for _, item := range list.Nodes {
+			value, ok := filterConstant(item)
+			if !ok {
+				return filterCondition{}, false
+			}
+			condition, ok := c.compare(n.Left, "==", value)
+			if !ok {
+				return filterCondition{}, false
+			}
+			conditions = append(conditions, "("+condition.where+")")
+		}
+		return filterCondition{where: strings.Join(conditions, " OR "), exact: true, safe: true}, true
+	}
+
+	if _, ok := sqlOperators[n.Operator]; !ok {
+		return filterCondition{}, false
+	}
+
+	if value, ok := filterConstant(n.Right); ok {
+		return c.compare(n.Left, n.Operator, value)
+	}
+	if value, ok := filterConstant(n.Left); ok {
+		return c.compare(n.Right, swappedOperators[n.Operator], value)
+	}
+
+	return filterCondition{}, false
+}
+
+// Translates `subject operator value`, the ordered comparisons fail in memory on
+// mismatched types so they are not safe.
+func (c *filterCompiler) compare(subject ast.Node, operator string, value any) (filterCondition, bool) {
+	ordered := operator != "==" && operator != "!="
+	sqlOperator := sqlOperators[operator]
+
+	if key, ok := hiddenField(subject); ok {
+		field := "r.hidden_fields ->> " + c.arg(key)
+		switch v := value.(type) {
+		case nil:
+			if ordered {
+				return filterCondition{}, false
+			}
+			if operator == "==" {
+				return filterCondition{where: field + " IS NULL", exact: true, safe: true}, true
+			}
+			return filterCondition{where: field + " IS NOT NULL", exact: true, safe: true}, true
+		case string:
+			switch operator {
+			case "==":
+				return filterCondition{where: field + " = " + c.arg(v), exact: true, safe: true}, true
+			case "!=":
+				return filterCondition{where: field + " IS DISTINCT FROM " + c.arg(v), exact: true, safe: true}, true
+			}
+			return filterCondition{where: "(" + field + `) COLLATE "C" ` + sqlOperator + " " + c.arg(v), exact: true}, true
+		}
+		return filterCondition{}, false
+	}
+
+	if identifier, ok := subject.(*ast.IdentifierNode); ok && filterFields[identifier.Value] {
+		switch identifier.Value {
+		case FilterCreatedAt:
+			if t, ok := value.(time.Time); ok {
+				return filterCondition{where: "r.created_at " + sqlOperator + " " + c.arg(t), exact: true, safe: true}, true
+			}
+		case FilterWeight:
+			if number, ok := filterNumber(value); ok {
+				return filterCondition{where: "r.weight " + sqlOperator + " " + c.arg(number), exact: true, safe: true}, true
+			}
+		case FilterResponseID:
+			if text, ok := value.(string); ok && !ordered {
+				return filterCondition{where: "r.response_id " + sqlOperator + " " + c.arg(text), exact: true, safe: true}, true
+			}
+		}
+		return filterCondition{}, false
+	}
+
+	questionID, ok := c.question(subject)
+	if !ok {
+		return filterCondition{}, false
+	}
+	question := c.arg(questionID)
+
+	// the condition on the answer holding for the equal answers, negated for !=
+	var answer string
+
+	switch v := value.(type) {
+	case nil:
+		if ordered {
+			return filterCondition{}, false
+		}
+		exists := c.answerExists(question, "jsonb_typeof(fa.value) <> 'null'")
+		if operator == "==" {
+			return filterCondition{where: "NOT " + exists, exact: true, safe: true}, true
+		}
+		return filterCondition{where: exists, exact: true, safe: true}, true
+	case string:
+		if ordered {
+			return filterCondition{where: c.answerExists(question, `jsonb_typeof(fa.value) = 'string' AND (fa.value #>> '{}') COLLATE "C" `+sqlOperator+" "+c.arg(v)), exact: true}, true
+		}
+		answer = "fa.value = to_jsonb(CAST(" + c.arg(v) + " AS text))"
+	case bool:
+		if ordered {
+			return filterCondition{}, false
+		}
+		answer = "fa.value = to_jsonb(CAST(" + c.arg(v) + " AS boolean))"
+	default:
+		number, ok := filterNumber(v)
+		if !ok {
+			return filterCondition{}, false
+		}
+		comparison := "="
+		if ordered {
+			comparison = sqlOperator
+		}
+		condition := c.answerExists(question, "jsonb_typeof(fa.value) = 'number' AND (fa.value #>> '{}')::float8 "+comparison+" CAST("+c.arg(number)+" AS float8)")
+		switch operator {
+		case "==":
+			return filterCondition{where: condition, exact: true, safe: true}, true
+		case "!=":
+			return filterCondition{where: "NOT " + condition, exact: true, safe: true}, true
+		}
+		return filterCondition{where: condition, exact: true}, true
+	}
+
+	exists := c.answerExists(question, answer)
+	if operator == "==" {
+		return filterCondition{where: exists, exact: true, safe: true}, true
+	}
+	return filterCondition{where: "NOT " + exists, exact: true, safe: true}, true
+}
+
+// The condition of the response having an answer to the question, the placeholder
+// of its ID, meeting the condition on `fa.value`.
+func (c *filterCompiler) answerExists(question, condition string) string {
+	return "EXISTS (SELECT 1 FROM survey_answers fa WHERE fa.response_id = r.id AND fa.question_id = " + question + " AND " + condition + ")"
+}
+
+// The question the node refers to, the response fields taking precedence.
+func (c *filterCompiler) question(node ast.Node) (string, bool) {
+	identifier, ok := node.(*ast.IdentifierNode)
+	if !ok || filterFields[identifier.Value] {
+		return "", false
+	}
+
+	_, ok = c.survey.Questions[identifier.Value]
+	return identifier.Value, ok
+}
+
+// The key of the `hidden.key` or `hidden["key"]` node.
+func hiddenField(node ast.Node) (string, bool) {
+	member, ok := node.(*ast.MemberNode)
+	if !ok || member.Method {
+		return "", false
+	}
+
+	identifier, ok := member.Node.(*ast.IdentifierNode)
+	if !ok || identifier.Value != FilterHidden {
+		return "", false
+	}
+
+	key, ok := member.Property.(*ast.StringNode)
+	if !ok {
+		return "", false
+	}
+
+	return key.Value, true
+}
+
+// The value of the literals and of the expressions without identifiers e.g.
+// `date("2026-01-01")`, evaluated once.
+func filterConstant(node ast.Node) (any, bool) {
+	switch n := node.(type) {
+	case *ast.NilNode:
+		return nil, true
+	case *ast.StringNode:
+		return n.Value, true
+	case *ast.IntegerNode:
+		return float64(n.Value), true
+	case *ast.FloatNode:
+		return n.Value, true
+	case *ast.BoolNode:
+		return n.Value, true
+	case *ast.UnaryNode, *ast.BuiltinNode:
+		var checker variableChecker
+		ast.Walk(&node, &checker)
+		if checker.variable {
+			return nil, false
+		}
+
+		value, err := expr.Eval(node.String(), nil)
+		if err != nil {
+			return nil, false
+		}
+		return value, true
+	}
+
+	return nil, false
+}
+
+// Finds the identifiers, the predicate pointers and the calls of an expression.
+type variableChecker struct {
+	variable bool
+}
+
+func (c *variableChecker) Visit(node *ast.Node) {
+	switch (*node).(type) {
+	case *ast.IdentifierNode, *ast.PointerNode, *ast.VariableDeclaratorNode, *ast.MemberNode, *ast.CallNode:
+		c.variable = true
+	}
+}
+
+func filterNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+func TestCompileResponseFilterErrors(t *testing.T) {
+	survey := exportSurvey()
+
+	if filter, err := CompileResponseFilter(survey, "  "); filter != nil || err != nil {
+		t.Errorf("expected no filter for a blank expression, got %v %v", filter, err)
+	}
+
+	for _, expression := range []string{`plan ==`, `region == "north"`, `score > `} {
+		if _, err := CompileResponseFilter(survey, expression); !fault.IsClientError(err) {
+			t.Errorf("expected a client error for %q, got %v", expression, err)
+		}
+	}
+
+	if _, err := CompileResponseFilter(survey, `let top = 9; score >= top`); err != nil {
+		t.Errorf("unexpected error for a declared variable: %v", err)
+	}
+}
+
+func TestResponseFilterMatches(t *testing.T) {
+	survey := exportSurvey()
+	responses := exportResponses()
+
+	cases := map[string]string{
+		`plan == "pro" && score >= 5`:                 "r1",
+		`created_at > date("2025-03-01T10:30:00Z")`:   "r2",
+		`hidden.region == "north"`:                    "r1",
+		`completed`:                                   "r1",
+		`"price" in rank`:                             "r1",
+		`score > 5 || weight > 1`:                     "r1,r2",
+		`rank >= 1`:                                   "",
+		`why == nil && plan in ["free", "pro"]`:       "r1,r2",
+		`response_id != "r1" and not (plan == "pro")`: "r2",
+	}
+
+	for expression, want := range cases {
+		filter, err := CompileResponseFilter(survey, expression)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", expression, err)
+		}
+
+		var ids []string
+		for _, response := range FilterResponses(responses, filter) {
+			ids = append(ids, response.ID)
+		}
+		if got := strings.Join(ids, ","); got != want {
+			t.Errorf("%q matched %q, want %q", expression, got, want)
+		}
+	}
+
+	if got := FilterResponses(responses, nil); len(got) != len(responses) {
+		t.Errorf("expected a nil filter to keep every response")
+	}
+}
+
+func TestResponseFilterSQL(t *testing.T) {
+	survey := exportSurvey()
+
+	compile := func(expression string) *ResponseFilter {
+		filter, err := CompileResponseFilter(survey, expression)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", expression, err)
+		}
+		return filter
+	}
+
+	filter := compile(`plan == "pro" && score >= 9`)
+	if !filter.exact || len(filter.args) != 4 || filter.args[1] != "pro" || filter.args[3] != 9.0 || filter.args[2] != "score" {
+		t.Errorf("unexpected translation %q %v %v", filter.where, filter.args, filter.exact)
+	}
+
+	where, args := filter.condition(2)
+	if !strings.Contains(where, "fa.question_id = $3 AND fa.value = to_jsonb(CAST($4 AS text))") || !strings.Contains(where, "CAST($6 AS float8)") || len(args) != 4 {
+		t.Errorf("expected the placeholders after the query arguments, got %q", where)
+	}
+
+	// the ending is replayed in memory, the rest filtered in the database
+	filter = compile(`completed && plan == "pro"`)
+	if filter.exact || filter.where == "" || !filter.inMemory() {
+		t.Errorf("expected a partial translation, got %q %v", filter.where, filter.exact)
+	}
+
+	// a failing left side fails the whole expression
+	if filter = compile(`score >= 9 || plan == "pro"`); filter.exact || !strings.Contains(filter.where, " OR ") {
+		t.Errorf("expected an inexact translation, got %q %v", filter.where, filter.exact)
+	}
+	if filter = compile(`plan == "pro" || score >= 9`); !filter.exact {
+		t.Errorf("expected an exact translation, got %q", filter.where)
+	}
+
+	if filter = compile(`!(score >= 9)`); filter.where != "" || filter.exact {
+		t.Errorf("expected no translation of a negated failing comparison, got %q", filter.where)
+	}
+
+	if filter = compile(`plan != "pro" && 9 <= score`); !filter.exact || !strings.HasPrefix(filter.where, "(NOT EXISTS") || !strings.Contains(filter.where, "::float8 >= CAST") {
+		t.Errorf("unexpected translation %q", filter.where)
+	}
+
+	filter = compile(`created_at >= date("2026-01-01T00:00:00Z") && hidden.region == "north"`)
+	if created, ok := filter.args[0].(time.Time); !ok || !filter.exact || !created.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected translation %q %v", filter.where, filter.args)
+	}
+
+	query, args := filter.restrict("SELECT COUNT(*) FROM survey_responses r WHERE r.survey_id = $1", 7)
+	if !strings.Contains(query, "r.survey_id = $1 AND ((r.created_at >= $2) AND (r.hidden_fields ->> $3 = $4))") || len(args) != 4 || args[0] != 7 {
+		t.Errorf("unexpected query %q %v", query, args)
+	}
+
+	// the response IDs are the ones given by the clients
+	filter = compile(`response_id == "r2" || response_id in ["r3"]`)
+	if !strings.HasPrefix(filter.where, "(r.response_id = $1)") || filter.args[0] != "r2" {
+		t.Errorf("unexpected translation %q %v", filter.where, filter.args)
+	}
+
+	if query, args := (*ResponseFilter)(nil).restrict("q", 1); query != "q" || len(args) != 1 {
+		t.Errorf("expected a nil filter to leave the query")
+	}
+}
+
+func TestResolveFilter(t *testing.T) {
+	survey := exportSurvey()
+	createdAt := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	columns := []string{"id", "response_id", "hidden_fields", "weight", "created_at", "question_id", "value", "shown_at", "answered_at"}
+	answer := func(id int64, responseID, questionID, value string) []driver.Value {
+		return []driver.Value{id, responseID, []byte("{}"), 1.0, createdAt, questionID, []byte(value), nil, nil}
+	}
+
+	db, queries := recordingDB(t, columns,
+		answer(41, "r1", "plan", `"pro"`),
+		answer(41, "r1", "rank", `["price", "speed"]`),
+		answer(41, "r1", "score", `6`),
+		answer(42, "r2", "plan", `"free"`),
+		answer(42, "r2", "score", `3`),
+	)
+
+	filter, err := CompileResponseFilter(survey, `completed && plan != "free"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resolved, err := resolveFilter(context.Background(), db, 1, filter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*queries) != 1 || !strings.Contains((*queries)[0].query, "NOT EXISTS (SELECT 1 FROM survey_answers fa WHERE fa.response_id = r.id") {
+		t.Fatalf("expected the responses to be read through the translated condition, got %+v", *queries)
+	}
+
+	// only r1 reaches the ending, selected by its response ID
+	ids, ok := resolved.args[0].(*pq.StringArray)
+	if !resolved.exact || resolved.where != "r.response_id = ANY($1)" || !ok || !reflect.DeepEqual([]string(*ids), []string{"r1"}) {
+		t.Errorf("unexpected resolved filter %q %v", resolved.where, resolved.args)
+	}
+
+	query, args := resolved.restrict("SELECT COUNT(*) FROM survey_responses r WHERE r.survey_id = $1", 1)
+	if !strings.Contains(query, "r.survey_id = $1 AND (r.response_id = ANY($2))") || len(args) != 2 {
+		t.Errorf("unexpected query %q %v", query, args)
+	}
+}
@@ -1,10 +1,27 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/store"
 )
 
 // The type of question being asked.
@@ -13,8 +30,42 @@ type QuestionType int
 const (
 	Text QuestionType = iota + 1
 	MultipleChoice
+	// A numeric scale, the options are the points of the scale e.g. "0" to "10".
+	Rating
+	// Any number.
+	Numeric
+	// The options ordered by preference, the first is ranked 1.
+	Ranking
 )
 
+var questionTypeNames = map[QuestionType]string{
+	Text:           "text",
+	MultipleChoice: "multiple_choice",
+	Rating:         "rating",
+	Numeric:        "numeric",
+	Ranking:        "ranking",
+}
+
+// The name of the question type as written in survey definitions.
+func (t QuestionType) String() string {
+	if name, ok := questionTypeNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("QuestionType(%d)", int(t))
+}
+
+// Parses the name of the question type as written in survey definitions.
+func ParseQuestionType(name string) (QuestionType, error) {
+	for t, n := range questionTypeNames {
+		if n == name {
+			return t, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown question type %q", name)
+}
+
 // The conditional next question after a question answered
 //
 // Basically it determines what question will be ask based
@@ -32,14 +83,56 @@ type Question struct {
 	Options      []string
 	Next         map[string]string
 	Conditionals []ConditionalNext
+	// The library question it comes from, nil when authored in the survey.
+	Library *LibraryLink
+}
+
+// The message shown when the respondent reaches the end of a path.
+//
+// Conditionals may point to an ending instead of a question.
+type Ending struct {
+	ID      string
+	Title   string
+	Message string
+}
+
+// The localized texts of a question.
+type QuestionTranslation struct {
+	Text    string
+	Options []string // same order as Question.Options
+}
+
+// The localized texts of an ending.
+type EndingTranslation struct {
+	Title   string
+	Message string
+}
+
+// Holds the localized texts of the survey for a single locale.
+type Translation struct {
+	Title     string
+	Questions map[string]QuestionTranslation // keyed by Question.ID
+	Endings   map[string]EndingTranslation   // keyed by Ending.ID
 }
 
 // The Survey object.
 type Survey struct {
-	ID        string
-	Title     string
-	StartID   string
-	Questions map[string]Question // keyed by Question.ID
+	ID           string
+	Title        string
+	StartID      string
+	Locale       string                 // the locale of the texts, e.g. "en"
+	Questions    map[string]Question    // keyed by Question.ID
+	Endings      map[string]Ending      // keyed by Ending.ID
+	Translations map[string]Translation // keyed by locale
+
+	Status SurveyStatus
+	// When the survey opens and closes, zero when not scheduled.
+	OpensAt  time.Time
+	ClosesAt time.Time
+	// Closes the survey once reached, zero for no limit.
+	MaxResponses int
+	// The number of responses saved so far.
+	ResponseCount int
 }
 
 // Holds the state of the current state of the respondent on the survey.
@@ -51,50 +144,542 @@ type SurveySession struct {
 	Answers   map[string]any
 	CurrentID string
 	Completed bool
+	// The ending reached by the respondent, if any.
+	EndingID string
+	// When each question was shown and answered, keyed by Question.ID.
+	Timings map[string]AnswerTiming
+	// The questions the flow led through in order, set when rebuilt from a response
+	// since its answers may miss the timings.
+	Walked []string
+	// Passed along by the survey link, kept with the response.
+	HiddenFields map[string]string
 }
 
 // Holds the answer in every question.
 type Answer struct {
 	QuestionID string
 	Value      any
+	// When the question was shown to the respondent.
+	ShownAt time.Time
+	// When the respondent answered the question.
+	AnsweredAt time.Time
+}
+
+// Holds when a question was shown and when it was answered.
+type AnswerTiming struct {
+	ShownAt    time.Time
+	AnsweredAt time.Time
+}
+
+// The time the respondent spent on the question.
+//
+// Returns zero when either of the timestamps is missing.
+func (t AnswerTiming) Duration() time.Duration {
+	if t.ShownAt.IsZero() || t.AnsweredAt.IsZero() || t.AnsweredAt.Before(t.ShownAt) {
+		return 0
+	}
+
+	return t.AnsweredAt.Sub(t.ShownAt)
+}
+
+// The timing of the answer.
+func (a Answer) Timing() AnswerTiming {
+	return AnswerTiming{ShownAt: a.ShownAt, AnsweredAt: a.AnsweredAt}
 }
 
 // Contains the collection of answers in every survey.
 type SurveyResponse struct {
-	ID        string
-	SurveyID  string
-	Answers   []Answer
+	ID       string
+	SurveyID string
+	Answers  []Answer
+	// Known about the respondent without asking e.g. the plan tier or the region.
+	HiddenFields map[string]string
+	// The survey weight of the response, zero is unweighted, see `Rake`.
+	Weight    float64
 	CreatedAt time.Time
 }
 
+// The clock used for the answer timings, replaced in tests.
+var now = time.Now
+
+// Called once a response is saved, typically to update the aggregates or close the survey.
+type ResponseCompletedHandler func(ctx context.Context, response SurveyResponse)
+
+// Called once the weights of the survey responses are saved, typically to rebuild the aggregates.
+type WeightsSavedHandler func(ctx context.Context, surveyID string)
+
 // Handles every response for every survey.
 type SurveyResponseService interface {
 	// Save response
 	SaveResponse(response SurveyResponse) error
+	// Subscribes to the saved responses.
+	//
+	// The handlers run as after commit jobs, so the response store must handle
+	// the after effects, see `store.NewDataStoreAfterEffect`.
+	SubscribeResponseCompleted(handler ResponseCompletedHandler)
+	// Starts a session on the survey and marks the start question as shown.
+	StartSession(sessionID string, survey Survey) (*SurveySession, error)
 	// Answers the question.
 	AnswerQuestion(session *SurveySession, questionID string, answer any, survey Survey) (*Question, error)
 	// Determines what is the next question.
 	GetNextQuestionWithLogic(question Question, input map[string]any) (string, error)
+	// Stores the survey weights keyed by response ID, see `Rake`.
+	SaveWeights(surveyID string, weights map[string]float64) error
+	// Subscribes to the saved weights, the handlers run once the weights are stored.
+	SubscribeWeightsSaved(handler WeightsSavedHandler)
 }
 
 type surveyResponseServiceImpl struct {
 	surveyservice SurveyService
+	responses     store.Datastorer[models.SurveyResponse]
+
+	mu             sync.RWMutex
+	handlers       []ResponseCompletedHandler
+	weightHandlers []WeightsSavedHandler
 }
 
 // Instantiate the `SurveyResponseService`.
-func NewSurveyResponseService(surveyservice SurveyService) SurveyResponseService {
-	return &surveyResponseServiceImpl{surveyservice: surveyservice}
+//
+// The answers are written by a hook of the response store so they share the response transaction.
+func NewSurveyResponseService(surveyservice SurveyService, responses store.Datastorer[models.SurveyResponse]) SurveyResponseService {
+	s := &surveyResponseServiceImpl{surveyservice: surveyservice, responses: responses}
+
+	if responses != nil {
+		responses.SetHooks(store.Hooks{
+			PostSave: []func(ctx context.Context, tx *sqlx.Tx, data store.DTO, model any, isNew bool) error{
+				saveResponseAnswers,
+			},
+			AfterSaveCommit: []func(ctx context.Context, data store.DTO, model any, isNew bool) store.AfterSaveCommitHook{
+				s.responseCompleted,
+			},
+		})
+	}
+
+	return s
 }
 
 func (s *surveyResponseServiceImpl) SaveResponse(response SurveyResponse) error {
-	_, err := s.surveyservice.GetSurvey(response.SurveyID)
+	survey, err := s.surveyservice.GetSurvey(response.SurveyID)
+	if err != nil {
+		return err
+	}
+
+	if !survey.IsOpen(now()) {
+		return fault.NewClientError("survey is not open", nil)
+	}
+
+	if response.ID == "" {
+		return fault.NewClientError("response id is required", nil)
+	}
+
+	if err := validateAnswers(*survey, response.Answers); err != nil {
+		return err
+	}
+
+	answers := make([]Answer, len(response.Answers))
+	for i, answer := range response.Answers {
+		answer.Value = survey.Questions[answer.QuestionID].NormalizeAnswer(answer.Value)
+		answers[i] = answer
+	}
+	response.Answers = answers
+
+	if response.CreatedAt.IsZero() {
+		response.CreatedAt = now()
+	}
+
+	dto, err := responseToDTO(response)
 	if err != nil {
 		return err
 	}
 
-	// we answer here using the survey service
+	if _, err := s.responses.Create(context.Background(), dto); err != nil {
+		if errors.Is(err, fault.ErrUniqueViolation) {
+			return fault.NewClientError("response already saved", err)
+		}
+		return err
+	}
 
-	return errors.New("not yet implemented")
+	return nil
+}
+
+func (s *surveyResponseServiceImpl) SaveWeights(surveyID string, weights map[string]float64) error {
+	id, err := strconv.Atoi(surveyID)
+	if err != nil {
+		return fault.ErrNotFound
+	}
+
+	responseIDs := make([]string, 0, len(weights))
+	values := make([]float64, 0, len(weights))
+
+	for responseID, weight := range weights {
+		if weight <= 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return fault.NewClientError(fmt.Sprintf("invalid weight %v of response %q", weight, responseID), nil)
+		}
+
+		responseIDs = append(responseIDs, responseID)
+		values = append(values, weight)
+	}
+
+	if len(responseIDs) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	err = s.responses.BulkUpdate(ctx,
+		`UPDATE survey_responses r SET weight = w.weight
+		FROM unnest($2::text[], $3::float8[]) AS w(response_id, weight)
+		WHERE r.survey_id = $1 AND r.response_id = w.response_id`,
+		id, pq.Array(responseIDs), pq.Array(values),
+	)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	handlers := make([]WeightsSavedHandler, len(s.weightHandlers))
+	copy(handlers, s.weightHandlers)
+	s.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(ctx, surveyID)
+	}
+
+	return nil
+}
+
+func (s *surveyResponseServiceImpl) SubscribeWeightsSaved(handler WeightsSavedHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.weightHandlers = append(s.weightHandlers, handler)
+}
+
+func (s *surveyResponseServiceImpl) SubscribeResponseCompleted(handler ResponseCompletedHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers = append(s.handlers, handler)
+}
+
+// Dispatches the saved response to the subscribers.
+func (s *surveyResponseServiceImpl) responseCompleted(ctx context.Context, data store.DTO, model any, isNew bool) store.AfterSaveCommitHook {
+	dto, ok := data.(*models.SurveyResponseDTO)
+	if !ok || !isNew {
+		return nil
+	}
+
+	s.mu.RLock()
+	handlers := make([]ResponseCompletedHandler, len(s.handlers))
+	copy(handlers, s.handlers)
+	s.mu.RUnlock()
+
+	if len(handlers) == 0 {
+		return nil
+	}
+
+	return func() {
+		response, err := responseFromDTO(dto)
+		if err != nil {
+			log.Printf("Cannot dispatch response %s: %v", dto.ResponseID, err)
+			return
+		}
+
+		for _, handler := range handlers {
+			handler(ctx, response)
+		}
+	}
+}
+
+// Checks every answer against the question it answers.
+func validateAnswers(survey Survey, answers []Answer) error {
+	var errs []error
+
+	if len(answers) == 0 {
+		errs = append(errs, errors.New("response has no answers"))
+	}
+
+	seen := make(map[string]struct{}, len(answers))
+
+	for _, answer := range answers {
+		if _, ok := seen[answer.QuestionID]; ok {
+			errs = append(errs, fmt.Errorf("question %q is answered more than once", answer.QuestionID))
+			continue
+		}
+		seen[answer.QuestionID] = struct{}{}
+
+		question, ok := survey.Questions[answer.QuestionID]
+		if !ok {
+			errs = append(errs, fmt.Errorf("question %q does not exist", answer.QuestionID))
+			continue
+		}
+
+		if err := question.ValidateAnswer(answer.Value); err != nil {
+			errs = append(errs, fmt.Errorf("question %q: %w", answer.QuestionID, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fault.NewClientError("invalid response", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// Checks the answer value against the question type and options.
+func (q Question) ValidateAnswer(value any) error {
+	switch q.Type {
+	case Text:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected a text answer, got %T", value)
+		}
+	case MultipleChoice:
+		choice, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected one of the options, got %T", value)
+		}
+		if len(q.Options) > 0 && !slices.Contains(q.Options, choice) {
+			return fmt.Errorf("%q is not one of the options", choice)
+		}
+	case Rating:
+		score, ok := numericValue(value)
+		if !ok || score != math.Trunc(score) {
+			return fmt.Errorf("expected a point of the scale, got %v", value)
+		}
+		if !slices.Contains(q.Options, strconv.Itoa(int(score))) {
+			return fmt.Errorf("%v is not a point of the scale", value)
+		}
+	case Numeric:
+		number, ok := numericValue(value)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return fmt.Errorf("expected a number, got %v", value)
+		}
+	case Ranking:
+		ranked, ok := rankedOptions(value)
+		if !ok || len(ranked) == 0 {
+			return fmt.Errorf("expected the options in order, got %T", value)
+		}
+		for i, option := range ranked {
+			if !slices.Contains(q.Options, option) {
+				return fmt.Errorf("%q is not one of the options", option)
+			}
+			if slices.Contains(ranked[:i], option) {
+				return fmt.Errorf("%q is ranked more than once", option)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown question type %s", q.Type)
+	}
+
+	return nil
+}
+
+// The valid answer as it is stored, the ratings and numbers given as numeric strings
+// are stored as numbers.
+func (q Question) NormalizeAnswer(value any) any {
+	if q.Type != Rating && q.Type != Numeric {
+		return value
+	}
+
+	if number, ok := numericValue(value); ok {
+		return number
+	}
+
+	return value
+}
+
+// The points of a rating scale from min to max inclusive.
+func RatingScale(min, max int) []string {
+	points := make([]string, 0, max-min+1)
+	for i := min; i <= max; i++ {
+		points = append(points, strconv.Itoa(i))
+	}
+
+	return points
+}
+
+// The lowest and highest points of the rating scale.
+func (q Question) ScaleBounds() (min, max int, err error) {
+	if q.Type != Rating {
+		return 0, 0, fmt.Errorf("question %q is not a rating", q.ID)
+	}
+
+	if len(q.Options) == 0 {
+		return 0, 0, fmt.Errorf("question %q has no scale", q.ID)
+	}
+
+	for i, option := range q.Options {
+		point, err := strconv.Atoi(option)
+		if err != nil {
+			return 0, 0, fmt.Errorf("question %q has a non numeric point %q", q.ID, option)
+		}
+
+		if i == 0 || point < min {
+			min = point
+		}
+		if i == 0 || point > max {
+			max = point
+		}
+	}
+
+	return min, max, nil
+}
+
+// Converts the ranking answer into the options in order.
+func rankedOptions(value any) ([]string, bool) {
+	switch v := value.(type) {
+	case []string:
+		return v, true
+	case []any:
+		options := make([]string, 0, len(v))
+		for _, item := range v {
+			option, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			options = append(options, option)
+		}
+		return options, true
+	default:
+		return nil, false
+	}
+}
+
+// Converts the answer into a number, numeric strings are accepted too.
+func numericValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// Writes the answers of the response.
+func saveResponseAnswers(ctx context.Context, tx *sqlx.Tx, data store.DTO, model any, isNew bool) error {
+	dto, ok := data.(*models.SurveyResponseDTO)
+	if !ok || !isNew {
+		return nil
+	}
+
+	response, ok := model.(*models.SurveyResponse)
+	if !ok {
+		return fmt.Errorf("unexpected response model %T", model)
+	}
+
+	query := "INSERT INTO survey_answers (response_id, question_id, value, shown_at, answered_at) VALUES (:response_id, :question_id, :value, :shown_at, :answered_at)"
+
+	for _, answer := range dto.Answers {
+		answer.ResponseID = response.ID
+
+		if _, err := tx.NamedExecContext(ctx, query, answer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func responseToDTO(response SurveyResponse) (*models.SurveyResponseDTO, error) {
+	dto := &models.SurveyResponseDTO{
+		SurveyID:     response.SurveyID,
+		ResponseID:   response.ID,
+		HiddenFields: response.HiddenFields,
+		Weight:       response.weight(),
+		CreatedAt:    response.CreatedAt,
+	}
+
+	for _, answer := range response.Answers {
+		value, err := json.Marshal(answer.Value)
+		if err != nil {
+			return nil, fault.NewClientError(fmt.Sprintf("invalid answer of question %q", answer.QuestionID), err)
+		}
+
+		dto.Answers = append(dto.Answers, models.Answer{
+			QuestionID: answer.QuestionID,
+			Value:      value,
+			ShownAt:    timePtr(answer.ShownAt),
+			AnsweredAt: timePtr(answer.AnsweredAt),
+		})
+	}
+
+	return dto, nil
+}
+
+func responseFromDTO(dto *models.SurveyResponseDTO) (SurveyResponse, error) {
+	return responseFromModel(models.SurveyResponse{
+		SurveyID:     dto.SurveyID,
+		ResponseID:   dto.ResponseID,
+		HiddenFields: dto.HiddenFields,
+		Weight:       dto.Weight,
+		CreatedAt:    dto.CreatedAt,
+	}, dto.Answers)
+}
+
+func responseFromModel(model models.SurveyResponse, answers []models.Answer) (SurveyResponse, error) {
+	response := SurveyResponse{
+		ID:           model.ResponseID,
+		SurveyID:     model.SurveyID,
+		HiddenFields: model.HiddenFields,
+		Weight:       model.Weight,
+		CreatedAt:    model.CreatedAt,
+		Answers:      make([]Answer, 0, len(answers)),
+	}
+
+	for _, a := range answers {
+		var value any
+		if len(a.Value) > 0 {
+			if err := json.Unmarshal(a.Value, &value); err != nil {
+				return SurveyResponse{}, err
+			}
+		}
+
+		answer := Answer{QuestionID: a.QuestionID, Value: value}
+		if a.ShownAt != nil {
+			answer.ShownAt = *a.ShownAt
+		}
+		if a.AnsweredAt != nil {
+			answer.AnsweredAt = *a.AnsweredAt
+		}
+
+		response.Answers = append(response.Answers, answer)
+	}
+
+	return response, nil
+}
+
+func (s *surveyResponseServiceImpl) StartSession(sessionID string, survey Survey) (*SurveySession, error) {
+	if !survey.IsOpen(now()) {
+		return nil, fault.NewClientError("survey is not open", nil)
+	}
+
+	if _, ok := survey.Questions[survey.StartID]; !ok {
+		return nil, errors.New("invalid start question")
+	}
+
+	return &SurveySession{
+		ID:        sessionID,
+		SurveyID:  survey.ID,
+		Answers:   make(map[string]any),
+		CurrentID: survey.StartID,
+		Timings: map[string]AnswerTiming{
+			survey.StartID: {ShownAt: now()},
+		},
+	}, nil
 }
 
 func (s *surveyResponseServiceImpl) AnswerQuestion(session *SurveySession, questionID string, answer any, survey Survey) (*Question, error) {
@@ -102,13 +687,31 @@ func (s *surveyResponseServiceImpl) AnswerQuestion(session *SurveySession, quest
 		return nil, errors.New("survey already completed")
 	}
 
-	session.Answers[questionID] = answer
+	if !survey.IsOpen(now()) {
+		return nil, fault.NewClientError("survey is not open", nil)
+	}
 
 	current, ok := survey.Questions[questionID]
 	if !ok {
 		return nil, errors.New("invalid question")
 	}
 
+	if err := current.ValidateAnswer(answer); err != nil {
+		return nil, fault.NewClientError(fmt.Sprintf("invalid answer to question %q", questionID), err)
+	}
+
+	// the routing compares the numbers given as numeric strings as numbers
+	session.Answers[questionID] = current.NormalizeAnswer(answer)
+
+	if session.Timings == nil {
+		session.Timings = make(map[string]AnswerTiming)
+	}
+
+	answeredAt := now()
+	timing := session.Timings[questionID]
+	timing.AnsweredAt = answeredAt
+	session.Timings[questionID] = timing
+
 	input := session.Answers
 
 	nextQuestionID, err := s.GetNextQuestionWithLogic(current, input)
@@ -116,6 +719,13 @@ func (s *surveyResponseServiceImpl) AnswerQuestion(session *SurveySession, quest
 		return nil, err
 	}
 
+	if _, ok := survey.Endings[nextQuestionID]; ok {
+		session.Completed = true
+		session.CurrentID = ""
+		session.EndingID = nextQuestionID
+		return nil, nil
+	}
+
 	nextQuestion, exists := survey.Questions[nextQuestionID]
 
 	if !exists {
@@ -126,6 +736,7 @@ func (s *surveyResponseServiceImpl) AnswerQuestion(session *SurveySession, quest
 
 	session.Completed = true
 	session.CurrentID = nextQuestion.ID
+	session.Timings[nextQuestion.ID] = AnswerTiming{ShownAt: answeredAt}
 	return &nextQuestion, nil
 }
 
@@ -144,6 +755,36 @@ func (s *surveyResponseServiceImpl) GetNextQuestionWithLogic(question Question,
 	return "", nil
 }
 
+// Builds the response out of the session answers including their timings.
+func (session *SurveySession) ToResponse(responseID string) SurveyResponse {
+	answers := make([]Answer, 0, len(session.Answers))
+
+	for questionID, value := range session.Answers {
+		timing := session.Timings[questionID]
+		answers = append(answers, Answer{
+			QuestionID: questionID,
+			Value:      value,
+			ShownAt:    timing.ShownAt,
+			AnsweredAt: timing.AnsweredAt,
+		})
+	}
+
+	sort.Slice(answers, func(i, j int) bool {
+		if answers[i].AnsweredAt.Equal(answers[j].AnsweredAt) {
+			return answers[i].QuestionID < answers[j].QuestionID
+		}
+		return answers[i].AnsweredAt.Before(answers[j].AnsweredAt)
+	})
+
+	return SurveyResponse{
+		ID:           responseID,
+		SurveyID:     session.SurveyID,
+		Answers:      answers,
+		HiddenFields: session.HiddenFields,
+		CreatedAt:    now(),
+	}
+}
+
 func evaluateExpression(expression string, input map[string]any) (bool, error) {
 	program, err := expr.Compile(expression, expr.Env(input))
 	if err != nil {
@@ -164,5 +805,65 @@ func evaluateExpression(expression string, input map[string]any) (bool, error) {
 	return result, nil
 }
 
+// Lists the variables referenced by the expression, typically question IDs.
+func expressionIdentifiers(expression string) ([]string, error) {
+	collector, err := collectIdentifiers(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return collector.variables(), nil
+}
+
+func collectIdentifiers(expression string) (*identifierCollector, error) {
+	tree, err := parser.Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := &identifierCollector{
+		offsets: make(map[string]int),
+		uses:    make(map[string]int),
+		calls:   make(map[string]int),
+	}
+	ast.Walk(&tree.Node, collector)
+
+	return collector, nil
+}
+
+type identifierCollector struct {
+	order   []string
+	offsets map[string]int // first offset of the identifier in the expression
+	uses    map[string]int
+	calls   map[string]int
+}
+
+func (c *identifierCollector) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.CallNode:
+		if ident, ok := n.Callee.(*ast.IdentifierNode); ok {
+			c.calls[ident.Value]++
+		}
+	case *ast.IdentifierNode:
+		if c.uses[n.Value] == 0 {
+			c.order = append(c.order, n.Value)
+			c.offsets[n.Value] = n.Location().From
+		}
+		c.uses[n.Value]++
+	}
+}
+
+// The identifiers used as variables, function names are identifiers too.
+func (c *identifierCollector) variables() []string {
+	var names []string
+	for _, name := range c.order {
+		if c.uses[name] > c.calls[name] {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
 // TODO: do we have to implement separate service for storing survey and their state to
 // make the `SurveyResponseService` works for the answering workflow only.
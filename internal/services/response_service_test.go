@@ -1,13 +1,22 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/lib/pq"
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/store"
 )
 
 func TestAnswerQuestion_WithValidConditionalMatch(t *testing.T) {
-	svc := NewSurveyService()
-	responseservice := NewSurveyResponseService(svc)
+	svc := NewSurveyService(nil, nil)
+	responseservice := NewSurveyResponseService(svc, nil)
 
 	question := Question{
 		ID:   "q1",
@@ -48,6 +57,7 @@ func TestAnswerQuestion_WithValidConditionalMatch(t *testing.T) {
 		ID:      "s1",
 		Title:   "Age Check",
 		StartID: "q1",
+		Status:  SurveyOpen,
 		Questions: map[string]Question{
 			"q1": question,
 			"q2": nextQuestion,
@@ -78,8 +88,8 @@ func TestAnswerQuestion_WithValidConditionalMatch(t *testing.T) {
 }
 
 func TestAnswerQuestion_AlternativeMatch(t *testing.T) {
-	svc := NewSurveyService()
-	responseservice := NewSurveyResponseService(svc)
+	svc := NewSurveyService(nil, nil)
+	responseservice := NewSurveyResponseService(svc, nil)
 
 	question := Question{
 		ID:   "q1",
@@ -120,6 +130,7 @@ func TestAnswerQuestion_AlternativeMatch(t *testing.T) {
 		ID:      "s1",
 		Title:   "Age Check",
 		StartID: "q1",
+		Status:  SurveyOpen,
 		Questions: map[string]Question{
 			"q1": question,
 			"q2": nextQuestion,
@@ -149,11 +160,38 @@ func TestAnswerQuestion_AlternativeMatch(t *testing.T) {
 	}
 }
 
+func TestAnswerQuestion_NumericString(t *testing.T) {
+	responseservice := NewSurveyResponseService(NewSurveyService(nil, nil), nil)
+
+	survey, err := NewSurveyFromTemplate(TemplateNPS, TemplateParams{CompanyName: "Acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	survey.Status = SurveyOpen
+
+	session, err := responseservice.StartSession("sess1", *survey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	q, err := responseservice.AnswerQuestion(session, "nps", "9", *survey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q == nil || q.ID != "promoter_reason" {
+		t.Errorf("expected next question to be promoter_reason, got %v", q)
+	}
+	if session.Answers["nps"] != float64(9) {
+		t.Errorf("expected the answer to be stored as a number, got %#v", session.Answers["nps"])
+	}
+}
+
 func TestAnswerQuestion_InvalidQuestion(t *testing.T) {
-	svc := NewSurveyService()
-	responseservice := NewSurveyResponseService(svc)
+	svc := NewSurveyService(nil, nil)
+	responseservice := NewSurveyResponseService(svc, nil)
 	survey := Survey{
 		ID:        "s1",
+		Status:    SurveyOpen,
 		Questions: map[string]Question{},
 	}
 	session := &SurveySession{
@@ -175,8 +213,8 @@ func TestAnswerQuestion_InvalidQuestion(t *testing.T) {
 }
 
 func TestAnswerQuestion_NoConditionalMatch(t *testing.T) {
-	svc := NewSurveyService()
-	responseservice := NewSurveyResponseService(svc)
+	svc := NewSurveyService(nil, nil)
+	responseservice := NewSurveyResponseService(svc, nil)
 
 	q1 := Question{
 		ID:   "q1",
@@ -193,6 +231,7 @@ func TestAnswerQuestion_NoConditionalMatch(t *testing.T) {
 	survey := Survey{
 		ID:      "s1",
 		StartID: "q1",
+		Status:  SurveyOpen,
 		Questions: map[string]Question{
 			"q1": q1,
 		},
@@ -218,8 +257,8 @@ func TestAnswerQuestion_NoConditionalMatch(t *testing.T) {
 }
 
 func TestAnswerQuestion_AlreadyCompleted(t *testing.T) {
-	svc := NewSurveyService()
-	responseservice := NewSurveyResponseService(svc)
+	svc := NewSurveyService(nil, nil)
+	responseservice := NewSurveyResponseService(svc, nil)
 
 	survey := Survey{
 		ID:        "s1",
@@ -259,3 +298,197 @@ func TestEvaluateExpression_NonBooleanResult(t *testing.T) {
 		t.Errorf("expected result to be false, got true")
 	}
 }
+
+// In memory response store, the after save commit hooks run synchronously.
+type memoryResponseStore struct {
+	store.Datastorer[models.SurveyResponse]
+	hooks store.Hooks
+	saved map[string]*models.SurveyResponseDTO
+}
+
+func (m *memoryResponseStore) SetHooks(hooks store.Hooks) {
+	m.hooks = hooks
+}
+
+// Only the weights update of `SaveWeights` is supported.
+func (m *memoryResponseStore) BulkUpdate(ctx context.Context, query string, args ...any) error {
+	responseIDs, weights := args[1].(*pq.StringArray), args[2].(*pq.Float64Array)
+
+	for i, responseID := range *responseIDs {
+		if dto, ok := m.saved[fmt.Sprintf("%v/%s", args[0], responseID)]; ok {
+			dto.Weight = (*weights)[i]
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryResponseStore) Create(ctx context.Context, data store.DTO) (any, error) {
+	dto := data.(*models.SurveyResponseDTO)
+
+	key := dto.SurveyID + "/" + dto.ResponseID
+	if _, ok := m.saved[key]; ok {
+		return nil, fault.ErrUniqueViolation
+	}
+	m.saved[key] = dto
+
+	model := dto.ToModel(len(m.saved))
+	for _, hook := range m.hooks.AfterSaveCommit {
+		if fn := hook(ctx, data, model, true); fn != nil {
+			fn()
+		}
+	}
+
+	return model, nil
+}
+
+func TestSaveResponse(t *testing.T) {
+	surveys := &memorySurveyService{surveys: map[string]Survey{
+		"s1": {
+			ID:      "s1",
+			StartID: "q1",
+			Status:  SurveyOpen,
+			Questions: map[string]Question{
+				"q1": {ID: "q1", Type: MultipleChoice, Options: []string{"yes", "no"}},
+				"q2": {ID: "q2", Type: Text},
+			},
+		},
+	}}
+	responses := &memoryResponseStore{saved: make(map[string]*models.SurveyResponseDTO)}
+	responseservice := NewSurveyResponseService(surveys, responses)
+
+	var completed []SurveyResponse
+	responseservice.SubscribeResponseCompleted(func(ctx context.Context, response SurveyResponse) {
+		completed = append(completed, response)
+	})
+
+	response := SurveyResponse{
+		ID:       "r1",
+		SurveyID: "s1",
+		Answers: []Answer{
+			{QuestionID: "q1", Value: "yes"},
+			{QuestionID: "q2", Value: "developer"},
+		},
+	}
+
+	if err := responseservice.SaveResponse(response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(completed) != 1 || completed[0].ID != "r1" || len(completed[0].Answers) != 2 {
+		t.Errorf("expected the response completed event, got %+v", completed)
+	}
+
+	err := responseservice.SaveResponse(response)
+	if err == nil || !fault.IsClientError(err) || !errors.Is(err, fault.ErrUniqueViolation) {
+		t.Errorf("expected a duplicate response client error, got %v", err)
+	}
+}
+
+func TestSaveResponse_NumericStrings(t *testing.T) {
+	surveys := &memorySurveyService{surveys: map[string]Survey{
+		"s1": {
+			ID:      "s1",
+			StartID: "score",
+			Status:  SurveyOpen,
+			Questions: map[string]Question{
+				"score": {ID: "score", Type: Rating, Options: RatingScale(0, 10)},
+				"age":   {ID: "age", Type: Numeric},
+				"why":   {ID: "why", Type: Text},
+			},
+		},
+	}}
+	responses := &memoryResponseStore{saved: make(map[string]*models.SurveyResponseDTO)}
+	responseservice := NewSurveyResponseService(surveys, responses)
+
+	response := SurveyResponse{
+		ID:       "r1",
+		SurveyID: "s1",
+		Answers: []Answer{
+			{QuestionID: "score", Value: "9"},
+			{QuestionID: "age", Value: " 34.5"},
+			{QuestionID: "why", Value: "42"},
+		},
+	}
+
+	if err := responseservice.SaveResponse(response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stored := make(map[string]string)
+	for _, answer := range responses.saved["s1/r1"].Answers {
+		stored[answer.QuestionID] = string(answer.Value)
+	}
+
+	// the text answers are kept as given
+	if want := map[string]string{"score": "9", "age": "34.5", "why": `"42"`}; !reflect.DeepEqual(stored, want) {
+		t.Errorf("expected the stored answers %v, got %v", want, stored)
+	}
+	if response.Answers[0].Value != "9" {
+		t.Errorf("expected the answers of the caller to be left untouched, got %#v", response.Answers[0].Value)
+	}
+}
+
+func TestSaveWeights(t *testing.T) {
+	surveys := &memorySurveyService{surveys: map[string]Survey{
+		"1": {ID: "1", StartID: "q1", Status: SurveyOpen, Questions: map[string]Question{"q1": {ID: "q1", Type: Text}}},
+	}}
+	responses := &memoryResponseStore{saved: make(map[string]*models.SurveyResponseDTO)}
+	responseservice := NewSurveyResponseService(surveys, responses)
+
+	var saved []string
+	responseservice.SubscribeWeightsSaved(func(ctx context.Context, surveyID string) {
+		saved = append(saved, surveyID)
+	})
+
+	if err := responseservice.SaveResponse(SurveyResponse{ID: "r1", SurveyID: "1", Answers: []Answer{{QuestionID: "q1", Value: "hi"}}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := responseservice.SaveWeights("1", map[string]float64{"r1": 2.5}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if responses.saved["1/r1"].Weight != 2.5 || len(saved) != 1 || saved[0] != "1" {
+		t.Errorf("expected the weights to be saved then dispatched, got weight %v and %v", responses.saved["1/r1"].Weight, saved)
+	}
+
+	if err := responseservice.SaveWeights("1", map[string]float64{"r1": 0}); err == nil || !fault.IsClientError(err) {
+		t.Errorf("expected a client error for a zero weight, got %v", err)
+	}
+	if len(saved) != 1 {
+		t.Errorf("expected the invalid weights not to be dispatched, got %v", saved)
+	}
+}
+
+func TestSaveResponse_InvalidAnswers(t *testing.T) {
+	surveys := &memorySurveyService{surveys: map[string]Survey{
+		"s1": {
+			ID:      "s1",
+			StartID: "q1",
+			Status:  SurveyOpen,
+			Questions: map[string]Question{
+				"q1": {ID: "q1", Type: MultipleChoice, Options: []string{"yes", "no"}},
+			},
+		},
+	}}
+	responseservice := NewSurveyResponseService(surveys, &memoryResponseStore{saved: make(map[string]*models.SurveyResponseDTO)})
+
+	tests := []struct {
+		name     string
+		answers  []Answer
+		contains string
+	}{
+		{name: "Unknown option", answers: []Answer{{QuestionID: "q1", Value: "maybe"}}, contains: "not one of the options"},
+		{name: "Unknown question", answers: []Answer{{QuestionID: "q9", Value: "yes"}}, contains: "does not exist"},
+		{name: "Answered twice", answers: []Answer{{QuestionID: "q1", Value: "yes"}, {QuestionID: "q1", Value: "no"}}, contains: "more than once"},
+		{name: "No answers", contains: "no answers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := responseservice.SaveResponse(SurveyResponse{ID: "r1", SurveyID: "s1", Answers: tt.answers})
+			if err == nil || !fault.IsClientError(err) || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("expected a client error containing %q, got %v", tt.contains, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,431 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/store"
+)
+
+// NOTE: the aggregates are computed by postgres over the stored answers, only a few
+// rows per question are read back, never the responses themselves. They are weighted
+// by the response weights, the weights default to 1 so unweighted surveys get the
+// plain counts, mean, median and standard deviation.
+
+// The number of bins of the numeric questions histogram.
+const DefaultHistogramBins = 10
+
+const (
+	resultsFrom = `FROM survey_answers a JOIN survey_responses r ON r.id = a.response_id WHERE r.survey_id = $1`
+
+	answeredQuery = `SELECT a.question_id, '' AS value, COUNT(*) AS count, SUM(r.weight) AS weighted ` + resultsFrom + `
+		AND a.value IS NOT NULL AND jsonb_typeof(a.value) <> 'null'
+		GROUP BY a.question_id`
+
+	valueCountsQuery = `SELECT a.question_id, a.value #>> '{}' AS value, COUNT(*) AS count, SUM(r.weight) AS weighted ` + resultsFrom + `
+		AND a.question_id = ANY($2) AND jsonb_typeof(a.value) IN ('string', 'number')
+		GROUP BY 1, 2`
+
+	numbersCTE = `WITH numbers AS (
+		SELECT a.question_id, (a.value #>> '{}')::float8 AS v, r.weight AS w ` + resultsFrom + `
+		AND a.question_id = ANY($2) AND jsonb_typeof(a.value) IN ('number', 'string')
+		AND (a.value #>> '{}') ~ '^-?[0-9]+(\.[0-9]+)?$'
+	)`
+
+	// The weighted median is the mean of the lowest values with at least and with more
+	// than half of the weight below, the usual median when unweighted. The standard
+	// deviation uses the reliability weights correction, n - 1 when unweighted.
+	numericQuery = numbersCTE + `, stats AS (
+		SELECT question_id, COUNT(*) AS count, SUM(w) AS weighted, SUM(w * v) / SUM(w) AS mean,
+			SUM(w * w) AS squares, MIN(v) AS min, MAX(v) AS max
+		FROM numbers GROUP BY question_id
+	), cumulative AS (
+		SELECT question_id, v, SUM(w) OVER (PARTITION BY question_id ORDER BY v ROWS UNBOUNDED PRECEDING) AS below
+		FROM numbers
+	)
+		SELECT s.question_id, s.count, s.weighted, s.mean,
+			((SELECT MIN(c.v) FROM cumulative c WHERE c.question_id = s.question_id AND c.below >= s.weighted / 2)
+				+ (SELECT MIN(c.v) FROM cumulative c WHERE c.question_id = s.question_id AND c.below > s.weighted / 2)) / 2 AS median,
+			COALESCE(sqrt((SELECT SUM(n.w * (n.v - s.mean) ^ 2) FROM numbers n WHERE n.question_id = s.question_id)
+				/ NULLIF(s.weighted - s.squares / s.weighted, 0)), 0) AS stddev,
+			s.min, s.max
+		FROM stats s`
+
+	histogramQuery = numbersCTE + `, bounds AS (
+		SELECT question_id, MIN(v) AS lo, MAX(v) AS hi FROM numbers GROUP BY question_id
+	)
+		SELECT n.question_id, CASE WHEN b.hi = b.lo THEN 1 ELSE LEAST(width_bucket(n.v, b.lo, b.hi, $3), $3) END AS bin,
+			COUNT(*) AS count, SUM(n.w) AS weighted
+		FROM numbers n JOIN bounds b ON b.question_id = n.question_id
+		GROUP BY 1, 2`
+
+	rankQuery = `SELECT a.question_id, e.option, (SUM(r.weight * e.rank) / SUM(r.weight))::float8 AS average_rank,
+			COUNT(*) AS count, SUM(r.weight) AS weighted
+		FROM survey_answers a JOIN survey_responses r ON r.id = a.response_id
+		CROSS JOIN LATERAL jsonb_array_elements_text(a.value) WITH ORDINALITY AS e(option, rank)
+		WHERE r.survey_id = $1 AND a.question_id = ANY($2) AND jsonb_typeof(a.value) = 'array'
+		GROUP BY 1, 2`
+)
+
+// The results of a single question.
+type QuestionSummary struct {
+	QuestionID string
+	Type       QuestionType
+	// The responses answering the question.
+	Answered int
+	// The sum of the weights of the responses answering the question.
+	Weighted float64
+	// The responses without answer, skipped or never shown the question.
+	Skipped int
+	// The counts of the choices or of the rating points, in the question order.
+	Options []OptionSummary
+	// The numeric and rating questions statistics.
+	Numeric *NumericSummary
+	// The ranking options from the best average rank.
+	Ranks []RankSummary
+}
+
+type OptionSummary struct {
+	Option   string
+	Count    int
+	Weighted float64
+	// Of the weighted responses answering the question.
+	Percent float64
+}
+
+// Weighted by the response weights but for the count, the minimum and the maximum.
+type NumericSummary struct {
+	Count    int
+	Weighted float64
+	Mean     float64
+	Median   float64
+	// The sample standard deviation.
+	StdDev    float64
+	Min       float64
+	Max       float64
+	Histogram []HistogramBin
+}
+
+// The answers from `From` to `To`, the upper bound is exclusive but for the last bin.
+type HistogramBin struct {
+	From     float64
+	To       float64
+	Count    int
+	Weighted float64
+}
+
+type RankSummary struct {
+	Option      string
+	AverageRank float64
+	// The responses ranking the option.
+	Count    int
+	Weighted float64
+}
+
+// Handles the results dashboard aggregates.
+type ResultsService interface {
+	// Summarizes every question of the survey, in flow order.
+	SummarizeSurvey(surveyID string) ([]QuestionSummary, error)
+	// Summarizes every question over the responses matching the filter expression, see
+	// `CompileResponseFilter`.
+	SummarizeFilteredSurvey(surveyID string, filter string) ([]QuestionSummary, error)
+	// Computes the funnel of the survey out of its saved responses, see
+	// `SessionsFromResponses`.
+	GetFunnel(surveyID string) (*Funnel, error)
+	// Computes the funnel over the responses matching the filter expression, see
+	// `CompileResponseFilter`.
+	GetFilteredFunnel(surveyID string, filter string) (*Funnel, error)
+}
+
+type resultsServiceImpl struct {
+	surveyservice SurveyService
+	answers       store.Datastorer[models.Answer]
+}
+
+// Instantiate the `ResultsService`.
+func NewResultsService(surveyservice SurveyService, answers store.Datastorer[models.Answer]) ResultsService {
+	return &resultsServiceImpl{surveyservice: surveyservice, answers: answers}
+}
+
+// The aggregates read back from the database.
+type resultRows struct {
+	answered  []models.AnswerCount
+	values    []models.AnswerCount
+	numeric   []models.NumericAggregate
+	histogram []models.HistogramCount
+	ranks     []models.RankAggregate
+}
+
+func (s *resultsServiceImpl) SummarizeSurvey(surveyID string) ([]QuestionSummary, error) {
+	return s.SummarizeFilteredSurvey(surveyID, "")
+}
+
+func (s *resultsServiceImpl) SummarizeFilteredSurvey(surveyID string, expression string) ([]QuestionSummary, error) {
+	survey, err := s.surveyservice.GetSurvey(surveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := CompileResponseFilter(*survey, expression)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.Atoi(survey.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid survey id %q: %w", survey.ID, err)
+	}
+
+	var counted, numeric, ranking []string
+	for _, question := range survey.Questions {
+		switch question.Type {
+		case MultipleChoice:
+			counted = append(counted, question.ID)
+		case Rating:
+			counted = append(counted, question.ID)
+			numeric = append(numeric, question.ID)
+		case Numeric:
+			numeric = append(numeric, question.ID)
+		case Ranking:
+			ranking = append(ranking, question.ID)
+		}
+	}
+
+	ctx := context.Background()
+	db := s.answers.Base()
+
+	if filter, err = resolveFilter(ctx, db, id, filter); err != nil {
+		return nil, err
+	}
+
+	// the queries restricted to the responses matching the filter
+	sel := func(dest any, query string, args ...any) error {
+		query, args = filter.restrict(query, args...)
+		return db.SelectContext(ctx, dest, query, args...)
+	}
+
+	var rows resultRows
+
+	if err := sel(&rows.answered, answeredQuery, id); err != nil {
+		return nil, err
+	}
+
+	if len(counted) > 0 {
+		if err := sel(&rows.values, valueCountsQuery, id, pq.Array(counted)); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(numeric) > 0 {
+		if err := sel(&rows.numeric, numericQuery, id, pq.Array(numeric)); err != nil {
+			return nil, err
+		}
+		if err := sel(&rows.histogram, histogramQuery, id, pq.Array(numeric), DefaultHistogramBins); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ranking) > 0 {
+		if err := sel(&rows.ranks, rankQuery, id, pq.Array(ranking)); err != nil {
+			return nil, err
+		}
+	}
+
+	total := survey.ResponseCount
+	if filter != nil {
+		query, args := filter.restrict("SELECT COUNT(*) FROM survey_responses r WHERE r.survey_id = $1", id)
+		if err := db.GetContext(ctx, &total, query, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	return summarizeQuestions(*survey, total, rows), nil
+}
+
+func (s *resultsServiceImpl) GetFunnel(surveyID string) (*Funnel, error) {
+	return s.GetFilteredFunnel(surveyID, "")
+}
+
+func (s *resultsServiceImpl) GetFilteredFunnel(surveyID string, expression string) (*Funnel, error) {
+	survey, err := s.surveyservice.GetSurvey(surveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := CompileResponseFilter(*survey, expression)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.Atoi(survey.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid survey id %q: %w", survey.ID, err)
+	}
+
+	var responses []SurveyResponse
+	err = streamResponses(context.Background(), s.answers.Base(), id, time.Time{}, time.Time{}, filter, func(response SurveyResponse) error {
+		responses = append(responses, response)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	funnel := ComputeFunnel(*survey, SessionsFromResponses(*survey, responses))
+	return &funnel, nil
+}
+
+// Assembles the summaries of the survey questions out of the aggregates.
+func summarizeQuestions(survey Survey, total int, rows resultRows) []QuestionSummary {
+	answered := make(map[string]models.AnswerCount)
+	for _, row := range rows.answered {
+		answered[row.QuestionID] = row
+	}
+
+	values := make(map[string]map[string]models.AnswerCount)
+	for _, row := range rows.values {
+		if values[row.QuestionID] == nil {
+			values[row.QuestionID] = make(map[string]models.AnswerCount)
+		}
+		// the same number stored as text and as a number
+		value := values[row.QuestionID][row.Value]
+		value.Count += row.Count
+		value.Weighted += row.Weighted
+		values[row.QuestionID][row.Value] = value
+	}
+
+	numeric := make(map[string]models.NumericAggregate)
+	for _, row := range rows.numeric {
+		numeric[row.QuestionID] = row
+	}
+
+	bins := make(map[string]map[int]models.HistogramCount)
+	for _, row := range rows.histogram {
+		if bins[row.QuestionID] == nil {
+			bins[row.QuestionID] = make(map[int]models.HistogramCount)
+		}
+		bins[row.QuestionID][row.Bin] = row
+	}
+
+	ranks := make(map[string][]RankSummary)
+	for _, row := range rows.ranks {
+		ranks[row.QuestionID] = append(ranks[row.QuestionID], RankSummary{Option: row.Option, AverageRank: row.AverageRank, Count: row.Count, Weighted: row.Weighted})
+	}
+
+	summaries := make([]QuestionSummary, 0, len(survey.Questions))
+
+	for _, id := range survey.OrderedQuestionIDs() {
+		question := survey.Questions[id]
+
+		summary := QuestionSummary{
+			QuestionID: id,
+			Type:       question.Type,
+			Answered:   answered[id].Count,
+			Weighted:   answered[id].Weighted,
+			Skipped:    max(total-answered[id].Count, 0),
+		}
+
+		switch question.Type {
+		case MultipleChoice, Rating:
+			summary.Options = optionSummaries(question.Options, values[id], summary.Weighted)
+		}
+
+		if aggregate, ok := numeric[id]; ok && (question.Type == Rating || question.Type == Numeric) {
+			summary.Numeric = &NumericSummary{
+				Count:    aggregate.Count,
+				Weighted: aggregate.Weighted,
+				Mean:     aggregate.Mean,
+				Median:   aggregate.Median,
+				StdDev:   aggregate.StdDev,
+				Min:      aggregate.Min,
+				Max:      aggregate.Max,
+			}
+
+			if question.Type == Rating {
+				// a bin per point of the scale
+				for _, option := range summary.Options {
+					point, err := strconv.ParseFloat(option.Option, 64)
+					if err != nil {
+						continue
+					}
+					summary.Numeric.Histogram = append(summary.Numeric.Histogram, HistogramBin{From: point, To: point, Count: option.Count, Weighted: option.Weighted})
+				}
+			} else {
+				summary.Numeric.Histogram = histogramBins(aggregate.Min, aggregate.Max, DefaultHistogramBins, bins[id])
+			}
+		}
+
+		if question.Type == Ranking {
+			summary.Ranks = ranks[id]
+			sort.Slice(summary.Ranks, func(i, j int) bool {
+				if summary.Ranks[i].AverageRank == summary.Ranks[j].AverageRank {
+					return summary.Ranks[i].Option < summary.Ranks[j].Option
+				}
+				return summary.Ranks[i].AverageRank < summary.Ranks[j].AverageRank
+			})
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
+
+// The counts in the order of the options, values no longer in the options come last sorted.
+func optionSummaries(options []string, counts map[string]models.AnswerCount, answered float64) []OptionSummary {
+	summaries := make([]OptionSummary, 0, len(options))
+
+	add := func(option string) {
+		summary := OptionSummary{Option: option, Count: counts[option].Count, Weighted: counts[option].Weighted}
+		if answered > 0 {
+			summary.Percent = summary.Weighted / answered * 100
+		}
+		summaries = append(summaries, summary)
+	}
+
+	for _, option := range options {
+		add(option)
+	}
+
+	var others []string
+	for value := range counts {
+		if !slices.Contains(options, value) {
+			others = append(others, value)
+		}
+	}
+	sort.Strings(others)
+
+	for _, value := range others {
+		add(value)
+	}
+
+	return summaries
+}
+
+// The equal width bins between min and max, empty bins included.
+func histogramBins(min, max float64, n int, counts map[int]models.HistogramCount) []HistogramBin {
+	if min == max {
+		return []HistogramBin{{From: min, To: max, Count: counts[1].Count, Weighted: counts[1].Weighted}}
+	}
+
+	width := (max - min) / float64(n)
+	histogram := make([]HistogramBin, 0, n)
+
+	for bin := 1; bin <= n; bin++ {
+		histogram = append(histogram, HistogramBin{
+			From:     min + float64(bin-1)*width,
+			To:       min + float64(bin)*width,
+			Count:    counts[bin].Count,
+			Weighted: counts[bin].Weighted,
+		})
+	}
+	histogram[n-1].To = max
+
+	return histogram
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/paulexconde/justasking/internal/models"
+)
+
+func TestSummarizeQuestions(t *testing.T) {
+	survey := Survey{
+		StartID: "color",
+		Questions: map[string]Question{
+			"color": {ID: "color", Type: MultipleChoice, Options: []string{"red", "blue"}, Conditionals: []ConditionalNext{{Expression: "true", NextID: "score"}}},
+			"score": {ID: "score", Type: Rating, Options: RatingScale(1, 3), Conditionals: []ConditionalNext{{Expression: "true", NextID: "age"}}},
+			"age":   {ID: "age", Type: Numeric, Conditionals: []ConditionalNext{{Expression: "true", NextID: "rank"}}},
+			"rank":  {ID: "rank", Type: Ranking, Options: []string{"a", "b"}, Conditionals: []ConditionalNext{{Expression: "true", NextID: "why"}}},
+			"why":   {ID: "why", Type: Text},
+		},
+	}
+
+	rows := resultRows{
+		answered: []models.AnswerCount{{QuestionID: "color", Count: 4, Weighted: 4}, {QuestionID: "score", Count: 4, Weighted: 4}, {QuestionID: "age", Count: 3, Weighted: 3}, {QuestionID: "rank", Count: 2, Weighted: 2}, {QuestionID: "why", Count: 1, Weighted: 1}},
+		values: []models.AnswerCount{
+			{QuestionID: "color", Value: "blue", Count: 3, Weighted: 3},
+			{QuestionID: "color", Value: "green", Count: 1, Weighted: 1},
+			{QuestionID: "score", Value: "3", Count: 3, Weighted: 3},
+			{QuestionID: "score", Value: "1", Count: 1, Weighted: 1},
+		},
+		numeric: []models.NumericAggregate{
+			{QuestionID: "score", Count: 4, Weighted: 4, Mean: 2.5, Median: 3, StdDev: 1, Min: 1, Max: 3},
+			{QuestionID: "age", Count: 3, Weighted: 3, Mean: 30, Median: 30, StdDev: 10, Min: 20, Max: 40},
+		},
+		histogram: []models.HistogramCount{{QuestionID: "age", Bin: 1, Count: 1, Weighted: 1}, {QuestionID: "age", Bin: 5, Count: 1, Weighted: 1}, {QuestionID: "age", Bin: 10, Count: 1, Weighted: 1}},
+		ranks:     []models.RankAggregate{{QuestionID: "rank", Option: "a", AverageRank: 1.5, Count: 2, Weighted: 2}, {QuestionID: "rank", Option: "b", AverageRank: 1.5, Count: 2, Weighted: 2}},
+	}
+
+	summaries := summarizeQuestions(survey, 5, rows)
+	if len(summaries) != 5 || summaries[0].QuestionID != "color" || summaries[4].QuestionID != "why" {
+		t.Fatalf("expected the summaries in flow order, got %+v", summaries)
+	}
+
+	color := summaries[0]
+	if len(color.Options) != 3 || color.Options[0].Option != "red" || color.Options[0].Count != 0 || color.Options[1].Percent != 75 || color.Options[2].Option != "green" {
+		t.Errorf("unexpected choice summary %+v", color.Options)
+	}
+
+	score := summaries[1]
+	if score.Numeric == nil || len(score.Numeric.Histogram) != 3 || score.Numeric.Histogram[2].Count != 3 || score.Numeric.Histogram[1].Count != 0 {
+		t.Errorf("expected a histogram bin per point, got %+v", score.Numeric)
+	}
+
+	age := summaries[2]
+	if age.Numeric == nil || len(age.Numeric.Histogram) != DefaultHistogramBins || age.Numeric.Histogram[9].To != 40 || age.Numeric.Histogram[4].From != 28 || age.Numeric.Histogram[4].Count != 1 {
+		t.Errorf("unexpected numeric summary %+v", age.Numeric)
+	}
+
+	if ranks := summaries[3].Ranks; len(ranks) != 2 || ranks[0].Option != "a" {
+		t.Errorf("unexpected ranks %+v", ranks)
+	}
+
+	if why := summaries[4]; why.Answered != 1 || why.Skipped != 4 || why.Options != nil || why.Numeric != nil {
+		t.Errorf("unexpected text summary %+v", why)
+	}
+}
+
+func TestValidateAnswer_RankingAndNumeric(t *testing.T) {
+	ranking := Question{ID: "rank", Type: Ranking, Options: []string{"a", "b", "c"}}
+
+	if err := ranking.ValidateAnswer([]any{"b", "a"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ranking.ValidateAnswer([]string{"a", "a"}); err == nil {
+		t.Error("expected an error for an option ranked twice")
+	}
+	if err := ranking.ValidateAnswer([]string{"d"}); err == nil {
+		t.Error("expected an error for an unknown option")
+	}
+
+	numeric := Question{ID: "age", Type: Numeric}
+	if err := numeric.ValidateAnswer(41.5); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := numeric.ValidateAnswer("old"); err == nil {
+		t.Error("expected an error for a non numeric answer")
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// NOTE: a speeder is a respondent that completes the survey way faster
+// than everyone else, typically by not reading the questions at all.
+
+// The default ratio of the median completion time below which a response is a speeder.
+const DefaultSpeederRatio = 1.0 / 3.0
+
+// The rules used to flag the speeders.
+type SpeederRule struct {
+	// Responses completed faster than `Ratio * median` are flagged.
+	// Defaults to `DefaultSpeederRatio` when zero.
+	Ratio float64
+	// Optional absolute floor, responses completed faster than this are always flagged.
+	MinDuration time.Duration
+	// Minimum number of timed responses needed before comparing against the median.
+	MinResponses int
+}
+
+// Holds why a response was flagged as a speeder.
+type SpeederFlag struct {
+	ResponseID string
+	Duration   time.Duration
+	Median     time.Duration
+	Reason     string
+}
+
+// The time spent by the respondent from the first question shown until the last answer.
+//
+// Returns zero when the answers have no timing metadata.
+func (r SurveyResponse) Duration() time.Duration {
+	var first, last time.Time
+
+	for _, answer := range r.Answers {
+		if !answer.ShownAt.IsZero() && (first.IsZero() || answer.ShownAt.Before(first)) {
+			first = answer.ShownAt
+		}
+		if !answer.AnsweredAt.IsZero() && answer.AnsweredAt.After(last) {
+			last = answer.AnsweredAt
+		}
+	}
+
+	if first.IsZero() || last.IsZero() || last.Before(first) {
+		return 0
+	}
+
+	return last.Sub(first)
+}
+
+// Flags the responses completed suspiciously fast.
+//
+// Responses without timing metadata are never flagged.
+func DetectSpeeders(responses []SurveyResponse, rule SpeederRule) []SpeederFlag {
+	ratio := rule.Ratio
+	if ratio <= 0 {
+		ratio = DefaultSpeederRatio
+	}
+
+	durations := make([]time.Duration, 0, len(responses))
+	for _, response := range responses {
+		if d := response.Duration(); d > 0 {
+			durations = append(durations, d)
+		}
+	}
+
+	var median time.Duration
+	if len(durations) > 0 && len(durations) >= rule.MinResponses {
+		median = medianDuration(durations)
+	}
+
+	threshold := time.Duration(float64(median) * ratio)
+
+	var flags []SpeederFlag
+
+	for _, response := range responses {
+		d := response.Duration()
+		if d <= 0 {
+			continue
+		}
+
+		switch {
+		case rule.MinDuration > 0 && d < rule.MinDuration:
+			flags = append(flags, SpeederFlag{
+				ResponseID: response.ID,
+				Duration:   d,
+				Median:     median,
+				Reason:     fmt.Sprintf("completed in %s, below the minimum of %s", d, rule.MinDuration),
+			})
+		case median > 0 && d < threshold:
+			flags = append(flags, SpeederFlag{
+				ResponseID: response.ID,
+				Duration:   d,
+				Median:     median,
+				Reason:     fmt.Sprintf("completed in %s, below %.2f of the median %s", d, ratio, median),
+			})
+		}
+	}
+
+	return flags
+}
+
+// Removes the flagged responses so they can be left out of the reports.
+func ExcludeSpeeders(responses []SurveyResponse, flags []SpeederFlag) []SurveyResponse {
+	if len(flags) == 0 {
+		return responses
+	}
+
+	flagged := make(map[string]struct{}, len(flags))
+	for _, flag := range flags {
+		flagged[flag.ResponseID] = struct{}{}
+	}
+
+	kept := make([]SurveyResponse, 0, len(responses))
+	for _, response := range responses {
+		if _, ok := flagged[response.ID]; !ok {
+			kept = append(kept, response)
+		}
+	}
+
+	return kept
+}
+
+func medianDuration(durations []time.Duration) time.Duration {
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+
+	return sorted[mid]
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func timedResponse(id string, start time.Time, took time.Duration) SurveyResponse {
+	return SurveyResponse{
+		ID:       id,
+		SurveyID: "s1",
+		Answers: []Answer{
+			{QuestionID: "q1", Value: "yes", ShownAt: start, AnsweredAt: start.Add(took / 2)},
+			{QuestionID: "q2", Value: "dev", ShownAt: start.Add(took / 2), AnsweredAt: start.Add(took)},
+		},
+	}
+}
+
+func TestDetectSpeeders(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	responses := []SurveyResponse{
+		timedResponse("r1", start, 60*time.Second),
+		timedResponse("r2", start, 90*time.Second),
+		timedResponse("r3", start, 120*time.Second),
+		timedResponse("r4", start, 10*time.Second),
+		{ID: "r5", SurveyID: "s1", Answers: []Answer{{QuestionID: "q1", Value: "yes"}}},
+	}
+
+	flags := DetectSpeeders(responses, SpeederRule{})
+	if len(flags) != 1 {
+		t.Fatalf("expected 1 speeder, got %d: %+v", len(flags), flags)
+	}
+	if flags[0].ResponseID != "r4" {
+		t.Errorf("expected r4 to be flagged, got %s", flags[0].ResponseID)
+	}
+	if flags[0].Median != 75*time.Second {
+		t.Errorf("expected median of 75s, got %s", flags[0].Median)
+	}
+
+	kept := ExcludeSpeeders(responses, flags)
+	if len(kept) != 4 {
+		t.Errorf("expected 4 responses kept, got %d", len(kept))
+	}
+}
+
+func TestDetectSpeeders_MinDuration(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	responses := []SurveyResponse{
+		timedResponse("r1", start, 20*time.Second),
+		timedResponse("r2", start, 25*time.Second),
+	}
+
+	flags := DetectSpeeders(responses, SpeederRule{MinDuration: 22 * time.Second, MinResponses: 10})
+	if len(flags) != 1 || flags[0].ResponseID != "r1" {
+		t.Errorf("expected only r1 to be flagged, got %+v", flags)
+	}
+}
+
+func TestAnswerQuestion_RecordsTimings(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	responseservice := NewSurveyResponseService(NewSurveyService(nil, nil), nil)
+
+	survey := Survey{
+		ID:      "s1",
+		StartID: "q1",
+		Status:  SurveyOpen,
+		Questions: map[string]Question{
+			"q1": {
+				ID:           "q1",
+				Type:         MultipleChoice,
+				Options:      []string{"yes", "no"},
+				Conditionals: []ConditionalNext{{Expression: `q1 == "yes"`, NextID: "q2"}},
+			},
+			"q2": {ID: "q2", Type: Text},
+		},
+	}
+
+	session, err := responseservice.StartSession("sess1", survey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	clock = clock.Add(5 * time.Second)
+	if _, err := responseservice.AnswerQuestion(session, "q1", "yes", survey); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := session.Timings["q1"].Duration(); got != 5*time.Second {
+		t.Errorf("expected q1 to take 5s, got %s", got)
+	}
+	if !session.Timings["q2"].ShownAt.Equal(clock) {
+		t.Errorf("expected q2 to be shown at %s, got %s", clock, session.Timings["q2"].ShownAt)
+	}
+
+	response := session.ToResponse("r1")
+	if len(response.Answers) != 1 || response.Answers[0].Timing().Duration() != 5*time.Second {
+		t.Errorf("expected the response answer to carry the timing, got %+v", response.Answers)
+	}
+}
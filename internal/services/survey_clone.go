@@ -0,0 +1,221 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+// Issues the ID of the clone out of the old question or ending ID.
+type CloneIDFunc func(oldID string) string
+
+// Issues sequential IDs, "q1", "q2"... for the questions in flow order and "end1", "end2"...
+// for the endings sorted by ID.
+func SequentialCloneIDs(survey Survey) CloneIDFunc {
+	ids := make(map[string]string, len(survey.Questions)+len(survey.Endings))
+
+	for i, id := range survey.OrderedQuestionIDs() {
+		ids[id] = "q" + strconv.Itoa(i+1)
+	}
+
+	for i, id := range sortedEndingIDs(survey.Endings) {
+		ids[id] = "end" + strconv.Itoa(i+1)
+	}
+
+	return func(oldID string) string {
+		return ids[oldID]
+	}
+}
+
+// Deep copies the survey under new question and ending IDs.
+//
+// The start question, the `Next` targets, the conditional targets, the identifiers of the
+// conditional expressions and the translations all follow the new IDs. The clone is a draft
+// without ID and responses, nil `newID` defaults to `SequentialCloneIDs`.
+func CloneSurvey(survey Survey, newID CloneIDFunc) (*Survey, error) {
+	if newID == nil {
+		newID = SequentialCloneIDs(survey)
+	}
+
+	ids := make(map[string]string, len(survey.Questions)+len(survey.Endings))
+	issued := make(map[string]string, len(ids))
+
+	remap := func(oldID string) error {
+		id := newID(oldID)
+		if !dslIdentifier.MatchString(id) {
+			return fmt.Errorf("invalid id %q issued for %q", id, oldID)
+		}
+		if other, ok := issued[id]; ok {
+			return fmt.Errorf("id %q issued for both %q and %q", id, other, oldID)
+		}
+
+		ids[oldID] = id
+		issued[id] = oldID
+		return nil
+	}
+
+	for _, id := range sortedQuestionIDs(survey.Questions) {
+		if err := remap(id); err != nil {
+			return nil, fault.NewClientError("cannot clone survey", err)
+		}
+	}
+
+	for _, id := range sortedEndingIDs(survey.Endings) {
+		if err := remap(id); err != nil {
+			return nil, fault.NewClientError("cannot clone survey", err)
+		}
+	}
+
+	// unknown targets are kept as is, the validation reports them
+	target := func(id string) string {
+		if newID, ok := ids[id]; ok {
+			return newID
+		}
+		return id
+	}
+
+	clone := Survey{
+		Title:        survey.Title,
+		StartID:      target(survey.StartID),
+		Locale:       survey.Locale,
+		Questions:    make(map[string]Question, len(survey.Questions)),
+		Status:       SurveyDraft,
+		OpensAt:      survey.OpensAt,
+		ClosesAt:     survey.ClosesAt,
+		MaxResponses: survey.MaxResponses,
+	}
+
+	for id, question := range survey.Questions {
+		copied := Question{
+			ID:      ids[id],
+			Text:    question.Text,
+			Type:    question.Type,
+			Options: append([]string(nil), question.Options...),
+		}
+
+		if question.Next != nil {
+			copied.Next = make(map[string]string, len(question.Next))
+			for answer, next := range question.Next {
+				copied.Next[answer] = target(next)
+			}
+		}
+
+		for i, cond := range question.Conditionals {
+			expression, err := renameExpressionIdentifiers(cond.Expression, ids)
+			if err != nil {
+				return nil, fault.NewClientError("cannot clone survey", fmt.Errorf("question %q conditional #%d has an invalid expression: %w", id, i+1, err))
+			}
+
+			copied.Conditionals = append(copied.Conditionals, ConditionalNext{Expression: expression, NextID: target(cond.NextID)})
+		}
+
+		if question.Library != nil {
+			link := *question.Library
+			copied.Library = &link
+		}
+
+		clone.Questions[copied.ID] = copied
+	}
+
+	if survey.Endings != nil {
+		clone.Endings = make(map[string]Ending, len(survey.Endings))
+		for id, ending := range survey.Endings {
+			ending.ID = ids[id]
+			clone.Endings[ending.ID] = ending
+		}
+	}
+
+	for locale, translation := range survey.Translations {
+		copied := Translation{Title: translation.Title}
+
+		if translation.Questions != nil {
+			copied.Questions = make(map[string]QuestionTranslation, len(translation.Questions))
+			for id, qt := range translation.Questions {
+				qt.Options = append([]string(nil), qt.Options...)
+				copied.Questions[target(id)] = qt
+			}
+		}
+
+		if translation.Endings != nil {
+			copied.Endings = make(map[string]EndingTranslation, len(translation.Endings))
+			for id, et := range translation.Endings {
+				copied.Endings[target(id)] = et
+			}
+		}
+
+		if clone.Translations == nil {
+			clone.Translations = make(map[string]Translation, len(survey.Translations))
+		}
+		clone.Translations[locale] = copied
+	}
+
+	if err := clone.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &clone, nil
+}
+
+func sortedEndingIDs(endings map[string]Ending) []string {
+	ids := make([]string, 0, len(endings))
+	for id := range endings {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Renames the variables of the expression, function names are left untouched.
+func renameExpressionIdentifiers(expression string, ids map[string]string) (string, error) {
+	tree, err := parser.Parse(expression)
+	if err != nil {
+		return "", err
+	}
+
+	callees := &calleeCollector{callees: make(map[*ast.IdentifierNode]bool)}
+	ast.Walk(&tree.Node, callees)
+
+	renamer := &identifierRenamer{ids: ids, callees: callees.callees}
+	ast.Walk(&tree.Node, renamer)
+
+	if !renamer.renamed {
+		return expression, nil
+	}
+
+	return tree.Node.String(), nil
+}
+
+type calleeCollector struct {
+	callees map[*ast.IdentifierNode]bool
+}
+
+func (c *calleeCollector) Visit(node *ast.Node) {
+	if call, ok := (*node).(*ast.CallNode); ok {
+		if ident, ok := call.Callee.(*ast.IdentifierNode); ok {
+			c.callees[ident] = true
+		}
+	}
+}
+
+type identifierRenamer struct {
+	ids     map[string]string
+	callees map[*ast.IdentifierNode]bool
+	renamed bool
+}
+
+func (r *identifierRenamer) Visit(node *ast.Node) {
+	ident, ok := (*node).(*ast.IdentifierNode)
+	if !ok || r.callees[ident] {
+		return
+	}
+
+	if id, ok := r.ids[ident.Value]; ok && id != ident.Value {
+		ident.Value = id
+		r.renamed = true
+	}
+}
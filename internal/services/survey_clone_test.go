@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+func TestCloneSurvey(t *testing.T) {
+	survey := definitionSurvey()
+	survey.Questions["q2"] = Question{
+		ID:   "q2",
+		Text: "What is your occupation?",
+		Type: Text,
+		Conditionals: []ConditionalNext{
+			{Expression: `len(q2) > 0 && q1 == "yes"`, NextID: "underage"},
+		},
+	}
+
+	clone, err := CloneSurvey(survey, func(oldID string) string { return "copy_" + oldID })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if clone.ID != "" || clone.StartID != "copy_q1" || clone.Status != SurveyDraft {
+		t.Errorf("unexpected clone %+v", clone)
+	}
+
+	q1 := clone.Questions["copy_q1"]
+	if q1.Conditionals[0].Expression != `copy_q1 == "yes"` || q1.Conditionals[0].NextID != "copy_q2" {
+		t.Errorf("expected the conditional to follow the new ids, got %+v", q1.Conditionals[0])
+	}
+	if q1.Conditionals[1].NextID != "copy_underage" {
+		t.Errorf("expected the ending to follow the new ids, got %+v", q1.Conditionals[1])
+	}
+
+	q2 := clone.Questions["copy_q2"]
+	if q2.Conditionals[0].Expression != `len(copy_q2) > 0 && copy_q1 == "yes"` {
+		t.Errorf("expected the function name to be kept, got %q", q2.Conditionals[0].Expression)
+	}
+
+	if _, ok := clone.Translations["fr"].Questions["copy_q1"]; !ok {
+		t.Errorf("expected the translations to follow the new ids, got %+v", clone.Translations["fr"])
+	}
+
+	// the original survey is left untouched
+	q1.Options[0] = "changed"
+	if survey.Questions["q1"].Options[0] != "yes" || survey.Questions["q1"].Conditionals[0].Expression != `q1 == "yes"` {
+		t.Errorf("expected a deep copy, the original changed to %+v", survey.Questions["q1"])
+	}
+}
+
+func TestCloneSurvey_SequentialIDs(t *testing.T) {
+	clone, err := CloneSurvey(definitionSurvey(), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := clone.Questions["q2"]; !ok || clone.StartID != "q1" {
+		t.Errorf("expected the questions numbered in flow order, got %+v", clone.Questions)
+	}
+	if _, ok := clone.Endings["end1"]; !ok {
+		t.Errorf("expected the endings numbered, got %+v", clone.Endings)
+	}
+}
+
+func TestCloneSurvey_DuplicateIDs(t *testing.T) {
+	_, err := CloneSurvey(definitionSurvey(), func(string) string { return "same" })
+	if !fault.IsClientError(err) {
+		t.Errorf("expected a client error when the same id is issued twice, got %v", err)
+	}
+}
@@ -0,0 +1,379 @@
+package services
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"gopkg.in/yaml.v3"
+)
+
+// NOTE: the survey definition is the portable file format of a survey.
+//
+// It is meant to be kept in git, reviewed in PRs and moved between environments.
+// A definition looks like the following in YAML, the JSON form uses the same keys:
+//
+//	version: 1
+//	id: s1
+//	title: Age Check
+//	locale: en
+//	start_id: q1
+//	questions:
+//	  - id: q1
+//	    text: Are you over 18?
+//	    type: multiple_choice
+//	    options: ["yes", "no"]
+//	    conditionals:
+//	      - expression: q1 == "yes"
+//	        next_id: q2
+//	      - expression: q1 == "no"
+//	        next_id: underage
+//	  - id: q2
+//	    text: What is your occupation?
+//	    type: text
+//	endings:
+//	  - id: underage
+//	    title: Thank you
+//	    message: This survey is for adults only.
+//	translations:
+//	  fr:
+//	    title: Vérification de l'âge
+//	    questions:
+//	      q1:
+//	        text: Avez-vous plus de 18 ans ?
+//	        options: ["oui", "non"]
+//
+// Questions are written in the order a respondent meets them so diffs stay stable.
+// Unknown fields are rejected, see `SurveyDefinitionSchema` for editor validation.
+
+// The current version of the survey definition format.
+const SurveyDefinitionVersion = 1
+
+// The encoding of the survey definition.
+type DefinitionFormat int
+
+const (
+	FormatJSON DefinitionFormat = iota + 1
+	FormatYAML
+)
+
+//go:embed survey_definition.schema.json
+var surveyDefinitionSchema []byte
+
+// The JSON Schema of the survey definition, usable by editors for validation.
+func SurveyDefinitionSchema() []byte {
+	return surveyDefinitionSchema
+}
+
+// The file representation of a `Survey`.
+type SurveyDefinition struct {
+	Version      int                              `json:"version" yaml:"version"`
+	ID           string                           `json:"id" yaml:"id"`
+	Title        string                           `json:"title" yaml:"title"`
+	Locale       string                           `json:"locale,omitempty" yaml:"locale,omitempty"`
+	StartID      string                           `json:"start_id" yaml:"start_id"`
+	Questions    []QuestionDefinition             `json:"questions" yaml:"questions"`
+	Endings      []EndingDefinition               `json:"endings,omitempty" yaml:"endings,omitempty"`
+	Translations map[string]TranslationDefinition `json:"translations,omitempty" yaml:"translations,omitempty"`
+}
+
+// The file representation of a `Question`.
+type QuestionDefinition struct {
+	ID           string                  `json:"id" yaml:"id"`
+	Text         string                  `json:"text" yaml:"text"`
+	Type         string                  `json:"type" yaml:"type"`
+	Options      []string                `json:"options,omitempty" yaml:"options,omitempty"`
+	Next         map[string]string       `json:"next,omitempty" yaml:"next,omitempty"`
+	Conditionals []ConditionalDefinition `json:"conditionals,omitempty" yaml:"conditionals,omitempty"`
+	Library      *LibraryLinkDefinition  `json:"library,omitempty" yaml:"library,omitempty"`
+}
+
+// The file representation of a `LibraryLink`.
+type LibraryLinkDefinition struct {
+	QuestionID string `json:"question_id" yaml:"question_id"`
+	Version    int    `json:"version" yaml:"version"`
+	Linked     bool   `json:"linked,omitempty" yaml:"linked,omitempty"`
+}
+
+// The file representation of a `ConditionalNext`.
+type ConditionalDefinition struct {
+	Expression string `json:"expression" yaml:"expression"`
+	NextID     string `json:"next_id" yaml:"next_id"`
+}
+
+// The file representation of an `Ending`.
+type EndingDefinition struct {
+	ID      string `json:"id" yaml:"id"`
+	Title   string `json:"title" yaml:"title"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// The file representation of a `Translation`.
+type TranslationDefinition struct {
+	Title     string                                   `json:"title,omitempty" yaml:"title,omitempty"`
+	Questions map[string]QuestionTranslationDefinition `json:"questions,omitempty" yaml:"questions,omitempty"`
+	Endings   map[string]EndingTranslationDefinition   `json:"endings,omitempty" yaml:"endings,omitempty"`
+}
+
+// The file representation of a `QuestionTranslation`.
+type QuestionTranslationDefinition struct {
+	Text    string   `json:"text,omitempty" yaml:"text,omitempty"`
+	Options []string `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// The file representation of an `EndingTranslation`.
+type EndingTranslationDefinition struct {
+	Title   string `json:"title,omitempty" yaml:"title,omitempty"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// Encodes the survey into its definition file.
+func MarshalSurvey(survey Survey, format DefinitionFormat) ([]byte, error) {
+	def := NewSurveyDefinition(survey)
+
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(def, "", "  ")
+	case FormatYAML:
+		var buf bytes.Buffer
+
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(def); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown definition format %d", format)
+	}
+}
+
+// Decodes and validates a survey definition file.
+//
+// Unknown fields, unsupported versions and invalid surveys are client errors.
+func UnmarshalSurvey(data []byte, format DefinitionFormat) (*Survey, error) {
+	var def SurveyDefinition
+
+	switch format {
+	case FormatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(&def); err != nil {
+			return nil, fault.NewClientError("invalid survey definition", err)
+		}
+		if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+			return nil, fault.NewClientError("invalid survey definition", errors.New("unexpected data after the definition"))
+		}
+	case FormatYAML:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+
+		if err := dec.Decode(&def); err != nil {
+			return nil, fault.NewClientError("invalid survey definition", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown definition format %d", format)
+	}
+
+	survey, err := def.ToSurvey()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := survey.Validate(); err != nil {
+		return nil, err
+	}
+
+	return survey, nil
+}
+
+// Builds the definition of the survey, questions are written in flow order.
+func NewSurveyDefinition(survey Survey) SurveyDefinition {
+	def := SurveyDefinition{
+		Version: SurveyDefinitionVersion,
+		ID:      survey.ID,
+		Title:   survey.Title,
+		Locale:  survey.Locale,
+		StartID: survey.StartID,
+	}
+
+	for _, id := range survey.OrderedQuestionIDs() {
+		question := survey.Questions[id]
+
+		qdef := QuestionDefinition{
+			ID:      question.ID,
+			Text:    question.Text,
+			Type:    question.Type.String(),
+			Options: question.Options,
+			Next:    question.Next,
+		}
+
+		for _, cond := range question.Conditionals {
+			qdef.Conditionals = append(qdef.Conditionals, ConditionalDefinition{
+				Expression: cond.Expression,
+				NextID:     cond.NextID,
+			})
+		}
+
+		if question.Library != nil {
+			qdef.Library = &LibraryLinkDefinition{
+				QuestionID: question.Library.QuestionID,
+				Version:    question.Library.Version,
+				Linked:     question.Library.Linked,
+			}
+		}
+
+		def.Questions = append(def.Questions, qdef)
+	}
+
+	endingIDs := make([]string, 0, len(survey.Endings))
+	for id := range survey.Endings {
+		endingIDs = append(endingIDs, id)
+	}
+	sort.Strings(endingIDs)
+
+	for _, id := range endingIDs {
+		ending := survey.Endings[id]
+		def.Endings = append(def.Endings, EndingDefinition{
+			ID:      ending.ID,
+			Title:   ending.Title,
+			Message: ending.Message,
+		})
+	}
+
+	for locale, translation := range survey.Translations {
+		if def.Translations == nil {
+			def.Translations = make(map[string]TranslationDefinition, len(survey.Translations))
+		}
+
+		tdef := TranslationDefinition{Title: translation.Title}
+
+		for id, qt := range translation.Questions {
+			if tdef.Questions == nil {
+				tdef.Questions = make(map[string]QuestionTranslationDefinition, len(translation.Questions))
+			}
+			tdef.Questions[id] = QuestionTranslationDefinition{Text: qt.Text, Options: qt.Options}
+		}
+
+		for id, et := range translation.Endings {
+			if tdef.Endings == nil {
+				tdef.Endings = make(map[string]EndingTranslationDefinition, len(translation.Endings))
+			}
+			tdef.Endings[id] = EndingTranslationDefinition{Title: et.Title, Message: et.Message}
+		}
+
+		def.Translations[locale] = tdef
+	}
+
+	return def
+}
+
+// Converts the definition back into the survey.
+func (def SurveyDefinition) ToSurvey() (*Survey, error) {
+	if def.Version != SurveyDefinitionVersion {
+		return nil, fault.NewClientError("invalid survey definition", fmt.Errorf("unsupported version %d, expected %d", def.Version, SurveyDefinitionVersion))
+	}
+
+	survey := &Survey{
+		ID:        def.ID,
+		Title:     def.Title,
+		Locale:    def.Locale,
+		StartID:   def.StartID,
+		Questions: make(map[string]Question, len(def.Questions)),
+	}
+
+	for _, qdef := range def.Questions {
+		if _, ok := survey.Questions[qdef.ID]; ok {
+			return nil, fault.NewClientError("invalid survey definition", fmt.Errorf("duplicate question %q", qdef.ID))
+		}
+
+		questionType, err := ParseQuestionType(qdef.Type)
+		if err != nil {
+			return nil, fault.NewClientError("invalid survey definition", fmt.Errorf("question %q: %w", qdef.ID, err))
+		}
+
+		question := Question{
+			ID:      qdef.ID,
+			Text:    qdef.Text,
+			Type:    questionType,
+			Options: qdef.Options,
+			Next:    qdef.Next,
+		}
+
+		for _, cdef := range qdef.Conditionals {
+			question.Conditionals = append(question.Conditionals, ConditionalNext{
+				Expression: cdef.Expression,
+				NextID:     cdef.NextID,
+			})
+		}
+
+		if qdef.Library != nil {
+			question.Library = &LibraryLink{
+				QuestionID: qdef.Library.QuestionID,
+				Version:    qdef.Library.Version,
+				Linked:     qdef.Library.Linked,
+			}
+		}
+
+		survey.Questions[question.ID] = question
+	}
+
+	for _, edef := range def.Endings {
+		if survey.Endings == nil {
+			survey.Endings = make(map[string]Ending, len(def.Endings))
+		}
+		if _, ok := survey.Endings[edef.ID]; ok {
+			return nil, fault.NewClientError("invalid survey definition", fmt.Errorf("duplicate ending %q", edef.ID))
+		}
+
+		survey.Endings[edef.ID] = Ending{ID: edef.ID, Title: edef.Title, Message: edef.Message}
+	}
+
+	for locale, tdef := range def.Translations {
+		if survey.Translations == nil {
+			survey.Translations = make(map[string]Translation, len(def.Translations))
+		}
+
+		translation := Translation{Title: tdef.Title}
+
+		for id, qt := range tdef.Questions {
+			question, ok := survey.Questions[id]
+			if !ok {
+				return nil, fault.NewClientError("invalid survey definition", fmt.Errorf("translation %q references an unknown question %q", locale, id))
+			}
+			if len(qt.Options) > 0 && len(qt.Options) != len(question.Options) {
+				return nil, fault.NewClientError("invalid survey definition", fmt.Errorf("translation %q of question %q has %d options, expected %d", locale, id, len(qt.Options), len(question.Options)))
+			}
+
+			if translation.Questions == nil {
+				translation.Questions = make(map[string]QuestionTranslation, len(tdef.Questions))
+			}
+			translation.Questions[id] = QuestionTranslation{Text: qt.Text, Options: qt.Options}
+		}
+
+		for id, et := range tdef.Endings {
+			if _, ok := survey.Endings[id]; !ok {
+				return nil, fault.NewClientError("invalid survey definition", fmt.Errorf("translation %q references an unknown ending %q", locale, id))
+			}
+
+			if translation.Endings == nil {
+				translation.Endings = make(map[string]EndingTranslation, len(tdef.Endings))
+			}
+			translation.Endings[id] = EndingTranslation{Title: et.Title, Message: et.Message}
+		}
+
+		survey.Translations[locale] = translation
+	}
+
+	return survey, nil
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+func definitionSurvey() Survey {
+	return Survey{
+		ID:      "s1",
+		Title:   "Age Check",
+		Locale:  "en",
+		StartID: "q1",
+		Questions: map[string]Question{
+			"q1": {
+				ID:      "q1",
+				Text:    "Are you over 18?",
+				Type:    MultipleChoice,
+				Options: []string{"yes", "no"},
+				Conditionals: []ConditionalNext{
+					{Expression: `q1 == "yes"`, NextID: "q2"},
+					{Expression: `q1 == "no"`, NextID: "underage"},
+				},
+			},
+			"q2": {ID: "q2", Text: "What is your occupation?", Type: Text},
+		},
+		Endings: map[string]Ending{
+			"underage": {ID: "underage", Title: "Thank you", Message: "This survey is for adults only."},
+		},
+		Translations: map[string]Translation{
+			"fr": {
+				Title: "Vérification de l'âge",
+				Questions: map[string]QuestionTranslation{
+					"q1": {Text: "Avez-vous plus de 18 ans ?", Options: []string{"oui", "non"}},
+				},
+				Endings: map[string]EndingTranslation{
+					"underage": {Title: "Merci"},
+				},
+			},
+		},
+	}
+}
+
+func TestSurveyDefinition_RoundTrip(t *testing.T) {
+	for _, format := range []DefinitionFormat{FormatJSON, FormatYAML} {
+		survey := definitionSurvey()
+
+		data, err := MarshalSurvey(survey, format)
+		if err != nil {
+			t.Fatalf("format %d: unexpected marshal error: %v", format, err)
+		}
+
+		got, err := UnmarshalSurvey(data, format)
+		if err != nil {
+			t.Fatalf("format %d: unexpected unmarshal error: %v\n%s", format, err, data)
+		}
+
+		if !reflect.DeepEqual(*got, survey) {
+			t.Errorf("format %d: round trip mismatch\nwant %+v\ngot  %+v", format, survey, *got)
+		}
+	}
+}
+
+func TestUnmarshalSurvey_UnknownField(t *testing.T) {
+	yamlData := `
+version: 1
+id: s1
+title: Age Check
+start_id: q1
+questions:
+  - id: q1
+    text: Are you over 18?
+    type: text
+    colour: red
+`
+	_, err := UnmarshalSurvey([]byte(yamlData), FormatYAML)
+	if err == nil || !fault.IsClientError(err) || !strings.Contains(err.Error(), "colour") {
+		t.Errorf("expected a client error about the unknown field, got %v", err)
+	}
+
+	jsonData := `{"version": 1, "id": "s1", "title": "t", "start_id": "q1", "owner": "me",
+		"questions": [{"id": "q1", "text": "Name?", "type": "text"}]}`
+	_, err = UnmarshalSurvey([]byte(jsonData), FormatJSON)
+	if err == nil || !fault.IsClientError(err) || !strings.Contains(err.Error(), "owner") {
+		t.Errorf("expected a client error about the unknown field, got %v", err)
+	}
+}
+
+func TestUnmarshalSurvey_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		contains string
+	}{
+		{
+			name:     "Unsupported version",
+			data:     `{"version": 2, "id": "s1", "title": "t", "start_id": "q1", "questions": [{"id": "q1", "text": "Name?", "type": "text"}]}`,
+			contains: "unsupported version",
+		},
+		{
+			name:     "Unknown type",
+			data:     `{"version": 1, "id": "s1", "title": "t", "start_id": "q1", "questions": [{"id": "q1", "text": "Name?", "type": "essay"}]}`,
+			contains: "unknown question type",
+		},
+		{
+			name: "Unknown next question",
+			data: `{"version": 1, "id": "s1", "title": "t", "start_id": "q1", "questions": [
+				{"id": "q1", "text": "Name?", "type": "text", "conditionals": [{"expression": "q1 != \"\"", "next_id": "q9"}]}]}`,
+			contains: `unknown question "q9"`,
+		},
+		{
+			name: "Unknown question in expression",
+			data: `{"version": 1, "id": "s1", "title": "t", "start_id": "q1", "questions": [
+				{"id": "q1", "text": "Name?", "type": "text", "conditionals": [{"expression": "q7 == 1", "next_id": "q1"}]}]}`,
+			contains: `unknown question "q7"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := UnmarshalSurvey([]byte(tt.data), FormatJSON)
+			if err == nil || !fault.IsClientError(err) || !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("expected a client error containing %q, got %v", tt.contains, err)
+			}
+		})
+	}
+}
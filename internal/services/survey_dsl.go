@@ -0,0 +1,512 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr/file"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+// NOTE: the survey DSL is a compact plain-text way of authoring a survey.
+//
+//	# Age Check
+//	@id s1
+//	@locale en
+//
+//	// comments start with two slashes
+//	q1: Are you over 18?
+//	  - yes
+//	  - no -> underage
+//	  -> q2 if q1 == "yes"
+//
+//	q2 [text]: What is your occupation?
+//
+//	end underage: Thank you
+//	  This survey is for adults only.
+//
+// A question line is `<id> [<type>]: <text>`, the type defaults to
+// multiple_choice when the question has options and text otherwise.
+// Indented `- option` lines are the options, an option may route with `-> <id>`,
+// compiled into a `<question> == "<option>"` conditional ahead of the routing lines.
+// Indented `-> <id> if <expression>` lines are the conditionals, evaluated in order,
+// a routing line without `if` always matches.
+// The start question is the first question unless set with `@start <id>`.
+// Translations are not part of the DSL.
+
+// The compile error of the survey DSL, the line and column are 1-based.
+type DSLError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *DSLError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+var dslIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Matches `<id> [<type>]: <text>` and `end <id>: <title>`.
+var (
+	dslQuestionLine = regexp.MustCompile(`^([^\s:\[]+)\s*(?:\[\s*([^\]]*?)\s*\])?\s*:\s*(.*)$`)
+	dslEndingLine   = regexp.MustCompile(`^end\s+([^\s:]+)\s*:\s*(.*)$`)
+)
+
+// The expression of a routing line without `if`.
+const dslAlways = "true"
+
+type dslRoute struct {
+	target     string
+	targetCol  int
+	expression string
+	exprCol    int
+	line       int
+}
+
+type dslQuestion struct {
+	question  Question
+	typed     bool
+	line      int
+	routes    []dslRoute
+	optRoutes []dslRoute
+}
+
+type dslCompiler struct {
+	survey    *Survey
+	questions []*dslQuestion
+	endings   map[string]int // ending id to line
+	start     string
+	startLine int
+
+	question *dslQuestion
+	ending   *Ending
+}
+
+// Compiles the survey DSL source into a validated survey.
+//
+// Errors are client errors wrapping a `*DSLError` with the line and column.
+func CompileSurveyDSL(src string) (*Survey, error) {
+	c := &dslCompiler{
+		survey:  &Survey{Questions: make(map[string]Question)},
+		endings: make(map[string]int),
+	}
+
+	if err := c.parse(src); err != nil {
+		return nil, fault.NewClientError("invalid survey dsl", err)
+	}
+
+	if err := c.link(); err != nil {
+		return nil, fault.NewClientError("invalid survey dsl", err)
+	}
+
+	if err := c.survey.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.survey, nil
+}
+
+func (c *dslCompiler) parse(src string) error {
+	for i, raw := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		lineNo := i + 1
+
+		trimmed := strings.TrimLeft(raw, " \t")
+		indent := len(raw) - len(trimmed)
+		trimmed = strings.TrimRight(trimmed, " \t")
+		col := indent + 1
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "//") {
+			continue
+		}
+
+		if indent > 0 {
+			if err := c.parseIndented(trimmed, lineNo, col); err != nil {
+				return err
+			}
+			continue
+		}
+
+		c.closeBlock()
+
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			if c.survey.Title != "" {
+				return &DSLError{Line: lineNo, Column: col, Message: "the title is already set"}
+			}
+			c.survey.Title = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+		case strings.HasPrefix(trimmed, "@"):
+			if err := c.parseDirective(trimmed, lineNo); err != nil {
+				return err
+			}
+		case dslEndingLine.MatchString(trimmed):
+			m := dslEndingLine.FindStringSubmatchIndex(trimmed)
+			id := trimmed[m[2]:m[3]]
+
+			if !dslIdentifier.MatchString(id) {
+				return &DSLError{Line: lineNo, Column: m[2] + 1, Message: fmt.Sprintf("invalid ending id %q", id)}
+			}
+			if _, ok := c.endings[id]; ok {
+				return &DSLError{Line: lineNo, Column: m[2] + 1, Message: fmt.Sprintf("duplicate ending %q", id)}
+			}
+
+			c.endings[id] = lineNo
+			c.ending = &Ending{ID: id, Title: trimmed[m[4]:m[5]]}
+		default:
+			m := dslQuestionLine.FindStringSubmatchIndex(trimmed)
+			if m == nil {
+				return &DSLError{Line: lineNo, Column: col, Message: "expected a question line `<id>: <text>`"}
+			}
+
+			id := trimmed[m[2]:m[3]]
+			if !dslIdentifier.MatchString(id) {
+				return &DSLError{Line: lineNo, Column: m[2] + 1, Message: fmt.Sprintf("invalid question id %q", id)}
+			}
+			for _, q := range c.questions {
+				if q.question.ID == id {
+					return &DSLError{Line: lineNo, Column: m[2] + 1, Message: fmt.Sprintf("duplicate question %q, first declared on line %d", id, q.line)}
+				}
+			}
+
+			q := &dslQuestion{question: Question{ID: id, Text: trimmed[m[6]:m[7]]}, line: lineNo}
+
+			if m[4] >= 0 {
+				questionType, err := ParseQuestionType(trimmed[m[4]:m[5]])
+				if err != nil {
+					return &DSLError{Line: lineNo, Column: m[4] + 1, Message: err.Error()}
+				}
+				q.question.Type = questionType
+				q.typed = true
+			}
+
+			c.questions = append(c.questions, q)
+			c.question = q
+		}
+	}
+
+	c.closeBlock()
+
+	return nil
+}
+
+func (c *dslCompiler) parseDirective(line string, lineNo int) error {
+	name, value, _ := strings.Cut(line[1:], " ")
+	value = strings.TrimSpace(value)
+
+	if value == "" {
+		return &DSLError{Line: lineNo, Column: 1, Message: fmt.Sprintf("missing value of @%s", name)}
+	}
+
+	switch name {
+	case "id":
+		c.survey.ID = value
+	case "locale":
+		c.survey.Locale = value
+	case "start":
+		c.start = value
+		c.startLine = lineNo
+	default:
+		return &DSLError{Line: lineNo, Column: 1, Message: fmt.Sprintf("unknown directive @%s", name)}
+	}
+
+	return nil
+}
+
+func (c *dslCompiler) parseIndented(line string, lineNo, col int) error {
+	if c.ending != nil {
+		if c.ending.Message != "" {
+			c.ending.Message += "\n"
+		}
+		c.ending.Message += line
+		return nil
+	}
+
+	if c.question == nil {
+		return &DSLError{Line: lineNo, Column: col, Message: "indented line outside of a question or ending"}
+	}
+
+	switch {
+	case strings.HasPrefix(line, "->"):
+		route, err := parseDSLRoute(line[2:], lineNo, col+2, true)
+		if err != nil {
+			return err
+		}
+		c.question.routes = append(c.question.routes, route)
+	case strings.HasPrefix(line, "- ") || line == "-":
+		option := strings.TrimSpace(line[1:])
+		optionCol := col + 1 + (len(line[1:]) - len(strings.TrimLeft(line[1:], " \t")))
+
+		if idx := strings.Index(option, "->"); idx >= 0 {
+			route, err := parseDSLRoute(option[idx+2:], lineNo, optionCol+idx+2, false)
+			if err != nil {
+				return err
+			}
+
+			option = strings.TrimSpace(option[:idx])
+			route.expression = option
+			c.question.optRoutes = append(c.question.optRoutes, route)
+		}
+
+		if option == "" {
+			return &DSLError{Line: lineNo, Column: optionCol, Message: "empty option"}
+		}
+
+		c.question.question.Options = append(c.question.question.Options, option)
+	default:
+		return &DSLError{Line: lineNo, Column: col, Message: "expected an option `- <option>` or a routing line `-> <id> if <expression>`"}
+	}
+
+	return nil
+}
+
+// Parses `<target> [if <expression>]`, col is the column where `rest` starts.
+func parseDSLRoute(rest string, lineNo, col int, allowIf bool) (dslRoute, error) {
+	trimmed := strings.TrimLeft(rest, " \t")
+	col += len(rest) - len(trimmed)
+
+	target, condition, hasIf := strings.Cut(trimmed, " if ")
+	target = strings.TrimSpace(target)
+
+	if target == "" {
+		return dslRoute{}, &DSLError{Line: lineNo, Column: col, Message: "missing the next question id"}
+	}
+	if !dslIdentifier.MatchString(target) {
+		return dslRoute{}, &DSLError{Line: lineNo, Column: col, Message: fmt.Sprintf("invalid next question id %q", target)}
+	}
+
+	route := dslRoute{target: target, targetCol: col, expression: dslAlways, line: lineNo}
+
+	if hasIf {
+		if !allowIf {
+			return dslRoute{}, &DSLError{Line: lineNo, Column: col + len(target) + 1, Message: "option routing cannot have a condition"}
+		}
+
+		exprCol := col + strings.Index(trimmed, " if ") + len(" if ")
+		expression := strings.TrimLeft(condition, " \t")
+		exprCol += len(condition) - len(expression)
+
+		if expression == "" {
+			return dslRoute{}, &DSLError{Line: lineNo, Column: exprCol, Message: "missing the condition after `if`"}
+		}
+
+		route.expression = expression
+		route.exprCol = exprCol
+	}
+
+	return route, nil
+}
+
+func (c *dslCompiler) closeBlock() {
+	if c.ending != nil {
+		if c.survey.Endings == nil {
+			c.survey.Endings = make(map[string]Ending)
+		}
+		c.survey.Endings[c.ending.ID] = *c.ending
+	}
+
+	c.ending = nil
+	c.question = nil
+}
+
+// Resolves the references once every question and ending is known.
+func (c *dslCompiler) link() error {
+	if len(c.questions) == 0 {
+		return &DSLError{Line: 1, Column: 1, Message: "survey has no questions"}
+	}
+
+	for _, q := range c.questions {
+		if _, ok := c.endings[q.question.ID]; ok {
+			return &DSLError{Line: q.line, Column: 1, Message: fmt.Sprintf("question %q has the same id as an ending", q.question.ID)}
+		}
+	}
+
+	for _, q := range c.questions {
+		if !q.typed {
+			q.question.Type = Text
+			if len(q.question.Options) > 0 {
+				q.question.Type = MultipleChoice
+			}
+		}
+
+		for _, route := range q.optRoutes {
+			if err := c.checkTarget(route); err != nil {
+				return err
+			}
+			q.question.Conditionals = append(q.question.Conditionals, ConditionalNext{
+				Expression: optionExpression(q.question.ID, route.expression),
+				NextID:     route.target,
+			})
+		}
+
+		for _, route := range q.routes {
+			if err := c.checkTarget(route); err != nil {
+				return err
+			}
+			if err := c.checkExpression(route); err != nil {
+				return err
+			}
+			q.question.Conditionals = append(q.question.Conditionals, ConditionalNext{
+				Expression: route.expression,
+				NextID:     route.target,
+			})
+		}
+
+		c.survey.Questions[q.question.ID] = q.question
+	}
+
+	c.survey.StartID = c.questions[0].question.ID
+	if c.start != "" {
+		if _, ok := c.survey.Questions[c.start]; !ok {
+			return &DSLError{Line: c.startLine, Column: len("@start ") + 1, Message: fmt.Sprintf("unknown start question %q", c.start)}
+		}
+		c.survey.StartID = c.start
+	}
+
+	return nil
+}
+
+func (c *dslCompiler) checkTarget(route dslRoute) error {
+	if _, ok := c.endings[route.target]; ok {
+		return nil
+	}
+
+	for _, q := range c.questions {
+		if q.question.ID == route.target {
+			return nil
+		}
+	}
+
+	return &DSLError{Line: route.line, Column: route.targetCol, Message: fmt.Sprintf("unknown question %q", route.target)}
+}
+
+func (c *dslCompiler) checkExpression(route dslRoute) error {
+	if route.exprCol == 0 {
+		return nil
+	}
+
+	collector, err := collectIdentifiers(route.expression)
+	if err != nil {
+		var ferr *file.Error
+		if errors.As(err, &ferr) {
+			return &DSLError{Line: route.line, Column: route.exprCol + ferr.Column, Message: ferr.Message}
+		}
+		return &DSLError{Line: route.line, Column: route.exprCol, Message: err.Error()}
+	}
+
+	for _, ident := range collector.variables() {
+		known := false
+		for _, q := range c.questions {
+			if q.question.ID == ident {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return &DSLError{Line: route.line, Column: route.exprCol + collector.offsets[ident], Message: fmt.Sprintf("unknown question %q in expression", ident)}
+		}
+	}
+
+	return nil
+}
+
+// Writes the survey back into the DSL.
+//
+// Translations and `Next` entries are not part of the DSL and are left out.
+func DecompileSurveyDSL(survey Survey) string {
+	var b strings.Builder
+
+	if survey.Title != "" {
+		fmt.Fprintf(&b, "# %s\n", survey.Title)
+	}
+	if survey.ID != "" {
+		fmt.Fprintf(&b, "@id %s\n", survey.ID)
+	}
+	if survey.Locale != "" {
+		fmt.Fprintf(&b, "@locale %s\n", survey.Locale)
+	}
+
+	for _, id := range survey.OrderedQuestionIDs() {
+		question := survey.Questions[id]
+
+		b.WriteString("\n")
+
+		inferred := Text
+		if len(question.Options) > 0 {
+			inferred = MultipleChoice
+		}
+
+		if question.Type != inferred {
+			fmt.Fprintf(&b, "%s [%s]: %s\n", question.ID, question.Type, question.Text)
+		} else {
+			fmt.Fprintf(&b, "%s: %s\n", question.ID, question.Text)
+		}
+
+		// the leading option conditionals in the option order are written back as
+		// option routes, compiled back in the same order
+		routes := make(map[string]string)
+		conditionals := question.Conditionals
+		for last := -1; len(conditionals) > 0; conditionals = conditionals[1:] {
+			i := routedOption(question, conditionals[0].Expression)
+			if i <= last {
+				break
+			}
+			routes[question.Options[i]] = conditionals[0].NextID
+			last = i
+		}
+
+		for _, option := range question.Options {
+			if next, ok := routes[option]; ok {
+				fmt.Fprintf(&b, "  - %s -> %s\n", option, next)
+			} else {
+				fmt.Fprintf(&b, "  - %s\n", option)
+			}
+		}
+
+		for _, cond := range conditionals {
+			if strings.TrimSpace(cond.Expression) == dslAlways {
+				fmt.Fprintf(&b, "  -> %s\n", cond.NextID)
+			} else {
+				fmt.Fprintf(&b, "  -> %s if %s\n", cond.NextID, cond.Expression)
+			}
+		}
+	}
+
+	endingIDs := make([]string, 0, len(survey.Endings))
+	for id := range survey.Endings {
+		endingIDs = append(endingIDs, id)
+	}
+	sort.Strings(endingIDs)
+
+	for _, id := range endingIDs {
+		ending := survey.Endings[id]
+
+		fmt.Fprintf(&b, "\nend %s: %s\n", ending.ID, ending.Title)
+		if ending.Message != "" {
+			for _, line := range strings.Split(ending.Message, "\n") {
+				fmt.Fprintf(&b, "  %s\n", line)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// The conditional of the option route.
+func optionExpression(questionID, option string) string {
+	return fmt.Sprintf("%s == %q", questionID, option)
+}
+
+// The index of the option the expression is the route of, -1 when none.
+func routedOption(question Question, expression string) int {
+	for i, option := range question.Options {
+		if expression == optionExpression(question.ID, option) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const ageCheckDSL = `# Age Check
+@id s1
+@locale en
+
+// asked to everyone
+q1: Are you over 18?
+  - yes
+  - no -> underage
+  -> q2 if q1 == "yes"
+
+q2 [text]: What is your occupation?
+  -> thanks
+
+end underage: Thank you
+  This survey is for adults only.
+
+end thanks: Thank you
+`
+
+func TestCompileSurveyDSL(t *testing.T) {
+	survey, err := CompileSurveyDSL(ageCheckDSL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := &Survey{
+		ID:      "s1",
+		Title:   "Age Check",
+		Locale:  "en",
+		StartID: "q1",
+		Questions: map[string]Question{
+			"q1": {
+				ID:      "q1",
+				Text:    "Are you over 18?",
+				Type:    MultipleChoice,
+				Options: []string{"yes", "no"},
+				Conditionals: []ConditionalNext{
+					{Expression: `q1 == "no"`, NextID: "underage"},
+					{Expression: `q1 == "yes"`, NextID: "q2"},
+				},
+			},
+			"q2": {
+				ID:           "q2",
+				Text:         "What is your occupation?",
+				Type:         Text,
+				Conditionals: []ConditionalNext{{Expression: "true", NextID: "thanks"}},
+			},
+		},
+		Endings: map[string]Ending{
+			"underage": {ID: "underage", Title: "Thank you", Message: "This survey is for adults only."},
+			"thanks":   {ID: "thanks", Title: "Thank you"},
+		},
+	}
+
+	if !reflect.DeepEqual(survey, expected) {
+		t.Errorf("compiled survey mismatch\nwant %+v\ngot  %+v", expected, survey)
+	}
+
+	// the option routes are followed at runtime
+	response := SurveyResponse{Answers: []Answer{{QuestionID: "q1", Value: "no"}}}
+	if ending, ok := survey.EndingReached(response); !ok || ending != "underage" {
+		t.Errorf("expected the option route to the underage ending, got %q %v", ending, ok)
+	}
+}
+
+func TestDecompileSurveyDSL_RoundTrip(t *testing.T) {
+	survey, err := CompileSurveyDSL(ageCheckDSL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	src := DecompileSurveyDSL(*survey)
+
+	again, err := CompileSurveyDSL(src)
+	if err != nil {
+		t.Fatalf("unexpected error compiling the decompiled survey: %v\n%s", err, src)
+	}
+
+	if !reflect.DeepEqual(survey, again) {
+		t.Errorf("round trip mismatch\nwant %+v\ngot  %+v\n%s", survey, again, src)
+	}
+}
+
+func TestCompileSurveyDSL_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		line   int
+		column int
+	}{
+		{
+			name:   "Unknown target",
+			src:    "q1: Name?\n  -> q9",
+			line:   2,
+			column: 6,
+		},
+		{
+			name:   "Invalid expression",
+			src:    "q1: Name?\n  -> q1 if q1 ==",
+			line:   2,
+			column: 16,
+		},
+		{
+			name:   "Unknown question in expression",
+			src:    "q1: Name?\n  -> q1 if q1 == \"a\" && q7 > 1",
+			line:   2,
+			column: 25,
+		},
+		{
+			name:   "Unknown type",
+			src:    "q1 [essay]: Name?",
+			line:   1,
+			column: 5,
+		},
+		{
+			name:   "Indented line without question",
+			src:    "# Title\n  - yes",
+			line:   2,
+			column: 3,
+		},
+		{
+			name:   "Duplicate question",
+			src:    "q1: Name?\nq1: Age?",
+			line:   2,
+			column: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileSurveyDSL(tt.src)
+
+			var dslErr *DSLError
+			if !errors.As(err, &dslErr) {
+				t.Fatalf("expected a DSLError, got %v", err)
+			}
+
+			if dslErr.Line != tt.line || dslErr.Column != tt.column {
+				t.Errorf("expected error at %d:%d, got %d:%d (%s)", tt.line, tt.column, dslErr.Line, dslErr.Column, dslErr.Message)
+			}
+		})
+	}
+}
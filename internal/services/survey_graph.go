@@ -0,0 +1,231 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The flowchart format of the survey export.
+type GraphFormat int
+
+const (
+	GraphDOT GraphFormat = iota + 1
+	GraphMermaid
+)
+
+// The node kind, used to highlight the start, end and unreachable nodes.
+type graphNodeKind int
+
+const (
+	graphQuestion graphNodeKind = iota
+	graphStart
+	graphEnd
+	graphUnreachable
+)
+
+type graphNode struct {
+	id    string
+	label string
+	kinds []graphNodeKind
+}
+
+type graphEdge struct {
+	from  string
+	to    string
+	label string
+}
+
+type surveyGraph struct {
+	nodes []graphNode
+	edges []graphEdge
+}
+
+// Renders the survey flow as a flowchart.
+//
+// Questions and endings are nodes, the conditionals are edges labeled with their
+// expression. The start question is highlighted, so are the endings and the
+// questions with no way forward. Questions no path leads to are flagged as unreachable.
+func ExportSurveyGraph(survey Survey, format GraphFormat) (string, error) {
+	graph := newSurveyGraph(survey)
+
+	switch format {
+	case GraphDOT:
+		return graph.dot(survey.Title), nil
+	case GraphMermaid:
+		return graph.mermaid(), nil
+	default:
+		return "", fmt.Errorf("unknown graph format %d", format)
+	}
+}
+
+func newSurveyGraph(survey Survey) surveyGraph {
+	var graph surveyGraph
+
+	unreachable := make(map[string]bool)
+	for _, id := range survey.UnreachableQuestionIDs() {
+		unreachable[id] = true
+	}
+
+	for _, id := range survey.OrderedQuestionIDs() {
+		question := survey.Questions[id]
+
+		node := graphNode{id: "q_" + id, label: fmt.Sprintf("%s: %s", id, question.Text)}
+		if id == survey.StartID {
+			node.kinds = append(node.kinds, graphStart)
+		}
+		if len(question.Targets()) == 0 {
+			node.kinds = append(node.kinds, graphEnd)
+		}
+		if unreachable[id] {
+			node.kinds = append(node.kinds, graphUnreachable)
+			node.label += " (unreachable)"
+		}
+
+		graph.nodes = append(graph.nodes, node)
+
+		for _, cond := range question.Conditionals {
+			graph.edges = append(graph.edges, graphEdge{from: node.id, to: graphNodeID(survey, cond.NextID), label: cond.Expression})
+		}
+
+		answers := make([]string, 0, len(question.Next))
+		for answer := range question.Next {
+			answers = append(answers, answer)
+		}
+		sort.Strings(answers)
+
+		for _, answer := range answers {
+			graph.edges = append(graph.edges, graphEdge{from: node.id, to: graphNodeID(survey, question.Next[answer]), label: fmt.Sprintf("%s == %q", id, answer)})
+		}
+	}
+
+	endingIDs := make([]string, 0, len(survey.Endings))
+	for id := range survey.Endings {
+		endingIDs = append(endingIDs, id)
+	}
+	sort.Strings(endingIDs)
+
+	for _, id := range endingIDs {
+		ending := survey.Endings[id]
+		graph.nodes = append(graph.nodes, graphNode{
+			id:    "e_" + id,
+			label: fmt.Sprintf("%s: %s", id, ending.Title),
+			kinds: []graphNodeKind{graphEnd},
+		})
+	}
+
+	return graph
+}
+
+// Endings and questions are prefixed so they never clash with each other or the format keywords.
+func graphNodeID(survey Survey, id string) string {
+	if _, ok := survey.Endings[id]; ok {
+		return "e_" + id
+	}
+
+	return "q_" + id
+}
+
+func (n graphNode) is(kind graphNodeKind) bool {
+	for _, k := range n.kinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g surveyGraph) dot(title string) string {
+	var b strings.Builder
+
+	b.WriteString("digraph survey {\n")
+	b.WriteString("  rankdir=TB;\n")
+	if title != "" {
+		fmt.Fprintf(&b, "  label=%s;\n  labelloc=t;\n", dotQuote(title))
+	}
+	b.WriteString("  node [shape=box, style=rounded];\n")
+
+	for _, node := range g.nodes {
+		attrs := []string{"label=" + dotQuote(node.label)}
+
+		switch {
+		case node.is(graphUnreachable):
+			attrs = append(attrs, `style="rounded,dashed,filled"`, `fillcolor="#f8d7da"`, `color="#dc3545"`)
+		case node.is(graphStart):
+			attrs = append(attrs, `style="rounded,filled"`, `fillcolor="#d4edda"`, `color="#28a745"`, "penwidth=2")
+		case node.is(graphEnd):
+			attrs = append(attrs, `style="rounded,filled"`, `fillcolor="#e2e3e5"`, "peripheries=2")
+		}
+
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(node.id), strings.Join(attrs, ", "))
+	}
+
+	for _, edge := range g.edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", dotQuote(edge.from), dotQuote(edge.to), dotQuote(edge.label))
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+func (g surveyGraph) mermaid() string {
+	var b strings.Builder
+
+	b.WriteString("flowchart TD\n")
+
+	var starts, ends, unreachables []string
+
+	for _, node := range g.nodes {
+		if node.is(graphEnd) && !node.is(graphStart) {
+			fmt.Fprintf(&b, "  %s([%s])\n", node.id, mermaidQuote(node.label))
+		} else {
+			fmt.Fprintf(&b, "  %s[%s]\n", node.id, mermaidQuote(node.label))
+		}
+
+		switch {
+		case node.is(graphUnreachable):
+			unreachables = append(unreachables, node.id)
+		case node.is(graphStart):
+			starts = append(starts, node.id)
+		case node.is(graphEnd):
+			ends = append(ends, node.id)
+		}
+	}
+
+	for _, edge := range g.edges {
+		fmt.Fprintf(&b, "  %s -->|%s| %s\n", edge.from, mermaidQuote(edge.label), edge.to)
+	}
+
+	b.WriteString("  classDef start fill:#d4edda,stroke:#28a745,stroke-width:2px\n")
+	b.WriteString("  classDef finish fill:#e2e3e5,stroke:#6c757d\n")
+	b.WriteString("  classDef unreachable fill:#f8d7da,stroke:#dc3545,stroke-dasharray:5 5\n")
+
+	if len(starts) > 0 {
+		fmt.Fprintf(&b, "  class %s start\n", strings.Join(starts, ","))
+	}
+	if len(ends) > 0 {
+		fmt.Fprintf(&b, "  class %s finish\n", strings.Join(ends, ","))
+	}
+	if len(unreachables) > 0 {
+		fmt.Fprintf(&b, "  class %s unreachable\n", strings.Join(unreachables, ","))
+	}
+
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+
+	return `"` + s + `"`
+}
+
+func mermaidQuote(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	s = strings.ReplaceAll(s, "\n", " ")
+
+	return `"` + s + `"`
+}
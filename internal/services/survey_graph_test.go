@@ -0,0 +1,48 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExportSurveyGraph(t *testing.T) {
+	survey := definitionSurvey()
+	survey.Questions["q9"] = Question{ID: "q9", Text: "Orphan?", Type: Text}
+
+	if got := survey.UnreachableQuestionIDs(); len(got) != 1 || got[0] != "q9" {
+		t.Fatalf("expected q9 to be unreachable, got %v", got)
+	}
+
+	dot, err := ExportSurveyGraph(survey, GraphDOT)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		`"q_q1" -> "q_q2" [label="q1 == \"yes\""];`,
+		`"q_q1" -> "e_underage" [label="q1 == \"no\""];`,
+		`"q_q9" [label="q9: Orphan? (unreachable)", style="rounded,dashed,filled"`,
+		`"q_q1" [label="q1: Are you over 18?", style="rounded,filled", fillcolor="#d4edda"`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("expected DOT output to contain %s\n%s", want, dot)
+		}
+	}
+
+	mermaid, err := ExportSurveyGraph(survey, GraphMermaid)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"flowchart TD",
+		`q_q1 -->|"q1 == #quot;yes#quot;"| q_q2`,
+		`e_underage(["underage: Thank you"])`,
+		"class q_q1 start",
+		"class q_q9 unreachable",
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("expected Mermaid output to contain %s\n%s", want, mermaid)
+		}
+	}
+}
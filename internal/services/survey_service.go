@@ -1,25 +1,656 @@
 package services
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/paginator"
+	"github.com/paulexconde/justasking/internal/pkg/store"
+)
+
+const (
+	surveyColumns   = "id, title, start_id, locale, status, opens_at, closes_at, max_responses, endings, translations"
+	questionColumns = "id, survey_id, text, question_type, options, next, conditionals, library_id, library_version, library_linked"
 )
 
+// Called once the survey is updated with the survey as it was before, typically to
+// reschedule its changed dates.
+type SurveyUpdatedHandler func(ctx context.Context, previous, survey Survey)
+
 // Handles the survey CRUD.
 type SurveyService interface {
 	GetSurvey(surveyID string) (*Survey, error)
+	// Validates and persists the survey along with its questions.
+	CreateSurvey(survey Survey) (*Survey, error)
+	// Lists the surveys ordered by creation.
+	ListSurveys(page, limit int) (*paginator.PaginatedResponse[Survey], error)
+	// Replaces the survey and its questions.
+	//
+	// The status is kept, it only changes through `SurveyLifecycleService.Transition`.
+	UpdateSurvey(survey Survey) (*Survey, error)
+	// Subscribes to the updated surveys, the handlers run once the survey is stored.
+	SubscribeSurveyUpdated(handler SurveyUpdatedHandler)
+	DeleteSurvey(surveyID string) error
+	// Persists a deep copy of the survey under new question IDs, see `CloneSurvey`.
+	DuplicateSurvey(surveyID string) (*Survey, error)
+	// Persists the lifecycle status of the survey.
+	UpdateSurveyStatus(surveyID string, status SurveyStatus) error
 }
 
-type surveyServiceImpl struct{}
+type surveyServiceImpl struct {
+	surveys   store.Datastorer[models.Survey]
+	questions store.Datastorer[models.Question]
+
+	mu       sync.RWMutex
+	handlers []SurveyUpdatedHandler
+}
 
 // Instantiate the SurveyService.
-func NewSurveyService() SurveyService {
-	return &surveyServiceImpl{}
+//
+// The questions are written by a hook of the survey store so they share the survey transaction.
+func NewSurveyService(surveys store.Datastorer[models.Survey], questions store.Datastorer[models.Question]) SurveyService {
+	if surveys != nil {
+		surveys.SetHooks(store.Hooks{
+			PostSave: []func(ctx context.Context, tx *sqlx.Tx, data store.DTO, model any, isNew bool) error{
+				saveSurveySettings,
+				saveSurveyQuestions,
+			},
+		})
+	}
+
+	return &surveyServiceImpl{surveys: surveys, questions: questions}
 }
 
 func (s *surveyServiceImpl) GetSurvey(surveyID string) (*Survey, error) {
-	return nil, errors.New("not yet implemented")
+	ctx := context.Background()
+
+	id, err := strconv.Atoi(surveyID)
+	if err != nil {
+		return nil, fault.ErrNotFound
+	}
+
+	survey, err := s.surveys.Get(ctx, fmt.Sprintf("SELECT %s FROM surveys WHERE id = $1", surveyColumns), id)
+	if err != nil {
+		return nil, err
+	}
+
+	questions, err := s.questions.Select(ctx, fmt.Sprintf("SELECT %s FROM survey_questions WHERE survey_id = $1", questionColumns), id)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.surveys.QueryRow(ctx, "SELECT COUNT(*) FROM survey_responses WHERE survey_id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := surveyFromModel(*survey, questions)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, ok := count.(int64); ok {
+		result.ResponseCount = int(n)
+	}
+
+	return result, nil
+}
+
+func (s *surveyServiceImpl) CreateSurvey(survey Survey) (*Survey, error) {
+	if survey.Status == 0 {
+		survey.Status = SurveyDraft
+	}
+
+	if err := survey.Validate(); err != nil {
+		return nil, err
+	}
+
+	created, err := s.surveys.Create(context.Background(), surveyToDTO(survey))
+	if err != nil {
+		return nil, err
+	}
+
+	model, ok := created.(*models.Survey)
+	if !ok {
+		return nil, fault.NewInternalError("unexpected survey model", fmt.Errorf("got %T", created))
+	}
+
+	survey.ID = model.ID
+	return &survey, nil
+}
+
+func (s *surveyServiceImpl) DuplicateSurvey(surveyID string) (*Survey, error) {
+	survey, err := s.GetSurvey(surveyID)
+	if err != nil {
+		return nil, err
+	}
+
+	clone, err := CloneSurvey(*survey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	clone.Title = fmt.Sprintf("%s (copy)", survey.Title)
+	return s.CreateSurvey(*clone)
+}
+
+func (s *surveyServiceImpl) ListSurveys(page, limit int) (*paginator.PaginatedResponse[Survey], error) {
+	ctx := context.Background()
+
+	result, err := paginator.NewPaginator(s.surveys).PaginateQuery(ctx, fmt.Sprintf("SELECT %s FROM surveys ORDER BY id", surveyColumns), nil, page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(result.Items))
+	for _, item := range result.Items {
+		id, err := strconv.ParseInt(item.ID, 10, 64)
+		if err != nil {
+			return nil, fault.NewInternalError("invalid survey id", err)
+		}
+		ids = append(ids, id)
+	}
+
+	questionsBySurvey := make(map[string][]models.Question, len(ids))
+	if len(ids) > 0 {
+		questions, err := s.questions.Select(ctx, fmt.Sprintf("SELECT %s FROM survey_questions WHERE survey_id = ANY($1)", questionColumns), pq.Array(ids))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, question := range questions {
+			questionsBySurvey[question.SurveyID] = append(questionsBySurvey[question.SurveyID], question)
+		}
+	}
+
+	surveys := make([]Survey, 0, len(result.Items))
+	for _, item := range result.Items {
+		survey, err := surveyFromModel(item, questionsBySurvey[item.ID])
+		if err != nil {
+			return nil, err
+		}
+		surveys = append(surveys, *survey)
+	}
+
+	return &paginator.PaginatedResponse[Survey]{
+		Items:       surveys,
+		CurrentPage: result.CurrentPage,
+		TotalPages:  result.TotalPages,
+		PrevPage:    result.PrevPage,
+		NextPage:    result.NextPage,
+		TotalItems:  result.TotalItems,
+	}, nil
+}
+
+func (s *surveyServiceImpl) UpdateSurvey(survey Survey) (*Survey, error) {
+	current, err := s.GetSurvey(survey.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if survey.Status != 0 && survey.Status != current.Status {
+		return nil, fault.NewClientError(fmt.Sprintf("cannot move survey from %s to %s on update, transition it instead", current.Status, survey.Status), nil)
+	}
+	survey.Status = current.Status
+
+	if err := survey.Validate(); err != nil {
+		return nil, err
+	}
+
+	id, _ := strconv.Atoi(survey.ID)
+
+	if _, err := s.surveys.Update(context.Background(), id, surveyToDTO(survey)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fault.ErrNotFound
+		}
+		return nil, err
+	}
+
+	updated, err := s.GetSurvey(survey.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	handlers := make([]SurveyUpdatedHandler, len(s.handlers))
+	copy(handlers, s.handlers)
+	s.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(context.Background(), *current, *updated)
+	}
+
+	return updated, nil
+}
+
+func (s *surveyServiceImpl) SubscribeSurveyUpdated(handler SurveyUpdatedHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers = append(s.handlers, handler)
+}
+
+func (s *surveyServiceImpl) DeleteSurvey(surveyID string) error {
+	// the questions are removed by the foreign key cascade
+	if _, err := s.GetSurvey(surveyID); err != nil {
+		return err
+	}
+
+	id, _ := strconv.Atoi(surveyID)
+
+	return s.surveys.Delete(context.Background(), id)
+}
+
+func (s *surveyServiceImpl) UpdateSurveyStatus(surveyID string, status SurveyStatus) error {
+	id, err := strconv.Atoi(surveyID)
+	if err != nil {
+		return fault.ErrNotFound
+	}
+
+	if _, err := s.surveys.Update(context.Background(), id, &models.SurveyStatusDTO{Status: status.String()}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fault.ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Writes the settings of the survey that can be cleared on update.
+//
+// The store skips the empty fields when updating, so removing the locale, the dates
+// or the maximum responses would otherwise keep the stored ones.
+func saveSurveySettings(ctx context.Context, tx *sqlx.Tx, data store.DTO, model any, isNew bool) error {
+	dto, ok := data.(*models.SurveyDTO)
+	if !ok || isNew {
+		return nil
+	}
+
+	survey, ok := model.(*models.Survey)
+	if !ok {
+		return fmt.Errorf("unexpected survey model %T", model)
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE surveys SET locale = $1, opens_at = $2, closes_at = $3, max_responses = $4 WHERE id = $5",
+		dto.Locale, dto.OpensAt, dto.ClosesAt, dto.MaxResponses, survey.ID)
+
+	return err
+}
+
+// Writes the questions of the survey, replacing the existing ones on update.
+func saveSurveyQuestions(ctx context.Context, tx *sqlx.Tx, data store.DTO, model any, isNew bool) error {
+	dto, ok := data.(*models.SurveyDTO)
+	if !ok {
+		return nil
+	}
+
+	survey, ok := model.(*models.Survey)
+	if !ok {
+		return fmt.Errorf("unexpected survey model %T", model)
+	}
+
+	if !isNew {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM survey_questions WHERE survey_id = $1", survey.ID); err != nil {
+			return err
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO survey_questions (%s) VALUES (:id, :survey_id, :text, :question_type, :options, :next, :conditionals, :library_id, :library_version, :library_linked)", questionColumns)
+
+	for _, question := range dto.Questions {
+		question.SurveyID = survey.ID
+
+		if _, err := tx.NamedExecContext(ctx, query, question); err != nil {
+			if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
+				return fault.ErrUniqueViolation
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func surveyToDTO(survey Survey) *models.SurveyDTO {
+	dto := &models.SurveyDTO{
+		Title:        survey.Title,
+		StartID:      survey.StartID,
+		Locale:       survey.Locale,
+		Status:       survey.Status.String(),
+		OpensAt:      timePtr(survey.OpensAt),
+		ClosesAt:     timePtr(survey.ClosesAt),
+		MaxResponses: survey.MaxResponses,
+	}
+
+	for _, id := range survey.OrderedQuestionIDs() {
+		question := survey.Questions[id]
+
+		conditionals := make(models.Conditionals, 0, len(question.Conditionals))
+		for _, cond := range question.Conditionals {
+			conditionals = append(conditionals, models.ConditionalNext{Expression: cond.Expression, NextID: cond.NextID})
+		}
+
+		model := models.Question{
+			ID:           question.ID,
+			Text:         question.Text,
+			Type:         question.Type.String(),
+			Options:      stringArray(question.Options),
+			Next:         question.Next,
+			Conditionals: conditionals,
+		}
+
+		if question.Library != nil {
+			libraryID := question.Library.QuestionID
+			model.LibraryID = &libraryID
+			model.LibraryVersion = question.Library.Version
+			model.LibraryLinked = question.Library.Linked
+		}
+
+		dto.Questions = append(dto.Questions, model)
+	}
+
+	for id, ending := range survey.Endings {
+		if dto.Endings == nil {
+			dto.Endings = make(models.Endings, len(survey.Endings))
+		}
+		dto.Endings[id] = models.Ending{ID: ending.ID, Title: ending.Title, Message: ending.Message}
+	}
+
+	for locale, translation := range survey.Translations {
+		if dto.Translations == nil {
+			dto.Translations = make(models.Translations, len(survey.Translations))
+		}
+
+		t := models.Translation{Title: translation.Title}
+		for id, qt := range translation.Questions {
+			if t.Questions == nil {
+				t.Questions = make(map[string]models.QuestionTranslation, len(translation.Questions))
+			}
+			t.Questions[id] = models.QuestionTranslation{Text: qt.Text, Options: qt.Options}
+		}
+		for id, et := range translation.Endings {
+			if t.Endings == nil {
+				t.Endings = make(map[string]models.EndingTranslation, len(translation.Endings))
+			}
+			t.Endings[id] = models.EndingTranslation{Title: et.Title, Message: et.Message}
+		}
+
+		dto.Translations[locale] = t
+	}
+
+	return dto
+}
+
+func surveyFromModel(model models.Survey, questions []models.Question) (*Survey, error) {
+	survey := &Survey{
+		ID:           model.ID,
+		Title:        model.Title,
+		StartID:      model.StartID,
+		Locale:       model.Locale,
+		MaxResponses: model.MaxResponses,
+		Questions:    make(map[string]Question, len(questions)),
+	}
+
+	if model.Status != "" {
+		status, err := ParseSurveyStatus(model.Status)
+		if err != nil {
+			return nil, fault.NewInternalError("invalid stored survey", err)
+		}
+		survey.Status = status
+	}
+
+	if model.OpensAt != nil {
+		survey.OpensAt = *model.OpensAt
+	}
+	if model.ClosesAt != nil {
+		survey.ClosesAt = *model.ClosesAt
+	}
+
+	for _, q := range questions {
+		questionType, err := ParseQuestionType(q.Type)
+		if err != nil {
+			return nil, fault.NewInternalError("invalid stored question", err)
+		}
+
+		question := Question{
+			ID:   q.ID,
+			Text: q.Text,
+			Type: questionType,
+			Next: q.Next,
+		}
+		// the questions without options are stored with an empty array
+		if len(q.Options) > 0 {
+			question.Options = q.Options
+		}
+
+		for _, cond := range q.Conditionals {
+			question.Conditionals = append(question.Conditionals, ConditionalNext{Expression: cond.Expression, NextID: cond.NextID})
+		}
+
+		if q.LibraryID != nil {
+			question.Library = &LibraryLink{QuestionID: *q.LibraryID, Version: q.LibraryVersion, Linked: q.LibraryLinked}
+		}
+
+		survey.Questions[question.ID] = question
+	}
+
+	for id, ending := range model.Endings {
+		if survey.Endings == nil {
+			survey.Endings = make(map[string]Ending, len(model.Endings))
+		}
+		survey.Endings[id] = Ending{ID: ending.ID, Title: ending.Title, Message: ending.Message}
+	}
+
+	for locale, t := range model.Translations {
+		if survey.Translations == nil {
+			survey.Translations = make(map[string]Translation, len(model.Translations))
+		}
+
+		translation := Translation{Title: t.Title}
+		for id, qt := range t.Questions {
+			if translation.Questions == nil {
+				translation.Questions = make(map[string]QuestionTranslation, len(t.Questions))
+			}
+			translation.Questions[id] = QuestionTranslation{Text: qt.Text, Options: qt.Options}
+		}
+		for id, et := range t.Endings {
+			if translation.Endings == nil {
+				translation.Endings = make(map[string]EndingTranslation, len(t.Endings))
+			}
+			translation.Endings[id] = EndingTranslation{Title: et.Title, Message: et.Message}
+		}
+
+		survey.Translations[locale] = translation
+	}
+
+	return survey, nil
+}
+
+// The values written as an empty array rather than NULL into the NOT NULL array columns.
+func stringArray(values []string) pq.StringArray {
+	if values == nil {
+		return pq.StringArray{}
+	}
+
+	return values
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// Validates the structure of the survey.
+//
+// Checks that the start question exists, that every question has a known type
+// and that every conditional points to an existing question or ending.
+func (s Survey) Validate() error {
+	var errs []error
+
+	if len(s.Questions) == 0 {
+		errs = append(errs, errors.New("survey has no questions"))
+	}
+
+	if _, ok := s.Questions[s.StartID]; !ok {
+		errs = append(errs, fmt.Errorf("start question %q does not exist", s.StartID))
+	}
+
+	for _, id := range sortedQuestionIDs(s.Questions) {
+		question := s.Questions[id]
+
+		if question.ID != id {
+			errs = append(errs, fmt.Errorf("question %q is keyed as %q", question.ID, id))
+		}
+
+		if _, ok := s.Endings[id]; ok {
+			errs = append(errs, fmt.Errorf("question %q has the same id as an ending", id))
+		}
+
+		if _, ok := questionTypeNames[question.Type]; !ok {
+			errs = append(errs, fmt.Errorf("question %q has an unknown type %d", id, question.Type))
+		}
+
+		for _, next := range question.Next {
+			if !s.hasTarget(next) {
+				errs = append(errs, fmt.Errorf("question %q points to an unknown question %q", id, next))
+			}
+		}
+
+		for i, cond := range question.Conditionals {
+			if !s.hasTarget(cond.NextID) {
+				errs = append(errs, fmt.Errorf("question %q conditional #%d points to an unknown question %q", id, i+1, cond.NextID))
+			}
+
+			idents, err := expressionIdentifiers(cond.Expression)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("question %q conditional #%d has an invalid expression: %w", id, i+1, err))
+				continue
+			}
+
+			for _, ident := range idents {
+				if _, ok := s.Questions[ident]; !ok {
+					errs = append(errs, fmt.Errorf("question %q conditional #%d references an unknown question %q", id, i+1, ident))
+				}
+			}
+		}
+	}
+
+	for id, ending := range s.Endings {
+		if ending.ID != id {
+			errs = append(errs, fmt.Errorf("ending %q is keyed as %q", ending.ID, id))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fault.NewClientError("invalid survey", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// Whether the id is a question or an ending of the survey.
+func (s Survey) hasTarget(id string) bool {
+	if _, ok := s.Questions[id]; ok {
+		return true
+	}
+
+	_, ok := s.Endings[id]
+	return ok
+}
+
+func sortedQuestionIDs(questions map[string]Question) []string {
+	ids := make([]string, 0, len(questions))
+	for id := range questions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
 }
 
-func (s *surveyServiceImpl) CreateSurvey() (*Survey, error) {
-	return nil, errors.New("not yet implemeted")
+// Lists the question IDs in the order a respondent would meet them.
+//
+// Questions are walked breadth-first from the start question following the
+// conditionals, then the `Next` map. Unreachable questions come last sorted by ID.
+func (s Survey) OrderedQuestionIDs() []string {
+	ids, visited := s.walk()
+
+	for _, id := range sortedQuestionIDs(s.Questions) {
+		if !visited[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// Lists the questions that no path from the start question leads to, sorted by ID.
+func (s Survey) UnreachableQuestionIDs() []string {
+	_, visited := s.walk()
+
+	var ids []string
+	for _, id := range sortedQuestionIDs(s.Questions) {
+		if !visited[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// The IDs a respondent may be routed to after the question, in evaluation order.
+func (q Question) Targets() []string {
+	targets := make([]string, 0, len(q.Conditionals)+len(q.Next))
+	for _, cond := range q.Conditionals {
+		targets = append(targets, cond.NextID)
+	}
+
+	keys := make([]string, 0, len(q.Next))
+	for key := range q.Next {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		targets = append(targets, q.Next[key])
+	}
+
+	return targets
+}
+
+// Walks breadth-first from the start question, returning the reachable questions in order.
+func (s Survey) walk() ([]string, map[string]bool) {
+	ids := make([]string, 0, len(s.Questions))
+	visited := make(map[string]bool, len(s.Questions))
+
+	queue := []string{s.StartID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		question, ok := s.Questions[id]
+		if !ok || visited[id] {
+			continue
+		}
+
+		visited[id] = true
+		ids = append(ids, id)
+		queue = append(queue, question.Targets()...)
+	}
+
+	return ids, visited
 }
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulexconde/justasking/internal/models"
+)
+
+func TestSurveyModelMapping(t *testing.T) {
+	survey := definitionSurvey()
+	survey.Status = SurveyScheduled
+	survey.OpensAt = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	survey.MaxResponses = 500
+
+	dto := surveyToDTO(survey)
+
+	if len(dto.Questions) != 2 || dto.Questions[0].ID != "q1" {
+		t.Fatalf("expected the questions in flow order, got %+v", dto.Questions)
+	}
+	if dto.Status != "scheduled" || dto.ClosesAt != nil {
+		t.Errorf("unexpected dto %+v", dto)
+	}
+
+	model := dto.ToModel(1).(*models.Survey)
+
+	got, err := surveyFromModel(*model, dto.Questions)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	survey.ID = "1"
+	if !reflect.DeepEqual(*got, survey) {
+		t.Errorf("mapping mismatch\nwant %+v\ngot  %+v", survey, *got)
+	}
+}
+
+func TestSurveyModelMapping_InvalidType(t *testing.T) {
+	_, err := surveyFromModel(models.Survey{ID: "1"}, []models.Question{{ID: "q1", Type: "essay"}})
+	if err == nil {
+		t.Error("expected an error for an unknown stored question type")
+	}
+}
+
+func TestSaveSurveyQuestions_NoOptions(t *testing.T) {
+	tx, execs := recordingTx(t)
+
+	if err := saveSurveyQuestions(context.Background(), tx, surveyToDTO(definitionSurvey()), &models.Survey{ID: "1"}, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*execs) != 2 {
+		t.Fatalf("expected one insert per question, got %+v", *execs)
+	}
+
+	// id, survey_id, text, question_type, options...
+	if got := (*execs)[0].args[4]; got != `{"yes","no"}` {
+		t.Errorf("expected the options of q1, got %#v", got)
+	}
+	if got := (*execs)[1].args[4]; got != "{}" {
+		t.Errorf("expected an empty array for the options of q2, got %#v", got)
+	}
+}
+
+func TestSaveSurveySettings_Cleared(t *testing.T) {
+	tx, execs := recordingTx(t)
+
+	survey := definitionSurvey()
+	survey.Locale = ""
+
+	if err := saveSurveySettings(context.Background(), tx, surveyToDTO(survey), &models.Survey{ID: "1"}, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(*execs) != 1 || !strings.HasPrefix((*execs)[0].query, "UPDATE surveys SET locale = $1, opens_at = $2, closes_at = $3, max_responses = $4") {
+		t.Fatalf("expected the settings to be updated, got %+v", *execs)
+	}
+	// the cleared settings are written rather than skipped
+	if want := []any{"", nil, nil, int64(0), "1"}; !reflect.DeepEqual((*execs)[0].args, want) {
+		t.Errorf("expected arguments %#v, got %#v", want, (*execs)[0].args)
+	}
+
+	*execs = nil
+	if err := saveSurveySettings(context.Background(), tx, surveyToDTO(survey), &models.Survey{ID: "1"}, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*execs) != 0 {
+		t.Errorf("expected the created survey to be left as inserted, got %+v", *execs)
+	}
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+// NOTE: the templates are plain surveys, once created they can be edited like any other.
+// The score question of each template is keyed by the template name, e.g. "nps", so the
+// metrics know where to look for it.
+
+// A built-in survey users can start from.
+type SurveyTemplate int
+
+const (
+	// Net Promoter Score, how likely the respondent recommends the company.
+	TemplateNPS SurveyTemplate = iota + 1
+	// Customer Satisfaction, how satisfied the respondent is.
+	TemplateCSAT
+	// Customer Effort Score, how easy it was to get the issue handled.
+	TemplateCES
+	// Employee Net Promoter Score, how likely the employee recommends the company as a workplace.
+	TemplateENPS
+)
+
+var surveyTemplateNames = map[SurveyTemplate]string{
+	TemplateNPS:  "nps",
+	TemplateCSAT: "csat",
+	TemplateCES:  "ces",
+	TemplateENPS: "enps",
+}
+
+// The name of the template, also the ID of its score question.
+func (t SurveyTemplate) String() string {
+	if name, ok := surveyTemplateNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("SurveyTemplate(%d)", int(t))
+}
+
+// Parses the name of the template.
+func ParseSurveyTemplate(name string) (SurveyTemplate, error) {
+	for t, n := range surveyTemplateNames {
+		if n == name {
+			return t, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown survey template %q", name)
+}
+
+// The ID of the rating question the template metric is computed from.
+func (t SurveyTemplate) ScoreQuestionID() string {
+	return t.String()
+}
+
+// The built-in templates in the order they are offered.
+func SurveyTemplates() []SurveyTemplate {
+	return []SurveyTemplate{TemplateNPS, TemplateCSAT, TemplateCES, TemplateENPS}
+}
+
+// The locales the templates are written in.
+func TemplateLocales() []string {
+	locales := make([]string, 0, len(templateTexts))
+	for locale := range templateTexts {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	return locales
+}
+
+// The parameters the template is filled in with.
+type TemplateParams struct {
+	// The survey ID, empty lets the store assign it.
+	SurveyID string
+	// The company, product or team the survey is about.
+	CompanyName string
+	// The locale of the texts, defaults to "en".
+	Locale string
+	// Adds the other built-in locales as translations.
+	Translate bool
+}
+
+// The follow-up question the score routes to when the expression matches.
+type templateFollowUp struct {
+	expression string
+	questionID string
+}
+
+type templateSpec struct {
+	// The rating scale of the score question.
+	min, max int
+	// Evaluated in order, the last one should always match.
+	followUps []templateFollowUp
+}
+
+const (
+	templateEndingID = "thanks"
+	// Keys the texts shared by all the templates.
+	templateCommon SurveyTemplate = 0
+)
+
+var templateSpecs = map[SurveyTemplate]templateSpec{
+	TemplateNPS: {
+		min: 0,
+		max: 10,
+		followUps: []templateFollowUp{
+			{expression: fmt.Sprintf("nps >= %d", NPSPromoterMin), questionID: "promoter_reason"},
+			{expression: fmt.Sprintf("nps >= %d", NPSPassiveMin), questionID: "passive_reason"},
+			{expression: "true", questionID: "detractor_reason"},
+		},
+	},
+	TemplateCSAT: {
+		min: 1,
+		max: 5,
+		followUps: []templateFollowUp{
+			{expression: "csat >= 4", questionID: "csat_liked"},
+			{expression: "true", questionID: "csat_improve"},
+		},
+	},
+	TemplateCES: {
+		min: 1,
+		max: 7,
+		followUps: []templateFollowUp{
+			{expression: "ces <= 3", questionID: "ces_difficulty"},
+			{expression: "true", questionID: "ces_comment"},
+		},
+	},
+	TemplateENPS: {
+		min: 0,
+		max: 10,
+		followUps: []templateFollowUp{
+			{expression: fmt.Sprintf("enps >= %d", NPSPromoterMin), questionID: "promoter_reason"},
+			{expression: fmt.Sprintf("enps >= %d", NPSPassiveMin), questionID: "passive_reason"},
+			{expression: "true", questionID: "detractor_reason"},
+		},
+	},
+}
+
+// The texts keyed by locale, template then question ID. "{company}" is replaced by the company name.
+var templateTexts = map[string]map[SurveyTemplate]map[string]string{
+	"en": {
+		TemplateNPS: {
+			"title":            "{company} Net Promoter Score",
+			"nps":              "How likely are you to recommend {company} to a friend or colleague? (0 = not at all likely, 10 = extremely likely)",
+			"promoter_reason":  "What do you like most about {company}?",
+			"passive_reason":   "What would make you more likely to recommend {company}?",
+			"detractor_reason": "What disappointed you about {company}?",
+		},
+		TemplateCSAT: {
+			"title":        "{company} Customer Satisfaction",
+			"csat":         "How satisfied are you with {company}? (1 = very dissatisfied, 5 = very satisfied)",
+			"csat_liked":   "What did you like the most?",
+			"csat_improve": "What could {company} do better?",
+		},
+		TemplateCES: {
+			"title":          "{company} Customer Effort Score",
+			"ces":            "{company} made it easy for me to handle my issue. (1 = strongly disagree, 7 = strongly agree)",
+			"ces_difficulty": "What made it difficult?",
+			"ces_comment":    "Is there anything else you would like to tell us?",
+		},
+		TemplateENPS: {
+			"title":            "{company} Employee Net Promoter Score",
+			"enps":             "How likely are you to recommend {company} as a place to work? (0 = not at all likely, 10 = extremely likely)",
+			"promoter_reason":  "What do you like most about working at {company}?",
+			"passive_reason":   "What would make {company} a better place to work?",
+			"detractor_reason": "What is the main reason for your score?",
+		},
+		templateCommon: {
+			"thanks_title":   "Thank you!",
+			"thanks_message": "Your feedback helps {company} improve.",
+		},
+	},
+	"es": {
+		TemplateNPS: {
+			"title":            "Net Promoter Score de {company}",
+			"nps":              "¿Qué probabilidad hay de que recomiendes {company} a un amigo o colega? (0 = nada probable, 10 = muy probable)",
+			"promoter_reason":  "¿Qué es lo que más te gusta de {company}?",
+			"passive_reason":   "¿Qué haría que recomendaras más {company}?",
+			"detractor_reason": "¿Qué te decepcionó de {company}?",
+		},
+		TemplateCSAT: {
+			"title":        "Satisfacción del cliente de {company}",
+			"csat":         "¿Qué tan satisfecho estás con {company}? (1 = muy insatisfecho, 5 = muy satisfecho)",
+			"csat_liked":   "¿Qué es lo que más te gustó?",
+			"csat_improve": "¿Qué podría hacer mejor {company}?",
+		},
+		TemplateCES: {
+			"title":          "Customer Effort Score de {company}",
+			"ces":            "{company} me facilitó resolver mi problema. (1 = totalmente en desacuerdo, 7 = totalmente de acuerdo)",
+			"ces_difficulty": "¿Qué lo hizo difícil?",
+			"ces_comment":    "¿Hay algo más que quieras contarnos?",
+		},
+		TemplateENPS: {
+			"title":            "eNPS de {company}",
+			"enps":             "¿Qué probabilidad hay de que recomiendes {company} como lugar de trabajo? (0 = nada probable, 10 = muy probable)",
+			"promoter_reason":  "¿Qué es lo que más te gusta de trabajar en {company}?",
+			"passive_reason":   "¿Qué haría de {company} un mejor lugar de trabajo?",
+			"detractor_reason": "¿Cuál es el motivo principal de tu puntuación?",
+		},
+		templateCommon: {
+			"thanks_title":   "¡Gracias!",
+			"thanks_message": "Tus comentarios ayudan a {company} a mejorar.",
+		},
+	},
+	"fr": {
+		TemplateNPS: {
+			"title":            "Net Promoter Score de {company}",
+			"nps":              "Quelle est la probabilité que vous recommandiez {company} à un ami ou un collègue ? (0 = pas du tout probable, 10 = très probable)",
+			"promoter_reason":  "Qu'appréciez-vous le plus chez {company} ?",
+			"passive_reason":   "Qu'est-ce qui vous donnerait davantage envie de recommander {company} ?",
+			"detractor_reason": "Qu'est-ce qui vous a déçu chez {company} ?",
+		},
+		TemplateCSAT: {
+			"title":        "Satisfaction client de {company}",
+			"csat":         "Quel est votre niveau de satisfaction vis-à-vis de {company} ? (1 = très insatisfait, 5 = très satisfait)",
+			"csat_liked":   "Qu'avez-vous le plus apprécié ?",
+			"csat_improve": "Que pourrait améliorer {company} ?",
+		},
+		TemplateCES: {
+			"title":          "Customer Effort Score de {company}",
+			"ces":            "{company} m'a facilité le traitement de ma demande. (1 = pas du tout d'accord, 7 = tout à fait d'accord)",
+			"ces_difficulty": "Qu'est-ce qui a rendu cela difficile ?",
+			"ces_comment":    "Souhaitez-vous nous dire autre chose ?",
+		},
+		TemplateENPS: {
+			"title":            "eNPS de {company}",
+			"enps":             "Quelle est la probabilité que vous recommandiez {company} comme employeur ? (0 = pas du tout probable, 10 = très probable)",
+			"promoter_reason":  "Qu'appréciez-vous le plus dans votre travail chez {company} ?",
+			"passive_reason":   "Qu'est-ce qui rendrait {company} plus agréable comme lieu de travail ?",
+			"detractor_reason": "Quelle est la principale raison de votre note ?",
+		},
+		templateCommon: {
+			"thanks_title":   "Merci !",
+			"thanks_message": "Vos retours aident {company} à s'améliorer.",
+		},
+	},
+}
+
+// Builds a ready to run survey out of the built-in template.
+//
+// The score question routes to a follow-up question asking for the reason of the score, the
+// NPS templates branch on the same promoter and passive thresholds as `NPS`. The survey is a draft.
+func NewSurveyFromTemplate(template SurveyTemplate, params TemplateParams) (*Survey, error) {
+	spec, ok := templateSpecs[template]
+	if !ok {
+		return nil, fault.NewClientError(fmt.Sprintf("unknown survey template %d", template), nil)
+	}
+
+	if strings.TrimSpace(params.CompanyName) == "" {
+		return nil, fault.NewClientError("company name is required", nil)
+	}
+
+	if params.Locale == "" {
+		params.Locale = "en"
+	}
+
+	texts, ok := templateTexts[params.Locale]
+	if !ok {
+		return nil, fault.NewClientError(fmt.Sprintf("template locale %q is not supported, expected one of %s", params.Locale, strings.Join(TemplateLocales(), ", ")), nil)
+	}
+
+	text := func(texts map[SurveyTemplate]map[string]string, template SurveyTemplate, key string) string {
+		return strings.ReplaceAll(texts[template][key], "{company}", params.CompanyName)
+	}
+
+	scoreID := template.ScoreQuestionID()
+
+	score := Question{
+		ID:      scoreID,
+		Text:    text(texts, template, scoreID),
+		Type:    Rating,
+		Options: RatingScale(spec.min, spec.max),
+	}
+
+	survey := Survey{
+		ID:        params.SurveyID,
+		Title:     text(texts, template, "title"),
+		StartID:   scoreID,
+		Locale:    params.Locale,
+		Questions: map[string]Question{},
+		Endings: map[string]Ending{
+			templateEndingID: {
+				ID:      templateEndingID,
+				Title:   text(texts, templateCommon, "thanks_title"),
+				Message: text(texts, templateCommon, "thanks_message"),
+			},
+		},
+		Status: SurveyDraft,
+	}
+
+	for _, followUp := range spec.followUps {
+		score.Conditionals = append(score.Conditionals, ConditionalNext{Expression: followUp.expression, NextID: followUp.questionID})
+
+		survey.Questions[followUp.questionID] = Question{
+			ID:           followUp.questionID,
+			Text:         text(texts, template, followUp.questionID),
+			Type:         Text,
+			Conditionals: []ConditionalNext{{Expression: "true", NextID: templateEndingID}},
+		}
+	}
+	survey.Questions[scoreID] = score
+
+	if params.Translate {
+		for locale, texts := range templateTexts {
+			if locale == params.Locale {
+				continue
+			}
+
+			translation := Translation{
+				Title:     text(texts, template, "title"),
+				Questions: make(map[string]QuestionTranslation, len(survey.Questions)),
+				Endings: map[string]EndingTranslation{
+					templateEndingID: {Title: text(texts, templateCommon, "thanks_title"), Message: text(texts, templateCommon, "thanks_message")},
+				},
+			}
+
+			for id := range survey.Questions {
+				translation.Questions[id] = QuestionTranslation{Text: text(texts, template, id)}
+			}
+
+			if survey.Translations == nil {
+				survey.Translations = make(map[string]Translation)
+			}
+			survey.Translations[locale] = translation
+		}
+	}
+
+	if err := survey.Validate(); err != nil {
+		return nil, fault.NewInternalError("invalid survey template", err)
+	}
+
+	return &survey, nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+)
+
+func TestNewSurveyFromTemplate(t *testing.T) {
+	for _, template := range SurveyTemplates() {
+		for _, locale := range TemplateLocales() {
+			survey, err := NewSurveyFromTemplate(template, TemplateParams{CompanyName: "Acme", Locale: locale, Translate: true})
+			if err != nil {
+				t.Fatalf("%s %s: unexpected error: %v", template, locale, err)
+			}
+
+			score, ok := survey.Questions[template.ScoreQuestionID()]
+			if !ok || score.Type != Rating || survey.StartID != score.ID {
+				t.Errorf("%s %s: expected the rating score question to start the survey, got %+v", template, locale, score)
+			}
+
+			if len(survey.Translations) != len(TemplateLocales())-1 {
+				t.Errorf("%s %s: expected the other locales as translations, got %d", template, locale, len(survey.Translations))
+			}
+
+			for id, question := range survey.Questions {
+				if question.Text == "" {
+					t.Errorf("%s %s: question %q has no text", template, locale, id)
+				}
+			}
+		}
+	}
+}
+
+func TestNewSurveyFromTemplate_NPSFollowUp(t *testing.T) {
+	survey, err := NewSurveyFromTemplate(TemplateNPS, TemplateParams{CompanyName: "Acme"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service := NewSurveyResponseService(NewSurveyService(nil, nil), nil)
+	nps := survey.Questions["nps"]
+
+	tests := []struct {
+		score    int
+		expected string
+	}{
+		{10, "promoter_reason"},
+		{NPSPromoterMin, "promoter_reason"},
+		{NPSPassiveMin, "passive_reason"},
+		{NPSPassiveMin - 1, "detractor_reason"},
+		{0, "detractor_reason"},
+	}
+
+	for _, tt := range tests {
+		if err := nps.ValidateAnswer(tt.score); err != nil {
+			t.Errorf("score %d: unexpected validation error: %v", tt.score, err)
+		}
+
+		next, err := service.GetNextQuestionWithLogic(nps, map[string]any{"nps": tt.score})
+		if err != nil {
+			t.Fatalf("score %d: unexpected error: %v", tt.score, err)
+		}
+		if next != tt.expected {
+			t.Errorf("score %d: expected %q, got %q", tt.score, tt.expected, next)
+		}
+	}
+
+	if err := nps.ValidateAnswer(11); err == nil {
+		t.Error("expected an error for a score out of the scale")
+	}
+	if err := nps.ValidateAnswer(7.5); err == nil {
+		t.Error("expected an error for a score between the points of the scale")
+	}
+}
+
+func TestNewSurveyFromTemplate_InvalidParams(t *testing.T) {
+	if _, err := NewSurveyFromTemplate(TemplateCSAT, TemplateParams{}); !fault.IsClientError(err) {
+		t.Errorf("expected a client error without company name, got %v", err)
+	}
+
+	if _, err := NewSurveyFromTemplate(TemplateCSAT, TemplateParams{CompanyName: "Acme", Locale: "xx"}); !fault.IsClientError(err) {
+		t.Errorf("expected a client error for an unsupported locale, got %v", err)
+	}
+}
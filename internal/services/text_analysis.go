@@ -0,0 +1,107 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/paulexconde/justasking/internal/pkg/textanalysis"
+)
+
+// The default number of words of the word cloud.
+const DefaultWordCloudSize = 50
+
+// The options of `AnalyzeTextAnswers`.
+type TextAnalysisOptions struct {
+	// The language of the answers, usually the survey locale, defaults to "en".
+	Language string
+	// Keeps only the most frequent terms and bigrams, zero keeps them all.
+	TopTerms int
+	// Defaults to `DefaultWordCloudSize` when zero.
+	WordCloudSize int
+}
+
+// The sentiment of the answer of a response.
+type ResponseSentiment struct {
+	ResponseID string
+	textanalysis.Sentiment
+}
+
+// The analysis of the open-ended answers to a question.
+type TextAnalysis struct {
+	QuestionID string
+	Language   string
+	// The non blank answers analyzed.
+	Answers   int
+	Terms     []textanalysis.TermCount
+	Bigrams   []textanalysis.TermCount
+	WordCloud []textanalysis.WordCloudEntry
+
+	Sentiments []ResponseSentiment
+	// The mean of the normalized sentiment scores.
+	AverageSentiment float64
+	Positive         int
+	Neutral          int
+	Negative         int
+}
+
+// Analyzes the text answers to the question, offline.
+//
+// The answers are tokenized without the stop words of the language for the terms, bigrams
+// and word cloud, the sentiment is scored on the whole answer so negations are kept.
+func AnalyzeTextAnswers(responses []SurveyResponse, questionID string, options TextAnalysisOptions) TextAnalysis {
+	if options.Language == "" {
+		options.Language = "en"
+	}
+	if options.WordCloudSize == 0 {
+		options.WordCloudSize = DefaultWordCloudSize
+	}
+
+	analysis := TextAnalysis{QuestionID: questionID, Language: options.Language}
+
+	var documents, tokens [][]string
+	var total float64
+
+	for _, response := range responses {
+		answer, ok := response.answer(questionID)
+		if !ok {
+			continue
+		}
+
+		text, ok := answer.Value.(string)
+		if !ok || strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		analysis.Answers++
+		words := textanalysis.Tokens(text, options.Language)
+		tokens = append(tokens, words)
+		documents = append(documents, textanalysis.RemoveStopWords(words, options.Language))
+
+		sentiment := textanalysis.AnalyzeSentiment(text, options.Language)
+		analysis.Sentiments = append(analysis.Sentiments, ResponseSentiment{ResponseID: response.ID, Sentiment: sentiment})
+		total += sentiment.Score
+
+		switch sentiment.Label {
+		case textanalysis.Positive:
+			analysis.Positive++
+		case textanalysis.Negative:
+			analysis.Negative++
+		default:
+			analysis.Neutral++
+		}
+	}
+
+	if analysis.Answers > 0 {
+		analysis.AverageSentiment = total / float64(analysis.Answers)
+	}
+
+	analysis.Terms = textanalysis.TermFrequencies(documents)
+	analysis.Bigrams = textanalysis.Bigrams(tokens, options.Language)
+	analysis.WordCloud = textanalysis.WordCloud(analysis.Terms, options.WordCloudSize)
+
+	if options.TopTerms > 0 {
+		analysis.Terms = analysis.Terms[:min(options.TopTerms, len(analysis.Terms))]
+		analysis.Bigrams = analysis.Bigrams[:min(options.TopTerms, len(analysis.Bigrams))]
+	}
+
+	return analysis
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/paulexconde/justasking/internal/pkg/textanalysis"
+)
+
+func textResponse(id, text string) SurveyResponse {
+	return SurveyResponse{ID: id, Answers: []Answer{{QuestionID: "why", Value: text}}}
+}
+
+func TestAnalyzeTextAnswers(t *testing.T) {
+	responses := []SurveyResponse{
+		textResponse("r1", "The support team was very helpful and the app is fast."),
+		textResponse("r2", "Support team was rude, the app is not fast at all."),
+		textResponse("r3", "The app crashes."),
+		textResponse("r4", "   "),
+		{ID: "r5"},
+	}
+
+	analysis := AnalyzeTextAnswers(responses, "why", TextAnalysisOptions{TopTerms: 3})
+
+	if analysis.Answers != 3 {
+		t.Fatalf("expected 3 answers analyzed, got %d", analysis.Answers)
+	}
+
+	if len(analysis.Terms) != 3 || analysis.Terms[0].Term != "app" || analysis.Terms[0].Count != 3 {
+		t.Errorf("expected app to be the most frequent term, got %+v", analysis.Terms)
+	}
+	for _, term := range analysis.Terms {
+		if textanalysis.IsStopWord(term.Term, "en") {
+			t.Errorf("unexpected stop word %q", term.Term)
+		}
+	}
+
+	if analysis.Bigrams[0].Term != "support team" || analysis.Bigrams[0].Count != 2 {
+		t.Errorf("expected support team to be the most frequent bigram, got %+v", analysis.Bigrams)
+	}
+
+	if analysis.WordCloud[0].Term != "app" || analysis.WordCloud[0].Weight != 1 {
+		t.Errorf("unexpected word cloud %+v", analysis.WordCloud)
+	}
+
+	labels := []textanalysis.SentimentLabel{textanalysis.Positive, textanalysis.Negative, textanalysis.Negative}
+	for i, sentiment := range analysis.Sentiments {
+		if sentiment.Label != labels[i] {
+			t.Errorf("%s: expected %s, got %s (%v)", sentiment.ResponseID, labels[i], sentiment.Label, sentiment.Score)
+		}
+	}
+	if analysis.Positive != 1 || analysis.Negative != 2 {
+		t.Errorf("unexpected sentiment counts %+v", analysis)
+	}
+}
+
+func TestAnalyzeTextAnswers_French(t *testing.T) {
+	responses := []SurveyResponse{textResponse("r1", "L'accueil n'était pas agréable, très lent.")}
+
+	analysis := AnalyzeTextAnswers(responses, "why", TextAnalysisOptions{Language: "fr"})
+
+	if analysis.Terms[0].Term != "accueil" {
+		t.Errorf("expected the elision to be stripped, got %+v", analysis.Terms)
+	}
+	if analysis.Sentiments[0].Label != textanalysis.Negative {
+		t.Errorf("expected a negative sentiment, got %+v", analysis.Sentiments[0])
+	}
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/store"
+	"github.com/paulexconde/justasking/internal/pkg/textanalysis"
+)
+
+// NOTE: the answers are grouped into topics by k-means over their TF-IDF vectors,
+// offline. The clusters are a starting point, analysts rename and merge them before
+// saving them as tags of the responses.
+
+// The options of `ClusterTextAnswers`.
+type TopicOptions struct {
+	// The number of topics, sqrt(answers / 2) when zero.
+	Topics int
+	// The language of the answers, defaults to "en".
+	Language string
+	// Defaults to 5 keywords and 3 examples per topic when zero.
+	Keywords int
+	Examples int
+	// The same seed gives the same topics.
+	Seed int64
+}
+
+// A group of answers about the same theme.
+type Topic struct {
+	ID int
+	// Defaults to the top keywords, the tag the responses are saved under.
+	Name     string
+	Keywords []string
+	// The answers closest to the center of the topic.
+	Examples    []string
+	ResponseIDs []string
+}
+
+// The topics of the answers to a question.
+type TopicClustering struct {
+	QuestionID string
+	Topics     []Topic
+	// The answers left out, blank or only made of stop words.
+	Unclustered []string
+}
+
+// Groups the text answers to the question into topics.
+func ClusterTextAnswers(responses []SurveyResponse, questionID string, options TopicOptions) (*TopicClustering, error) {
+	if options.Topics < 0 {
+		return nil, fault.NewClientError(fmt.Sprintf("invalid number of topics %d", options.Topics), nil)
+	}
+	if options.Language == "" {
+		options.Language = "en"
+	}
+	if options.Keywords == 0 {
+		options.Keywords = 5
+	}
+	if options.Examples == 0 {
+		options.Examples = 3
+	}
+
+	clustering := &TopicClustering{QuestionID: questionID}
+
+	var (
+		documents [][]string
+		texts     []string
+		ids       []string
+	)
+
+	for _, response := range responses {
+		answer, ok := response.answer(questionID)
+		if !ok {
+			continue
+		}
+
+		text, ok := answer.Value.(string)
+		if !ok {
+			continue
+		}
+
+		words := textanalysis.Words(text, options.Language)
+		if len(words) == 0 {
+			clustering.Unclustered = append(clustering.Unclustered, response.ID)
+			continue
+		}
+
+		documents = append(documents, words)
+		texts = append(texts, strings.TrimSpace(text))
+		ids = append(ids, response.ID)
+	}
+
+	if len(documents) == 0 {
+		return clustering, nil
+	}
+
+	k := options.Topics
+	if k == 0 {
+		k = max(1, int(math.Round(math.Sqrt(float64(len(documents))/2))))
+	}
+
+	vectors := textanalysis.TFIDF(documents)
+	assignments, centroids := textanalysis.KMeans(vectors, k, options.Seed)
+
+	members := make([][]int, len(centroids))
+	for i, c := range assignments {
+		members[c] = append(members[c], i)
+	}
+
+	for c, centroid := range centroids {
+		if len(members[c]) == 0 {
+			continue
+		}
+
+		// closest to the centroid first
+		sort.SliceStable(members[c], func(i, j int) bool {
+			return vectors[members[c][i]].Dot(centroid) > vectors[members[c][j]].Dot(centroid)
+		})
+
+		topic := Topic{ID: len(clustering.Topics) + 1, Keywords: centroid.TopTerms(options.Keywords)}
+		topic.Name = strings.Join(topic.Keywords[:min(2, len(topic.Keywords))], " / ")
+
+		for i, member := range members[c] {
+			if i < options.Examples {
+				topic.Examples = append(topic.Examples, texts[member])
+			}
+			topic.ResponseIDs = append(topic.ResponseIDs, ids[member])
+		}
+
+		clustering.Topics = append(clustering.Topics, topic)
+	}
+
+	// largest topics first
+	sort.SliceStable(clustering.Topics, func(i, j int) bool {
+		return len(clustering.Topics[i].ResponseIDs) > len(clustering.Topics[j].ResponseIDs)
+	})
+	for i := range clustering.Topics {
+		clustering.Topics[i].ID = i + 1
+	}
+
+	return clustering, nil
+}
+
+func (c *TopicClustering) topic(id int) (int, error) {
+	index := slices.IndexFunc(c.Topics, func(topic Topic) bool { return topic.ID == id })
+	if index < 0 {
+		return 0, fault.NewClientError(fmt.Sprintf("topic %d does not exist", id), nil)
+	}
+
+	return index, nil
+}
+
+// Renames the topic, the name is the tag the responses are saved under.
+func (c *TopicClustering) Rename(id int, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fault.NewClientError("topic name is required", nil)
+	}
+
+	index, err := c.topic(id)
+	if err != nil {
+		return err
+	}
+
+	c.Topics[index].Name = name
+	return nil
+}
+
+// Moves the answers of the `from` topic into the `into` topic.
+func (c *TopicClustering) Merge(into, from int) error {
+	if into == from {
+		return fault.NewClientError("cannot merge a topic into itself", nil)
+	}
+
+	target, err := c.topic(into)
+	if err != nil {
+		return err
+	}
+
+	source, err := c.topic(from)
+	if err != nil {
+		return err
+	}
+
+	merged := &c.Topics[target]
+	merged.ResponseIDs = append(merged.ResponseIDs, c.Topics[source].ResponseIDs...)
+	merged.Examples = append(merged.Examples, c.Topics[source].Examples...)
+
+	for _, keyword := range c.Topics[source].Keywords {
+		if !slices.Contains(merged.Keywords, keyword) {
+			merged.Keywords = append(merged.Keywords, keyword)
+		}
+	}
+
+	c.Topics = slices.Delete(c.Topics, source, source+1)
+	return nil
+}
+
+// Handles the tags of the responses.
+type ResponseTagService interface {
+	// Tags the responses of each topic with the topic name.
+	SaveTopicTags(surveyID string, clustering TopicClustering) error
+	// Lists the tags of the responses of the survey, keyed by response ID.
+	ListResponseTags(surveyID string) (map[string][]models.ResponseTag, error)
+}
+
+type responseTagServiceImpl struct {
+	tags store.Datastorer[models.ResponseTag]
+}
+
+// Instantiate the `ResponseTagService`.
+func NewResponseTagService(tags store.Datastorer[models.ResponseTag]) ResponseTagService {
+	return &responseTagServiceImpl{tags: tags}
+}
+
+func (s *responseTagServiceImpl) SaveTopicTags(surveyID string, clustering TopicClustering) error {
+	id, err := strconv.Atoi(surveyID)
+	if err != nil {
+		return fault.ErrNotFound
+	}
+
+	var responseIDs, tags []string
+	for _, topic := range clustering.Topics {
+		for _, responseID := range topic.ResponseIDs {
+			responseIDs = append(responseIDs, responseID)
+			tags = append(tags, topic.Name)
+		}
+	}
+
+	if len(responseIDs) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	tx, err := s.tags.Base().BeginTxx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// the tags of a previous clustering are replaced, renamed topics included
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM survey_response_tags WHERE survey_id = $1 AND question_id = $2 AND response_id = ANY($3::text[])",
+		id, clustering.QuestionID, pq.Array(responseIDs),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO survey_response_tags (survey_id, response_id, question_id, tag)
+		SELECT $1, t.response_id, $2, t.tag FROM unnest($3::text[], $4::text[]) AS t(response_id, tag)
+		ON CONFLICT DO NOTHING`,
+		id, clustering.QuestionID, pq.Array(responseIDs), pq.Array(tags),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *responseTagServiceImpl) ListResponseTags(surveyID string) (map[string][]models.ResponseTag, error) {
+	id, err := strconv.Atoi(surveyID)
+	if err != nil {
+		return nil, fault.ErrNotFound
+	}
+
+	rows, err := s.tags.Select(context.Background(), "SELECT survey_id, response_id, question_id, tag FROM survey_response_tags WHERE survey_id = $1 ORDER BY response_id, question_id, tag", id)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string][]models.ResponseTag)
+	for _, row := range rows {
+		tags[row.ResponseID] = append(tags[row.ResponseID], row)
+	}
+
+	return tags, nil
+}
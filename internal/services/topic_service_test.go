@@ -0,0 +1,143 @@
+package services
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/paulexconde/justasking/internal/models"
+	"github.com/paulexconde/justasking/internal/pkg/fault"
+	"github.com/paulexconde/justasking/internal/pkg/store"
+)
+
+func TestClusterTextAnswers(t *testing.T) {
+	answers := []string{
+		"Delivery was late and the delivery driver was slow",
+		"Late delivery again, slow shipping",
+		"Shipping delivery took too long, very late",
+		"The price is too expensive",
+		"Expensive price for what you get",
+		"Price increase made it too expensive",
+		"the and of",
+	}
+
+	var responses []SurveyResponse
+	for i, answer := range answers {
+		responses = append(responses, textResponse(string(rune('a'+i)), answer))
+	}
+
+	clustering, err := ClusterTextAnswers(responses, "why", TopicOptions{Topics: 2, Seed: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(clustering.Topics) != 2 || len(clustering.Unclustered) != 1 {
+		t.Fatalf("expected 2 topics and a stop words only answer left out, got %+v", clustering)
+	}
+
+	for _, topic := range clustering.Topics {
+		delivery := slices.Contains(topic.ResponseIDs, "a")
+		for _, id := range topic.ResponseIDs {
+			if (id < "d") != delivery {
+				t.Errorf("expected the delivery and price answers apart, got %+v", clustering.Topics)
+			}
+		}
+
+		if delivery && !slices.Contains(topic.Keywords, "delivery") {
+			t.Errorf("expected delivery to be a keyword, got %v", topic.Keywords)
+		}
+		if len(topic.Examples) != 3 || topic.Name == "" {
+			t.Errorf("unexpected topic %+v", topic)
+		}
+	}
+
+	if err := clustering.Rename(1, "Shipping"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := clustering.Merge(1, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clustering.Topics) != 1 || clustering.Topics[0].Name != "Shipping" || len(clustering.Topics[0].ResponseIDs) != 6 {
+		t.Errorf("expected a single merged topic, got %+v", clustering.Topics)
+	}
+
+	if err := clustering.Merge(1, 2); !fault.IsClientError(err) {
+		t.Errorf("expected a client error merging a missing topic, got %v", err)
+	}
+}
+
+// A tag store on the recording database.
+type recordingTagStore struct {
+	store.Datastorer[models.ResponseTag]
+	db *sqlx.DB
+}
+
+func (s recordingTagStore) Base() *sqlx.DB { return s.db }
+
+// The text array as sent by `pq.Array`.
+func recordedArray(t *testing.T, value any) []string {
+	t.Helper()
+
+	var values []string
+	for _, item := range strings.Split(strings.Trim(value.(string), "{}"), ",") {
+		unquoted, err := strconv.Unquote(item)
+		if err != nil {
+			t.Fatalf("unexpected array item %q: %v", item, err)
+		}
+		values = append(values, unquoted)
+	}
+
+	return values
+}
+
+func TestSaveTopicTags_Renamed(t *testing.T) {
+	db, execs := recordingDB(t, nil)
+	tagservice := NewResponseTagService(recordingTagStore{db: db})
+
+	// replays the recorded statements on the tags of q1 keyed by response ID
+	tags := make(map[string][]string)
+	replay := func() {
+		for _, exec := range *execs {
+			responseIDs := recordedArray(t, exec.args[2])
+			switch {
+			case strings.HasPrefix(exec.query, "DELETE"):
+				for _, responseID := range responseIDs {
+					delete(tags, responseID)
+				}
+			case strings.HasPrefix(exec.query, "INSERT"):
+				names := recordedArray(t, exec.args[3])
+				for i, responseID := range responseIDs {
+					if !slices.Contains(tags[responseID], names[i]) {
+						tags[responseID] = append(tags[responseID], names[i])
+					}
+				}
+			}
+		}
+		*execs = nil
+	}
+
+	clustering := TopicClustering{QuestionID: "q1", Topics: []Topic{
+		{ID: 1, Name: "delivery", ResponseIDs: []string{"r1", "r2"}},
+		{ID: 2, Name: "price", ResponseIDs: []string{"r3"}},
+	}}
+
+	if err := tagservice.SaveTopicTags("1", clustering); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	replay()
+
+	clustering.Topics[0].Name = "shipping"
+	if err := tagservice.SaveTopicTags("1", clustering); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	replay()
+
+	want := map[string][]string{"r1": {"shipping"}, "r2": {"shipping"}, "r3": {"price"}}
+	for responseID, names := range want {
+		if !slices.Equal(tags[responseID], names) {
+			t.Errorf("expected response %s to be tagged %v, got %v", responseID, names, tags[responseID])
+		}
+	}
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS survey_questions;
+DROP TABLE IF EXISTS surveys;
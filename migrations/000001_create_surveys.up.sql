@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS surveys (
+    id            SERIAL PRIMARY KEY,
+    title         TEXT NOT NULL,
+    start_id      TEXT NOT NULL,
+    locale        TEXT NOT NULL DEFAULT '',
+    status        TEXT NOT NULL DEFAULT 'draft',
+    opens_at      TIMESTAMPTZ,
+    closes_at     TIMESTAMPTZ,
+    max_responses INTEGER NOT NULL DEFAULT 0,
+    endings       JSONB,
+    translations  JSONB
+);
+
+CREATE TABLE IF NOT EXISTS survey_questions (
+    survey_id     INTEGER NOT NULL REFERENCES surveys (id) ON DELETE CASCADE,
+    id            TEXT NOT NULL,
+    text          TEXT NOT NULL,
+    question_type TEXT NOT NULL,
+    options       TEXT[] NOT NULL DEFAULT '{}',
+    next          JSONB,
+    conditionals  JSONB,
+    PRIMARY KEY (survey_id, id)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS survey_answers;
+DROP TABLE IF EXISTS survey_responses;
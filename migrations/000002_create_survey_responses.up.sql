@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS survey_responses (
+    id          SERIAL PRIMARY KEY,
+    survey_id   INTEGER NOT NULL REFERENCES surveys (id) ON DELETE CASCADE,
+    response_id TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (survey_id, response_id)
+);
+
+CREATE TABLE IF NOT EXISTS survey_answers (
+    response_id INTEGER NOT NULL REFERENCES survey_responses (id) ON DELETE CASCADE,
+    question_id TEXT NOT NULL,
+    value       JSONB,
+    shown_at    TIMESTAMPTZ,
+    answered_at TIMESTAMPTZ,
+    PRIMARY KEY (response_id, question_id)
+);
+
+CREATE INDEX IF NOT EXISTS survey_responses_survey_id_idx ON survey_responses (survey_id, created_at);
@@ -0,0 +1,6 @@
+ALTER TABLE survey_questions
+    DROP COLUMN IF EXISTS library_linked,
+    DROP COLUMN IF EXISTS library_version,
+    DROP COLUMN IF EXISTS library_id;
+
+DROP TABLE IF EXISTS library_questions;
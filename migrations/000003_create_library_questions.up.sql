@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS library_questions (
+    id            SERIAL PRIMARY KEY,
+    text          TEXT NOT NULL,
+    question_type TEXT NOT NULL,
+    options       TEXT[] NOT NULL DEFAULT '{}',
+    tags          TEXT[] NOT NULL DEFAULT '{}',
+    version       INTEGER NOT NULL DEFAULT 1,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE survey_questions
+    ADD COLUMN IF NOT EXISTS library_id      INTEGER REFERENCES library_questions (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS library_version INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS library_linked  BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS survey_questions_library_id_idx ON survey_questions (library_id);
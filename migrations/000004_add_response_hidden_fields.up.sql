@@ -0,0 +1 @@
+ALTER TABLE survey_responses ADD COLUMN IF NOT EXISTS hidden_fields JSONB NOT NULL DEFAULT '{}';
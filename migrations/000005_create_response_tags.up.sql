@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS survey_response_tags (
+    survey_id   INTEGER NOT NULL,
+    response_id TEXT NOT NULL,
+    question_id TEXT NOT NULL,
+    tag         TEXT NOT NULL,
+    PRIMARY KEY (survey_id, response_id, question_id, tag),
+    FOREIGN KEY (survey_id, response_id) REFERENCES survey_responses (survey_id, response_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS survey_response_tags_tag_idx ON survey_response_tags (survey_id, tag);
@@ -0,0 +1 @@
+ALTER TABLE survey_responses ADD COLUMN IF NOT EXISTS weight DOUBLE PRECISION NOT NULL DEFAULT 1 CHECK (weight > 0);
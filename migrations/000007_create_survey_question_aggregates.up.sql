@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS survey_question_aggregates (
+    survey_id     INTEGER NOT NULL REFERENCES surveys (id) ON DELETE CASCADE,
+    question_id   TEXT NOT NULL,
+    answered      INTEGER NOT NULL DEFAULT 0,
+    numeric_count INTEGER NOT NULL DEFAULT 0,
+    sum           DOUBLE PRECISION NOT NULL DEFAULT 0,
+    sum_squares   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    min           DOUBLE PRECISION,
+    max           DOUBLE PRECISION,
+    promoters     INTEGER NOT NULL DEFAULT 0,
+    passives      INTEGER NOT NULL DEFAULT 0,
+    detractors    INTEGER NOT NULL DEFAULT 0,
+    value_counts  JSONB NOT NULL DEFAULT '{}',
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (survey_id, question_id)
+);
@@ -0,0 +1,9 @@
+ALTER TABLE survey_question_aggregates
+    DROP COLUMN IF EXISTS weight_sum,
+    DROP COLUMN IF EXISTS weight_squares,
+    DROP COLUMN IF EXISTS weighted_sum,
+    DROP COLUMN IF EXISTS weighted_sum_squares,
+    DROP COLUMN IF EXISTS weighted_promoters,
+    DROP COLUMN IF EXISTS weighted_passives,
+    DROP COLUMN IF EXISTS weighted_detractors,
+    DROP COLUMN IF EXISTS nps_weight_squares;
@@ -0,0 +1,21 @@
+ALTER TABLE survey_question_aggregates
+    ADD COLUMN IF NOT EXISTS weight_sum           DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS weight_squares       DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS weighted_sum         DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS weighted_sum_squares DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS weighted_promoters   DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS weighted_passives    DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS weighted_detractors  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS nps_weight_squares   DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+-- the existing aggregates are unweighted, the weighted surveys are rebuilt with
+-- cmd/rebuild-aggregates
+UPDATE survey_question_aggregates SET
+    weight_sum = numeric_count,
+    weight_squares = numeric_count,
+    weighted_sum = sum,
+    weighted_sum_squares = sum_squares,
+    weighted_promoters = promoters,
+    weighted_passives = passives,
+    weighted_detractors = detractors,
+    nps_weight_squares = promoters + passives + detractors;